@@ -1,19 +1,165 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Wa4h1h/go-tftp/pkg/backoff"
 	"github.com/Wa4h1h/go-tftp/pkg/client"
+	"github.com/Wa4h1h/go-tftp/pkg/progress"
+	"github.com/Wa4h1h/go-tftp/pkg/server"
+	"github.com/Wa4h1h/go-tftp/pkg/types"
 	"github.com/Wa4h1h/go-tftp/pkg/utils"
 )
 
 var (
+	version  = "dev"
 	logLevel = utils.GetEnv[string]("TFTP_LOG_LEVEL", "debug", false)
 	numTries = utils.GetEnv[uint]("TFTP_NUM_TRIES", "5", false)
 )
 
+func runBatch(tftp *client.Client, manifest string, addr string, parallelism int, quiet bool, jsonOut bool) int {
+	if strings.HasPrefix(addr, ":") {
+		fmt.Fprintln(os.Stderr, "-batch requires -host")
+
+		return client.ExitUsage
+	}
+
+	f := os.Stdin
+
+	if manifest != "-" {
+		var err error
+
+		if f, err = os.Open(manifest); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+
+			return client.ExitUsage
+		}
+
+		defer f.Close()
+	}
+
+	jobs, err := client.ParseManifest(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", manifest, err.Error())
+
+		return client.ExitUsage
+	}
+
+	if err := tftp.Connect(addr); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+
+		return client.ExitFailure
+	}
+
+	report := client.NewBatch(tftp, addr, parallelism).Run(jobs)
+
+	if jsonOut {
+		b, err := json.Marshal(report)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+
+			return client.ExitFailure
+		}
+
+		fmt.Println(string(b))
+	} else {
+		report.Print(os.Stdout, quiet)
+	}
+
+	return report.ExitCode()
+}
+
 func main() {
-	l := utils.NewLogger(logLevel).Sugar()
-	tftp := client.NewClient(l, numTries)
-	c := client.NewCli(l, tftp)
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	host := fs.String("host", "", "server host to connect to on startup")
+	port := fs.String("port", "69", "server port")
+	mode := fs.String("mode", types.DefaultMode, "transfer mode: octet or netascii")
+	timeout := fs.Uint("timeout", types.DefaultClientTimeout, "total deadline of a transfer in seconds, 0 disables it")
+	rexmt := fs.Uint("rexmt", types.DefaultRexmt, "seconds waited for an answer before a packet is sent again")
+	retries := fs.Uint("retries", numTries, "number of tries per packet, overrides $TFTP_NUM_TRIES")
+	requestRetries := fs.Uint("request-retries", 0, "number of times an unanswered request is sent again from a new port")
+	minRTO := fs.Duration("rto-min", server.DefaultMinRTO, "lower bound of the retransmit timeout adapted to the round trip time, 0 disables the adaptation")
+	maxRTO := fs.Duration("rto-max", 0, "upper bound of the adaptive retransmit timeout, defaults to -rexmt")
+	backoffPolicy := fs.String("backoff", backoff.NameFixed, "spacing of retransmissions: fixed or exponential")
+	level := fs.String("log-level", logLevel, "log level, overrides $TFTP_LOG_LEVEL")
+	trace := fs.Bool("trace", false, "log each sent/received udp packet")
+	overwrite := fs.Bool("overwrite", false, "overwrite existing local files on get")
+	resume := fs.Bool("resume", false, "keep interrupted downloads and resume them on the next get")
+	showProgress := fs.Bool("progress", progress.IsTerminal(os.Stderr), "show a progress bar on stderr, defaults to true on terminals")
+	quiet := fs.Bool("quiet", false, "one-shot and batch mode: only print errors")
+	jsonOut := fs.Bool("json", false, "one-shot and batch mode: print the transfer results as json")
+	batch := fs.String("batch", "", "run the transfers listed in a manifest file (- for stdin) against -host and exit")
+	parallel := fs.Int("parallel", client.DefaultParallelism, "number of concurrent transfers of batches, mget and mput")
+	printVersion := fs.Bool("version", false, "print the version and exit")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] [get <host[:port]> <remote> [local] | put <host[:port]> <local> [remote]]\n", fs.Name())
+		fmt.Fprintf(fs.Output(), "       %s [flags] -host <host> -batch <manifest>\n\n", fs.Name())
+		fmt.Fprintf(fs.Output(), "Without arguments an interactive session is started, use - as local file for stdin/stdout.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(os.Args[1:])
+
+	if *printVersion {
+		fmt.Println(version)
+
+		return
+	}
+
+	l := utils.NewLogger(*level).Sugar()
+	tftp := client.NewClient(l, *retries)
+	tftp.SetTimeout(*timeout)
+	tftp.SetRexmt(*rexmt)
+	tftp.SetRequestRetries(*requestRetries)
+	tftp.SetRTO(*minRTO, *maxRTO)
+
+	if err := tftp.SetBackoff(*backoffPolicy); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	if *trace {
+		tftp.SetTrace()
+	}
+
+	if *overwrite {
+		tftp.SetOverwrite()
+	}
+
+	if *resume {
+		tftp.SetResume()
+	}
+
+	if *showProgress && !*quiet && !*jsonOut {
+		tftp.SetProgress()
+	}
+
+	if err := tftp.SetMode(*mode); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", err.Error(), *mode)
+		os.Exit(1)
+	}
+
+	if fs.NArg() > 0 {
+		os.Exit(client.NewOneShot(tftp, *port, *quiet, *jsonOut).Run(fs.Args()))
+	}
+
+	if *batch != "" {
+		os.Exit(runBatch(tftp, *batch, client.JoinHostPort(*host, *port), *parallel, *quiet, *jsonOut))
+	}
+
+	if *host != "" {
+		if err := tftp.Connect(client.JoinHostPort(*host, *port)); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	c := client.NewCli(l, tftp, *parallel)
 
 	c.Read()
 }
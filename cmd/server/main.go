@@ -1,46 +1,229 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"go.uber.org/zap"
+
+	"github.com/Wa4h1h/go-tftp/pkg/audit"
+	"github.com/Wa4h1h/go-tftp/pkg/config"
+	"github.com/Wa4h1h/go-tftp/pkg/relay"
 	"github.com/Wa4h1h/go-tftp/pkg/server"
 	"github.com/Wa4h1h/go-tftp/pkg/utils"
 )
 
-var (
-	tftpPort          = utils.GetEnv[string]("TFTP_PORT", "69", false)
-	logLevel          = utils.GetEnv[string]("TFTP_LOG_LEVEL", "debug", false)
-	readTimeout       = utils.GetEnv[uint]("TFTP_READ_TIMEOUT", "5", false)
-	writeTimeout      = utils.GetEnv[uint]("TFTP_WRITE_TIMEOUT", "5", false)
-	numTries          = utils.GetEnv[uint]("TFTP_NUM_TRIES", "5", false)
-	tftpBaseDir       = utils.GetEnv[string]("TFTP_BASE_DIR", utils.UserHomeDirPath(), false)
-	tftpEnableTracing = utils.GetEnv[bool]("TFTP_TRACE", "true", false)
-)
+var version = "dev"
+
+func loadConfig(path string, overrides *config.Overrides, createBaseDir bool) (*config.Server, error) {
+	cfg, err := config.Load(path, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	if createBaseDir && cfg.IsDefault("base_dir") {
+		if err := os.MkdirAll(cfg.BaseDir, 0o750); err != nil {
+			return nil, fmt.Errorf("error while creating tftp base dir: %w", err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// newRelay returns the relay of cfg, nil when no route is configured. Its
+// upstreams are tried num_tries times per packet.
+func newRelay(l *zap.SugaredLogger, cfg *config.Server) (server.Relay, error) {
+	if len(cfg.Relay.Routes) == 0 {
+		return nil, nil
+	}
+
+	routes := make([]relay.Route, 0, len(cfg.Relay.Routes))
+
+	for _, r := range cfg.Relay.Routes {
+		routes = append(routes, relay.Route{Prefix: r.Prefix, Upstream: r.Upstream, Timeout: cfg.RouteTimeout(r)})
+	}
+
+	r, err := relay.New(l, routes, cfg.NumTries)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func reload(l *zap.SugaredLogger, level zap.AtomicLevel, s *server.Server,
+	cfg *config.Server, path string, overrides *config.Overrides,
+) *config.Server {
+	newCfg, err := loadConfig(path, overrides, false)
+	if err != nil {
+		l.Errorf("error while reloading config, keeping current settings:\n%s", err.Error())
+
+		return cfg
+	}
+
+	if newCfg.Address.String() != cfg.Address.String() || newCfg.Port != cfg.Port ||
+		newCfg.BaseDir != cfg.BaseDir || newCfg.Audit != cfg.Audit {
+		l.Warn("address, port, base_dir and audit settings changes require a restart")
+	}
+
+	level.SetLevel(utils.ParseLogLevel(newCfg.LogLevel))
+	s.SetTransferOptions(newCfg.ReadTimeout, newCfg.WriteTimeout, int(newCfg.NumTries), newCfg.Trace)
+	s.SetBackoff(newCfg.BackoffPolicy())
+	s.SetRTO(newCfg.RTO())
+	s.SetReadAhead(int(newCfg.ReadAhead))
+	s.SetMmap(newCfg.Mmap)
+	s.SetCacheSize(int64(newCfg.CacheSize) << 20)
+	s.SetArchives(newCfg.Archives)
+	s.SetUploadCompression(newCfg.UploadCodec())
+
+	if p, err := newCfg.UpstreamProxy(); err != nil {
+		l.Errorf("error while configuring the proxy, keeping the current one: %s", err.Error())
+	} else {
+		s.SetProxy(p)
+	}
+
+	if r, err := newRelay(l, newCfg); err != nil {
+		l.Errorf("error while configuring the relay, keeping the current one: %s", err.Error())
+	} else {
+		s.SetRelay(r)
+	}
+
+	newCfg.Address, newCfg.Port, newCfg.BaseDir, newCfg.Audit = cfg.Address, cfg.Port, cfg.BaseDir, cfg.Audit
+
+	l.Info("config reloaded")
+
+	return newCfg
+}
+
+func logCacheStats(l *zap.SugaredLogger, s *server.Server) {
+	stats, ok := s.CacheStats()
+	if !ok {
+		l.Info("file cache disabled")
+
+		return
+	}
+
+	l.Infof("file cache: %d hits, %d misses, %d evictions, %d invalidations, %d files, %d/%d bytes",
+		stats.Hits, stats.Misses, stats.Evictions, stats.Invalidations, stats.Files, stats.Bytes, stats.Budget)
+}
 
 func main() {
-	l := utils.NewLogger(logLevel).Sugar()
-	s := server.NewServer(l, tftpPort, readTimeout, writeTimeout, int(numTries), tftpBaseDir, tftpEnableTracing)
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	configPath := fs.String("config", os.Getenv("TFTP_CONFIG"), "path of the yaml config file, overrides $TFTP_CONFIG")
+	checkConfig := fs.Bool("check-config", false, "validate the configuration and exit")
+	printVersion := fs.Bool("version", false, "print the version and exit")
+	overrides := config.RegisterFlags(fs)
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags]\n\nFlags:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(os.Args[1:])
+
+	if *printVersion {
+		fmt.Println(version)
+
+		return
+	}
+
+	cfg, err := loadConfig(*configPath, overrides, !*checkConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if *checkConfig {
+		fmt.Println("configuration ok")
+
+		return
+	}
+
+	logger, level := utils.NewLoggerWithLevel(cfg.LogLevel)
+	l := logger.Sugar()
+	s := server.NewServer(l, cfg.Address, cfg.Port, cfg.ReadTimeout, cfg.WriteTimeout, int(cfg.NumTries), cfg.BaseDir, cfg.Trace)
+	s.SetBackoff(cfg.BackoffPolicy())
+	s.SetRTO(cfg.RTO())
+	s.SetReadAhead(int(cfg.ReadAhead))
+	s.SetMmap(cfg.Mmap)
+	s.SetCacheSize(int64(cfg.CacheSize) << 20)
+	s.SetArchives(cfg.Archives)
+	s.SetUploadCompression(cfg.UploadCodec())
+
+	p, err := cfg.UpstreamProxy()
+	if err != nil {
+		l.Errorf("error while configuring the proxy: %s", err.Error())
+		os.Exit(1)
+	}
+
+	s.SetProxy(p)
+
+	r, err := newRelay(l, cfg)
+	if err != nil {
+		l.Errorf("error while configuring the relay: %s", err.Error())
+		os.Exit(1)
+	}
+
+	s.SetRelay(r)
+
+	if cfg.Audit.Path != "" {
+		a, err := audit.NewLog(cfg.Audit.Path, int64(cfg.Audit.MaxSize)<<20, int(cfg.Audit.MaxBackups))
+		if err != nil {
+			l.Errorf("error while opening audit log: %s", err.Error())
+			os.Exit(1)
+		}
+
+		defer func() {
+			if err := a.Close(); err != nil {
+				l.Errorf("error while closing audit log: %s", err.Error())
+			}
+		}()
+
+		s.SetAuditRecorder(a)
+	}
+
+	if err := s.Listen(); err != nil {
+		l.Error(err.Error())
+		os.Exit(1)
+	}
 
 	go func() {
-		if err := s.ListenAndServe(); err != nil {
+		if err := s.Serve(); err != nil {
 			l.Error(err.Error())
 		}
 	}()
 
-	l.Infof("listening on port %s", tftpPort)
+	for _, addr := range s.Addrs() {
+		l.Infof("listening on %s", addr.String())
+	}
 
 	defer func() {
 		if err := s.Close(); err != nil {
 			panic(err)
 		}
 
-		l.Infof("closed connection on port %s", tftpPort)
+		l.Infof("closed connections on port %s", cfg.Port)
 	}()
 
-	// listen shutdown signal
+	// listen shutdown, reload and stats signals
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	<-signalChan
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
+
+	for sig := range signalChan {
+		switch sig {
+		case syscall.SIGHUP:
+			cfg = reload(l, level, s, cfg, *configPath, overrides)
+		case syscall.SIGUSR1:
+			logCacheStats(l, s)
+		default:
+			return
+		}
+	}
 }
@@ -2,10 +2,14 @@ module github.com/Wa4h1h/go-tftp
 
 go 1.22.0
 
-require go.uber.org/zap v1.26.0
+require (
+	github.com/klauspost/compress v1.17.11
+	go.uber.org/zap v1.26.0
+	golang.org/x/sys v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/stretchr/testify v1.8.4 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
-	golang.org/x/sys v0.17.0 // indirect
 )
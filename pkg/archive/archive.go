@@ -0,0 +1,129 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+// Archive is an archive mounted read-only.
+type Archive interface {
+	// Open opens the regular file name, a slash separated path relative to
+	// the root of the archive. Missing members wrap fs.ErrNotExist.
+	Open(name string) (*File, error)
+	Close() error
+}
+
+type format struct {
+	ext  string
+	open func(f *os.File, size int64) (Archive, error)
+}
+
+// formats are matched against the end of the archive name, seekable formats
+// serve their members straight from the archive, tar.gz and compressed zip
+// members are decompressed while being read.
+var formats = []format{
+	{".tar", openTar},
+	{".tar.gz", openTarGz},
+	{".tgz", openTarGz},
+	{".zip", openZip},
+	{".iso", openISO},
+}
+
+func formatOf(name string) (format, bool) {
+	name = strings.ToLower(name)
+
+	for _, f := range formats {
+		if strings.HasSuffix(name, f.ext) && len(name) > len(f.ext) {
+			return f, true
+		}
+	}
+
+	return format{}, false
+}
+
+// Supported reports whether name has the extension of a supported archive.
+func Supported(name string) bool {
+	_, ok := formatOf(name)
+
+	return ok
+}
+
+// Mount opens the archive at path, its format is chosen by extension.
+func Mount(path string) (Archive, error) {
+	format, ok := formatOf(path)
+	if !ok {
+		return nil, fmt.Errorf("error: %s is not a supported archive", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+
+		return nil, err
+	}
+
+	a, err := format.open(f, info.Size())
+	if err != nil {
+		f.Close()
+
+		return nil, fmt.Errorf("error while mounting %s: %w", path, err)
+	}
+
+	return a, nil
+}
+
+// File is a member of an archive. Members read from the archive as stored
+// seek freely, compressed ones only skip forward.
+type File struct {
+	// compressed members seek forward by decompressing
+	utils.ForwardSeeker
+	Name    string
+	Size    int64
+	ModTime time.Time
+
+	// closer releases the decompressor, release the mount of the archive
+	closer  io.Closer
+	release func() error
+}
+
+// newFile returns the member name read from r, closer releases r when set.
+func newFile(name string, size int64, modTime time.Time, r io.Reader, closer io.Closer) *File {
+	return &File{ForwardSeeker: utils.NewForwardSeeker(r, size), Name: name, Size: size, ModTime: modTime, closer: closer}
+}
+
+func (f *File) Close() error {
+	var errs []error
+
+	if f.closer != nil {
+		errs = append(errs, f.closer.Close())
+	}
+
+	if f.release != nil {
+		errs = append(errs, f.release())
+	}
+
+	return errors.Join(errs...)
+}
+
+// cleanName turns a member name of an archive into the form requested by
+// clients, without leading slash or dot.
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func notExist(name string) error {
+	return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
@@ -0,0 +1,282 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var members = map[string][]byte{
+	"casper/vmlinuz": bytes.Repeat([]byte("kernel"), 2000),
+	"readme.txt":     []byte("hello"),
+	"empty":          nil,
+}
+
+func writeTar(t *testing.T, w io.Writer, files map[string][]byte) {
+	t.Helper()
+
+	tw := tar.NewWriter(w)
+
+	if err := tw.WriteHeader(&tar.Header{Name: "./casper/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		hdr := &tar.Header{Name: "./" + name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content)), ModTime: time.Now()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeZip(t *testing.T, w io.Writer, files map[string][]byte) {
+	t.Helper()
+
+	zw := zip.NewWriter(w)
+
+	for name, content := range files {
+		// the kernel is compressed, the other members are stored
+		method := zip.Store
+		if name == "casper/vmlinuz" {
+			method = zip.Deflate
+		}
+
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := fw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeArchive(t *testing.T, dir string, name string, files map[string][]byte) string {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	switch filepath.Ext(name) {
+	case ".tar":
+		writeTar(t, &b, files)
+	case ".tgz":
+		gz := gzip.NewWriter(&b)
+		writeTar(t, gz, files)
+
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	case ".zip":
+		writeZip(t, &b, files)
+	case ".iso":
+		b.Write(buildISO(t, files, true))
+	}
+
+	// archives are replaced atomically, members being read keep the old one
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path+".tmp", b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func readMember(t *testing.T, a Archive, name string) []byte {
+	t.Helper()
+
+	f, err := a.Open(name)
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+
+	defer f.Close()
+
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if int64(len(got)) != f.Size {
+		t.Fatalf("%s: read %d bytes, size is %d", name, len(got), f.Size)
+	}
+
+	return got
+}
+
+func TestFormats(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"release.tar", "release.tgz", "release.zip", "release.iso"} {
+		t.Run(name, func(t *testing.T) {
+			a, err := Mount(writeArchive(t, dir, name, members))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer a.Close()
+
+			for member, content := range members {
+				if got := readMember(t, a, member); !bytes.Equal(got, content) {
+					t.Fatalf("%s: got %d bytes, expected %d", member, len(got), len(content))
+				}
+			}
+
+			for _, missing := range []string{"missing", "casper", "readme.txt/x"} {
+				if _, err := a.Open(missing); !errors.Is(err, fs.ErrNotExist) {
+					t.Fatalf("%s: expected fs.ErrNotExist, got %v", missing, err)
+				}
+			}
+
+			// seeking is what resumes a transfer at an offset
+			f, err := a.Open("casper/vmlinuz")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer f.Close()
+
+			if _, err := f.Seek(6, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+
+			rest, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(rest, members["casper/vmlinuz"][6:]) {
+				t.Fatal("seek did not skip to the offset")
+			}
+		})
+	}
+}
+
+func TestSupported(t *testing.T) {
+	for name, ok := range map[string]bool{
+		"a.iso": true, "a.ISO": true, "a.tar.gz": true, "a.tgz": true, "a.zip": true, "a.tar": true,
+		".iso": false, "a.txt": false, "a.gz": false, "iso": false,
+	} {
+		if Supported(name) != ok {
+			t.Fatalf("Supported(%q) should be %t", name, ok)
+		}
+	}
+}
+
+func TestMountsRemount(t *testing.T) {
+	dir := t.TempDir()
+	path := writeArchive(t, dir, "release.zip", map[string][]byte{"readme.txt": []byte("hello")})
+	m := NewMounts()
+
+	defer m.Close()
+
+	f, err := m.Open(path, "readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// replace the archive while a member is open
+	writeArchive(t, dir, "release.zip", map[string][]byte{"readme.txt": []byte("updated")})
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := m.Open(path, "readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := io.ReadAll(g); string(got) != "updated" {
+		t.Fatalf("got %q from the remounted archive", got)
+	}
+
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the previous mount stays open for its member
+	if got, _ := io.ReadAll(f); string(got) != "hello" {
+		t.Fatalf("got %q from the previous mount", got)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Open(filepath.Join(dir, "missing.iso"), "readme.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestMountsConcurrentOpen(t *testing.T) {
+	dir := t.TempDir()
+	iso := writeArchive(t, dir, "release.iso", members)
+	tgz := writeArchive(t, dir, "release.tgz", members)
+	m := NewMounts()
+
+	defer m.Close()
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			path := iso
+			if i%2 == 1 {
+				path = tgz
+			}
+
+			f, err := m.Open(path, "readme.txt")
+			if err != nil {
+				t.Errorf("open %s: %v", path, err)
+
+				return
+			}
+
+			if got, _ := io.ReadAll(f); string(got) != "hello" {
+				t.Errorf("got %q from %s", got, path)
+			}
+
+			if err := f.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// each archive is mounted by a single request, the others wait for it
+	if len(m.mounts) != 2 || len(m.pending) != 0 {
+		t.Fatalf("got %d mounts and %d pending, expected 2 and 0", len(m.mounts), len(m.pending))
+	}
+}
@@ -0,0 +1,248 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	isoSectorSize = 2048
+	// isoDescriptorSector is the first volume descriptor, the sectors before
+	// it are the system area
+	isoDescriptorSector = 16
+	isoRecordHeaderSize = 33
+
+	isoFlagDir         = 1 << 1
+	isoFlagMultiExtent = 1 << 7
+)
+
+var isoMagic = []byte("CD001")
+
+// isoRecord is a directory record of an ISO9660 image.
+type isoRecord struct {
+	name    string
+	extent  int64
+	size    int64
+	flags   byte
+	modTime time.Time
+}
+
+// isoArchive reads ISO9660 images with or without Rock Ridge names, members
+// are read in place. Names without Rock Ridge match case-insensitively and
+// without their version suffix.
+type isoArchive struct {
+	f         *os.File
+	blockSize int64
+	root      isoRecord
+	rockRidge bool
+}
+
+func openISO(f *os.File, size int64) (Archive, error) {
+	a := &isoArchive{f: f}
+
+	for sector := int64(isoDescriptorSector); ; sector++ {
+		if (sector+1)*isoSectorSize > size {
+			return nil, errors.New("error: no primary volume descriptor")
+		}
+
+		desc := make([]byte, isoSectorSize)
+		if _, err := f.ReadAt(desc, sector*isoSectorSize); err != nil {
+			return nil, fmt.Errorf("error while reading volume descriptor: %w", err)
+		}
+
+		if !bytes.Equal(desc[1:6], isoMagic) {
+			return nil, errors.New("error: not an ISO9660 image")
+		}
+
+		switch desc[0] {
+		case 1:
+			a.blockSize = int64(binary.LittleEndian.Uint16(desc[128:130]))
+			if a.blockSize == 0 {
+				return nil, errors.New("error: invalid logical block size")
+			}
+
+			root, _, err := parseISORecord(desc[156:190], false)
+			if err != nil {
+				return nil, err
+			}
+
+			a.root = root
+
+			return a, a.detectRockRidge()
+		case 255:
+			return nil, errors.New("error: no primary volume descriptor")
+		}
+	}
+}
+
+// detectRockRidge looks for the SUSP entry starting the system use area of
+// the first record of the root directory.
+func (a *isoArchive) detectRockRidge() error {
+	dir, err := a.readExtent(a.root)
+	if err != nil {
+		return err
+	}
+
+	if len(dir) < isoRecordHeaderSize || int(dir[0]) > len(dir) {
+		return errors.New("error: invalid root directory")
+	}
+
+	su := systemUse(dir[:dir[0]])
+	a.rockRidge = len(su) >= 7 && string(su[:2]) == "SP" && su[4] == 0xbe && su[5] == 0xef
+
+	return nil
+}
+
+func (a *isoArchive) readExtent(r isoRecord) ([]byte, error) {
+	b := make([]byte, r.size)
+	if _, err := a.f.ReadAt(b, r.extent*a.blockSize); err != nil {
+		return nil, fmt.Errorf("error while reading directory: %w", err)
+	}
+
+	return b, nil
+}
+
+// parseISORecord parses the record at the start of b, n is its length and 0
+// for the padding at the end of a sector.
+func parseISORecord(b []byte, rockRidge bool) (isoRecord, int, error) {
+	n := int(b[0])
+	if n == 0 {
+		return isoRecord{}, 0, nil
+	}
+
+	if n < isoRecordHeaderSize || n > len(b) || isoRecordHeaderSize+int(b[32]) > n {
+		return isoRecord{}, 0, errors.New("error: invalid directory record")
+	}
+
+	r := isoRecord{
+		extent:  int64(binary.LittleEndian.Uint32(b[2:6])),
+		size:    int64(binary.LittleEndian.Uint32(b[10:14])),
+		flags:   b[25],
+		name:    string(b[33 : 33+int(b[32])]),
+		modTime: isoTime(b[18:25]),
+	}
+
+	if name, ok := rockRidgeName(systemUse(b[:n])); rockRidge && ok {
+		r.name = name
+	} else {
+		r.name = strings.TrimSuffix(strings.SplitN(r.name, ";", 2)[0], ".")
+	}
+
+	return r, n, nil
+}
+
+// systemUse returns the system use area of a record, after the name and its
+// padding byte.
+func systemUse(record []byte) []byte {
+	start := isoRecordHeaderSize + int(record[32])
+	if start%2 == 1 {
+		start++
+	}
+
+	if start > len(record) {
+		return nil
+	}
+
+	return record[start:]
+}
+
+// rockRidgeName concatenates the NM entries of a system use area.
+func rockRidgeName(su []byte) (string, bool) {
+	var (
+		name  []byte
+		found bool
+	)
+
+	for len(su) >= 4 {
+		n := int(su[2])
+		if n < 4 || n > len(su) {
+			break
+		}
+
+		if string(su[:2]) == "NM" && n >= 5 {
+			name = append(name, su[5:n]...)
+			found = true
+		}
+
+		su = su[n:]
+	}
+
+	return string(name), found
+}
+
+func isoTime(b []byte) time.Time {
+	zone := time.FixedZone("", int(int8(b[6]))*15*60)
+
+	return time.Date(1900+int(b[0]), time.Month(b[1]), int(b[2]), int(b[3]), int(b[4]), int(b[5]), 0, zone)
+}
+
+// lookup finds name in the directory dir.
+func (a *isoArchive) lookup(dir isoRecord, name string) (isoRecord, bool, error) {
+	b, err := a.readExtent(dir)
+	if err != nil {
+		return isoRecord{}, false, err
+	}
+
+	for off := 0; off < len(b); {
+		r, n, err := parseISORecord(b[off:], a.rockRidge)
+		if err != nil {
+			return isoRecord{}, false, err
+		}
+
+		if n == 0 {
+			// records do not cross sectors, the rest of this one is padding
+			off = (off/isoSectorSize + 1) * isoSectorSize
+
+			continue
+		}
+
+		off += n
+
+		if r.name == name || !a.rockRidge && strings.EqualFold(r.name, name) {
+			return r, true, nil
+		}
+	}
+
+	return isoRecord{}, false, nil
+}
+
+func (a *isoArchive) Open(name string) (*File, error) {
+	r := a.root
+
+	for _, elem := range strings.Split(name, "/") {
+		if r.flags&isoFlagDir == 0 {
+			return nil, notExist(name)
+		}
+
+		next, ok, err := a.lookup(r, elem)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return nil, notExist(name)
+		}
+
+		r = next
+	}
+
+	if r.flags&isoFlagDir != 0 {
+		return nil, notExist(name)
+	}
+
+	if r.flags&isoFlagMultiExtent != 0 {
+		return nil, fmt.Errorf("error: %s spans several extents, which is not supported", name)
+	}
+
+	return newFile(name, r.size, r.modTime, io.NewSectionReader(a.f, r.extent*a.blockSize, r.size), nil), nil
+}
+
+func (a *isoArchive) Close() error {
+	return a.f.Close()
+}
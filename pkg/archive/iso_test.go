@@ -0,0 +1,215 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// isoRecordBytes encodes a directory record, nm is its Rock Ridge name and sp
+// adds the SUSP entry announcing Rock Ridge.
+func isoRecordBytes(name string, nm string, extent int, size int, dir bool, sp bool) []byte {
+	var su []byte
+	if sp {
+		su = append(su, 'S', 'P', 7, 1, 0xbe, 0xef, 0)
+	}
+
+	if nm != "" {
+		su = append(su, 'N', 'M', byte(5+len(nm)), 1, 0)
+		su = append(su, nm...)
+	}
+
+	n := isoRecordHeaderSize + len(name)
+	if n%2 == 1 {
+		n++
+	}
+
+	r := make([]byte, n, n+len(su)+1)
+	r = append(r, su...)
+
+	if len(r)%2 == 1 {
+		r = append(r, 0)
+	}
+
+	r[0] = byte(len(r))
+	binary.LittleEndian.PutUint32(r[2:], uint32(extent))
+	binary.BigEndian.PutUint32(r[6:], uint32(extent))
+	binary.LittleEndian.PutUint32(r[10:], uint32(size))
+	binary.BigEndian.PutUint32(r[14:], uint32(size))
+	copy(r[18:25], []byte{124, 6, 1, 12, 0, 0, 0})
+
+	if dir {
+		r[25] = isoFlagDir
+	}
+
+	r[32] = byte(len(name))
+	copy(r[33:], name)
+
+	return r
+}
+
+// buildISO lays out an ISO9660 image of files, one directory per sector and
+// the content of the files after them. Plain names are upper case with a
+// version suffix, the Rock Ridge names keep the original case.
+func buildISO(t *testing.T, files map[string][]byte, rockRidge bool) []byte {
+	t.Helper()
+
+	dirs := map[string][]string{"": nil}
+
+	for name := range files {
+		for p := name; p != ""; p = parentDir(p) {
+			parent := parentDir(p)
+
+			if !slices.Contains(dirs[parent], p) {
+				dirs[parent] = append(dirs[parent], p)
+			}
+
+			if p != name {
+				if _, ok := dirs[p]; !ok {
+					dirs[p] = nil
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		names = append(names, dir)
+	}
+
+	slices.Sort(names)
+
+	// sectors 16 and 17 hold the volume descriptors
+	extent := map[string]int{}
+	next := 18
+
+	for _, dir := range names {
+		extent[dir] = next
+		next++
+	}
+
+	var content []byte
+
+	fileNames := make([]string, 0, len(files))
+	for name := range files {
+		fileNames = append(fileNames, name)
+	}
+
+	slices.Sort(fileNames)
+
+	for _, name := range fileNames {
+		extent[name] = next
+		content = append(content, files[name]...)
+		content = append(content, make([]byte, (isoSectorSize-len(files[name])%isoSectorSize)%isoSectorSize)...)
+		next += (len(files[name]) + isoSectorSize - 1) / isoSectorSize
+	}
+
+	image := make([]byte, 18*isoSectorSize)
+
+	record := func(p string, sp bool) []byte {
+		_, isDir := dirs[p]
+		size := isoSectorSize
+		plain := strings.ToUpper(path.Base(p))
+
+		if !isDir {
+			size = len(files[p])
+			plain += ";1"
+
+			if !strings.Contains(plain, ".") {
+				plain = strings.Replace(plain, ";", ".;", 1)
+			}
+		}
+
+		nm := ""
+		if rockRidge {
+			nm = path.Base(p)
+		}
+
+		return isoRecordBytes(plain, nm, extent[p], size, isDir, sp)
+	}
+
+	for _, dir := range names {
+		sector := make([]byte, 0, isoSectorSize)
+		sector = append(sector, isoRecordBytes("\x00", "", extent[dir], isoSectorSize, true, rockRidge && dir == "")...)
+		sector = append(sector, isoRecordBytes("\x01", "", extent[parentDir(dir)], isoSectorSize, true, false)...)
+
+		for _, p := range dirs[dir] {
+			sector = append(sector, record(p, false)...)
+		}
+
+		image = append(image, sector...)
+		image = append(image, make([]byte, isoSectorSize-len(sector))...)
+	}
+
+	image = append(image, content...)
+
+	pvd := image[16*isoSectorSize:]
+	pvd[0] = 1
+	copy(pvd[1:6], isoMagic)
+	pvd[6] = 1
+	binary.LittleEndian.PutUint16(pvd[128:], isoSectorSize)
+	binary.BigEndian.PutUint16(pvd[130:], isoSectorSize)
+	copy(pvd[156:190], isoRecordBytes("\x00", "", extent[""], isoSectorSize, true, false))
+
+	terminator := image[17*isoSectorSize:]
+	terminator[0] = 255
+	copy(terminator[1:6], isoMagic)
+	terminator[6] = 1
+
+	return image
+}
+
+// parentDir returns the parent of a path of the image, "" is the root.
+func parentDir(p string) string {
+	if dir := path.Dir(p); dir != "." && dir != "/" {
+		return dir
+	}
+
+	return ""
+}
+
+func TestISOPlainNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "release.iso")
+	if err := os.WriteFile(path, buildISO(t, members, false), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Mount(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer a.Close()
+
+	// without Rock Ridge the names match in any case, without version
+	for _, name := range []string{"casper/vmlinuz", "CASPER/VMLINUZ", "readme.txt"} {
+		want := members[strings.ToLower(name)]
+		if got := readMember(t, a, name); !bytes.Equal(got, want) {
+			t.Fatalf("%s: got %d bytes, expected %d", name, len(got), len(want))
+		}
+	}
+}
+
+func TestISORockRidgeNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "release.iso")
+	if err := os.WriteFile(path, buildISO(t, members, true), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Mount(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer a.Close()
+
+	// Rock Ridge names are exact
+	if _, err := a.Open("CASPER/VMLINUZ"); err == nil {
+		t.Fatal("Rock Ridge names should be case sensitive")
+	}
+}
@@ -0,0 +1,183 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Mounts keeps the archives opened by previous requests mounted. An archive
+// changed on disk is mounted again, the previous mount is closed once the
+// members opened from it are closed. Archives are mounted without holding
+// the lock, concurrent requests for the same archive wait for one mount.
+type Mounts struct {
+	mu      sync.Mutex
+	mounts  map[string]*mount
+	pending map[string]*mountCall
+	closed  bool
+}
+
+// mountCall is a mount in progress, done is closed once err is set.
+type mountCall struct {
+	done    chan struct{}
+	modTime time.Time
+	size    int64
+	err     error
+}
+
+type mount struct {
+	archive Archive
+	modTime time.Time
+	size    int64
+	refs    int
+	stale   bool
+}
+
+func NewMounts() *Mounts {
+	return &Mounts{mounts: make(map[string]*mount), pending: make(map[string]*mountCall)}
+}
+
+// Open opens the member name of the archive at path.
+func (m *Mounts) Open(path string, name string) (*File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("error: %s is not a regular file: %w", path, fs.ErrNotExist)
+	}
+
+	mt, err := m.acquire(path, info)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := mt.archive.Open(name)
+	if err != nil {
+		return nil, errors.Join(err, m.release(mt))
+	}
+
+	f.release = func() error {
+		return m.release(mt)
+	}
+
+	return f, nil
+}
+
+func (m *Mounts) acquire(path string, info os.FileInfo) (*mount, error) {
+	for {
+		m.mu.Lock()
+
+		if m.closed {
+			m.mu.Unlock()
+
+			return nil, errors.New("error: archives are closed")
+		}
+
+		if mt, ok := m.mounts[path]; ok && mt.modTime.Equal(info.ModTime()) && mt.size == info.Size() {
+			mt.refs++
+			m.mu.Unlock()
+
+			return mt, nil
+		}
+
+		call, ok := m.pending[path]
+		if !ok || !call.modTime.Equal(info.ModTime()) || call.size != info.Size() {
+			break
+		}
+
+		m.mu.Unlock()
+		<-call.done
+
+		if call.err != nil {
+			return nil, call.err
+		}
+	}
+
+	call := &mountCall{done: make(chan struct{}), modTime: info.ModTime(), size: info.Size()}
+	m.pending[path] = call
+	m.mu.Unlock()
+
+	defer close(call.done)
+
+	a, err := Mount(path)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.pending[path] == call {
+		delete(m.pending, path)
+	}
+
+	if err != nil {
+		call.err = err
+
+		return nil, err
+	}
+
+	if m.closed {
+		call.err = errors.New("error: archives are closed")
+
+		return nil, errors.Join(call.err, a.Close())
+	}
+
+	if prev, ok := m.mounts[path]; ok {
+		delete(m.mounts, path)
+
+		if err := m.unmount(prev); err != nil {
+			call.err = err
+
+			return nil, errors.Join(err, a.Close())
+		}
+	}
+
+	mt := &mount{archive: a, modTime: info.ModTime(), size: info.Size(), refs: 1}
+	m.mounts[path] = mt
+
+	return mt, nil
+}
+
+func (m *Mounts) release(mt *mount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mt.refs--
+
+	if mt.stale && mt.refs == 0 {
+		return mt.archive.Close()
+	}
+
+	return nil
+}
+
+// unmount closes mt, or marks it to be closed by the last member closed.
+func (m *Mounts) unmount(mt *mount) error {
+	mt.stale = true
+
+	if mt.refs == 0 {
+		return mt.archive.Close()
+	}
+
+	return nil
+}
+
+// Close unmounts every archive.
+func (m *Mounts) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+
+	var errs []error
+
+	for path, mt := range m.mounts {
+		delete(m.mounts, path)
+		errs = append(errs, m.unmount(mt))
+	}
+
+	return errors.Join(errs...)
+}
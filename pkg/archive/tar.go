@@ -0,0 +1,134 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+type tarMember struct {
+	offset  int64
+	size    int64
+	modTime time.Time
+}
+
+// tarArchive indexes the regular files of an uncompressed tar, members are
+// read in place.
+type tarArchive struct {
+	f       *os.File
+	members map[string]tarMember
+}
+
+func openTar(f *os.File, size int64) (Archive, error) {
+	sr := io.NewSectionReader(f, 0, size)
+	tr := tar.NewReader(sr)
+	a := &tarArchive{f: f, members: make(map[string]tarMember)}
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return a, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error while reading tar header: %w", err)
+		}
+
+		if !isRegular(hdr) {
+			continue
+		}
+
+		// the reader stops right before the content of the member
+		offset, err := sr.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+
+		a.members[cleanName(hdr.Name)] = tarMember{offset: offset, size: hdr.Size, modTime: hdr.ModTime}
+	}
+}
+
+// isRegular excludes sparse files, their content is not stored contiguously.
+func isRegular(hdr *tar.Header) bool {
+	if hdr.Typeflag != tar.TypeReg {
+		return false
+	}
+
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a *tarArchive) Open(name string) (*File, error) {
+	m, ok := a.members[name]
+	if !ok {
+		return nil, notExist(name)
+	}
+
+	return newFile(name, m.size, m.modTime, io.NewSectionReader(a.f, m.offset, m.size), nil), nil
+}
+
+func (a *tarArchive) Close() error {
+	return a.f.Close()
+}
+
+// tarGzArchive can not be indexed, each open decompresses the archive up to
+// the member.
+type tarGzArchive struct {
+	f    *os.File
+	size int64
+}
+
+func openTarGz(f *os.File, size int64) (Archive, error) {
+	gz, err := gzip.NewReader(io.NewSectionReader(f, 0, size))
+	if err != nil {
+		return nil, fmt.Errorf("error while reading gzip header: %w", err)
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return &tarGzArchive{f: f, size: size}, nil
+}
+
+func (a *tarGzArchive) Open(name string) (*File, error) {
+	gz, err := gzip.NewReader(io.NewSectionReader(a.f, 0, a.size))
+	if err != nil {
+		return nil, fmt.Errorf("error while reading gzip header: %w", err)
+	}
+
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			gz.Close()
+
+			return nil, notExist(name)
+		}
+
+		if err != nil {
+			gz.Close()
+
+			return nil, fmt.Errorf("error while reading tar header: %w", err)
+		}
+
+		if isRegular(hdr) && cleanName(hdr.Name) == name {
+			return newFile(name, hdr.Size, hdr.ModTime, tr, gz), nil
+		}
+	}
+}
+
+func (a *tarGzArchive) Close() error {
+	return a.f.Close()
+}
@@ -0,0 +1,60 @@
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// zipArchive serves stored members in place and decompresses the others.
+type zipArchive struct {
+	f       *os.File
+	members map[string]*zip.File
+}
+
+func openZip(f *os.File, size int64) (Archive, error) {
+	r, err := zip.NewReader(f, size)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading zip directory: %w", err)
+	}
+
+	a := &zipArchive{f: f, members: make(map[string]*zip.File, len(r.File))}
+
+	for _, zf := range r.File {
+		if zf.Mode().IsRegular() {
+			a.members[cleanName(zf.Name)] = zf
+		}
+	}
+
+	return a, nil
+}
+
+func (a *zipArchive) Open(name string) (*File, error) {
+	zf, ok := a.members[name]
+	if !ok {
+		return nil, notExist(name)
+	}
+
+	size := int64(zf.UncompressedSize64)
+
+	if zf.Method == zip.Store {
+		offset, err := zf.DataOffset()
+		if err != nil {
+			return nil, fmt.Errorf("error while locating zip member: %w", err)
+		}
+
+		return newFile(name, size, zf.Modified, io.NewSectionReader(a.f, offset, size), nil), nil
+	}
+
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error while opening zip member: %w", err)
+	}
+
+	return newFile(name, size, zf.Modified, rc, rc), nil
+}
+
+func (a *zipArchive) Close() error {
+	return a.f.Close()
+}
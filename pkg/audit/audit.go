@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+)
+
+type Op string
+
+const (
+	OpRead  Op = "read"
+	OpWrite Op = "write"
+)
+
+// Status tells whether a transfer completed, the reason of a failure is in
+// the Error of the entry and in ErrCode when an error packet was exchanged.
+type Status string
+
+const (
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+type Entry struct {
+	Time       time.Time      `json:"time"`
+	Client     string         `json:"client"`
+	Op         Op             `json:"op"`
+	Path       string         `json:"path"`
+	Status     Status         `json:"status"`
+	Bytes      int64          `json:"bytes"`
+	Sha256     string         `json:"sha256"`
+	DurationMs int64          `json:"duration_ms"`
+	ErrCode    *types.ErrCode `json:"err_code,omitempty"`
+	ErrMsg     string         `json:"err_msg,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+type Recorder interface {
+	Record(e *Entry) error
+	Close() error
+}
+
+type Log struct {
+	mu         sync.Mutex
+	f          *os.File
+	path       string
+	size       int64
+	maxSize    int64
+	maxBackups int
+}
+
+func NewLog(path string, maxSize int64, maxBackups int) (*Log, error) {
+	l := &Log{path: path, maxSize: maxSize, maxBackups: maxBackups}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("error while opening audit log: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+
+		return fmt.Errorf("error while reading audit log size: %w", err)
+	}
+
+	l.f = f
+	l.size = info.Size()
+
+	return nil
+}
+
+// rotate starts a new log, the current one is reopened when it can not be
+// rotated so that the following entries are not lost.
+func (l *Log) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return errors.Join(fmt.Errorf("error while closing audit log: %w", err), l.open())
+	}
+
+	if err := l.shift(); err != nil {
+		return errors.Join(err, l.open())
+	}
+
+	return l.open()
+}
+
+// shift moves the closed log to the first backup and the backups to the next
+// ones, the log is removed when no backup is kept.
+func (l *Log) shift() error {
+	if l.maxBackups > 0 {
+		for i := l.maxBackups - 1; i > 0; i-- {
+			from := fmt.Sprintf("%s.%d", l.path, i)
+			if _, err := os.Stat(from); err == nil {
+				if err := os.Rename(from, fmt.Sprintf("%s.%d", l.path, i+1)); err != nil {
+					return fmt.Errorf("error while rotating audit log: %w", err)
+				}
+			}
+		}
+
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return fmt.Errorf("error while rotating audit log: %w", err)
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("error while rotating audit log: %w", err)
+	}
+
+	return nil
+}
+
+func (l *Log) Record(e *Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error while marshalling audit entry: %w", err)
+	}
+
+	b = append(b, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the entry is still written when the rotation fails, the log grows
+	// past its max size until a rotation succeeds
+	var errRotate error
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(b)) > l.maxSize {
+		errRotate = l.rotate()
+	}
+
+	n, err := l.f.Write(b)
+	l.size += int64(n)
+
+	if err != nil {
+		return errors.Join(errRotate, fmt.Errorf("error while writing audit entry: %w", err))
+	}
+
+	return errRotate
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.f.Close(); err != nil {
+		return fmt.Errorf("error while closing audit log: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+)
+
+func TestLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := NewLog(path, 300, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := types.ErrFileNotFound
+
+	for i := 0; i < 10; i++ {
+		if err := l.Record(&Entry{Client: "127.0.0.1:1234", Op: OpRead, Path: "/tmp/f", ErrCode: &code}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Size() > 300 {
+			t.Fatalf("%s exceeds max size: %d", p, info.Size())
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected at most 2 backups")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+
+		if e.ErrCode == nil || *e.ErrCode != types.ErrFileNotFound {
+			t.Fatalf("unexpected error code in %s", scanner.Text())
+		}
+	}
+}
+
+func TestLogRotationFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+
+	// the log can not be renamed over a directory
+	if err := os.MkdirAll(filepath.Join(path+".1", "busy"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewLog(path, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errs int
+
+	for range 5 {
+		if err := l.Record(&Entry{Client: "127.0.0.1:1234", Op: OpRead, Path: "/tmp/f"}); err != nil {
+			errs++
+		}
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if errs == 0 {
+		t.Fatal("expected the rotations to fail")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines int
+
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		lines++
+	}
+
+	if lines != 5 {
+		t.Fatalf("logged %d entries, expected 5", lines)
+	}
+}
@@ -0,0 +1,77 @@
+package backoff
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+const (
+	NameFixed       = "fixed"
+	NameExponential = "exponential"
+	// DefaultMax caps the waits of the exponential policy returned by Parse.
+	DefaultMax = time.Minute
+)
+
+// Policy decides how long to wait for an answer before a packet is sent
+// again.
+type Policy interface {
+	// Next returns the wait after the attempt-th transmission of a packet,
+	// attempt 0 being the first one. base is the retransmit timeout.
+	Next(base time.Duration, attempt int) time.Duration
+}
+
+// Fixed waits base after every transmission.
+type Fixed struct{}
+
+func (Fixed) Next(base time.Duration, _ int) time.Duration {
+	return base
+}
+
+// Exponential multiplies the wait by Multiplier after every transmission, up
+// to Max. Jitter randomizes each wait by up to +/- Jitter of its value so that
+// clients losing packets together do not retry in lockstep.
+type Exponential struct {
+	Multiplier float64
+	Max        time.Duration
+	Jitter     float64
+}
+
+// NewExponential returns a policy doubling the wait up to max with 10%
+// jitter.
+func NewExponential(max time.Duration) *Exponential {
+	return &Exponential{Multiplier: 2, Max: max, Jitter: 0.1}
+}
+
+func (e *Exponential) Next(base time.Duration, attempt int) time.Duration {
+	wait := float64(base)
+	for range attempt {
+		wait *= e.Multiplier
+		if e.Max > 0 && wait >= float64(e.Max) {
+			break
+		}
+	}
+
+	if e.Max > 0 {
+		wait = min(wait, float64(e.Max))
+	}
+
+	if e.Jitter > 0 {
+		wait += wait * e.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return max(time.Duration(wait), time.Millisecond)
+}
+
+// Parse returns the policy called name, an empty name is the fixed policy.
+func Parse(name string) (Policy, error) {
+	switch strings.ToLower(name) {
+	case NameFixed, "":
+		return Fixed{}, nil
+	case NameExponential:
+		return NewExponential(DefaultMax), nil
+	default:
+		return nil, fmt.Errorf("unknown backoff policy %q, expected %s or %s", name, NameFixed, NameExponential)
+	}
+}
@@ -0,0 +1,39 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponential(t *testing.T) {
+	e := &Exponential{Multiplier: 2, Max: 5 * time.Second}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempt, wait := range expected {
+		if got := e.Next(time.Second, attempt); got != wait {
+			t.Fatalf("attempt %d: waited %s, expected %s", attempt, got, wait)
+		}
+	}
+
+	e.Jitter = 0.1
+
+	for range 100 {
+		if got := e.Next(time.Second, 1); got < 1800*time.Millisecond || got > 2200*time.Millisecond {
+			t.Fatalf("jittered wait %s out of bounds", got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if p, err := Parse("fixed"); err != nil || p.Next(time.Second, 3) != time.Second {
+		t.Fatalf("unexpected fixed policy %v %v", p, err)
+	}
+
+	if _, err := Parse("exponential"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Parse("linear"); err == nil {
+		t.Fatal("expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,230 @@
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNotCacheable is returned for files larger than the budget, they have to
+// be read from disk.
+var ErrNotCacheable = errors.New("error: file does not fit in the cache")
+
+// Stats are the counters of a cache.
+type Stats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// Evictions counts the files dropped to stay within the budget,
+	// Invalidations the ones dropped because they changed on disk.
+	Evictions     int64 `json:"evictions"`
+	Invalidations int64 `json:"invalidations"`
+	Files         int   `json:"files"`
+	Bytes         int64 `json:"bytes"`
+	Budget        int64 `json:"budget"`
+}
+
+// Cache keeps the content of files in memory within a budget in bytes, the
+// least recently used files are evicted first. Every lookup checks the size
+// and modification time of the file so that changed files are read again.
+// Concurrent lookups of the same file share one copy and one read.
+type Cache struct {
+	mu     sync.Mutex
+	budget int64
+	used   int64
+	// reserved counts the bytes of the files being read, they are part of
+	// the budget before they are cached
+	reserved int64
+	entries  map[string]*list.Element
+	lru      *list.List
+	loading  map[string]*load
+	stats    Stats
+}
+
+type entry struct {
+	path    string
+	data    []byte
+	modTime time.Time
+}
+
+// load is a read in progress, waiters block on done.
+type load struct {
+	done    chan struct{}
+	modTime time.Time
+	size    int64
+	data    []byte
+	err     error
+}
+
+func New(budget int64) *Cache {
+	return &Cache{
+		budget:  budget,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		loading: make(map[string]*load),
+	}
+}
+
+// SetBudget changes the budget, files are evicted until the cache fits in it.
+func (c *Cache) SetBudget(budget int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.budget = budget
+	c.evict()
+}
+
+// Get returns the content of path. The slice is shared between callers and
+// must not be modified, it stays valid after the file is evicted.
+func (c *Cache) Get(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("error: %s is not a regular file", path)
+	}
+
+	c.mu.Lock()
+
+	if info.Size() > c.budget {
+		c.mu.Unlock()
+
+		return nil, ErrNotCacheable
+	}
+
+	if el, ok := c.entries[path]; ok {
+		e := el.Value.(*entry)
+
+		if e.modTime.Equal(info.ModTime()) && int64(len(e.data)) == info.Size() {
+			c.stats.Hits++
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+
+			return e.data, nil
+		}
+
+		c.stats.Invalidations++
+		c.remove(el)
+	}
+
+	if l, ok := c.loading[path]; ok && l.modTime.Equal(info.ModTime()) && l.size == info.Size() {
+		c.stats.Hits++
+		c.mu.Unlock()
+
+		<-l.done
+
+		return l.data, l.err
+	}
+
+	// the file is read from disk when the reads in progress leave no room
+	// for it, the budget bounds the memory of the loads too
+	if !c.reserve(info.Size()) {
+		c.mu.Unlock()
+
+		return nil, ErrNotCacheable
+	}
+
+	l := &load{done: make(chan struct{}), modTime: info.ModTime(), size: info.Size()}
+	c.loading[path] = l
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	l.data, l.err = read(path, info)
+
+	c.mu.Lock()
+	c.reserved -= l.size
+
+	if c.loading[path] == l {
+		delete(c.loading, path)
+	}
+
+	if l.err == nil && int64(len(l.data)) <= c.budget {
+		c.insert(&entry{path: path, data: l.data, modTime: l.modTime})
+	}
+	c.mu.Unlock()
+
+	close(l.done)
+
+	return l.data, l.err
+}
+
+// read reads path and fails when it changed meanwhile, a file being written
+// must not be cached half way.
+func read(path string, info os.FileInfo) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) != info.Size() || !after.ModTime().Equal(info.ModTime()) || after.Size() != info.Size() {
+		return nil, fmt.Errorf("error: %s changed while being read", path)
+	}
+
+	return data, nil
+}
+
+func (c *Cache) insert(e *entry) {
+	if el, ok := c.entries[e.path]; ok {
+		c.remove(el)
+	}
+
+	c.entries[e.path] = c.lru.PushFront(e)
+	c.used += int64(len(e.data))
+	c.evict()
+}
+
+func (c *Cache) evict() {
+	c.evictFor(0)
+}
+
+// evictFor evicts files until size more bytes fit in the budget or the cache
+// is empty.
+func (c *Cache) evictFor(size int64) {
+	for c.used+c.reserved+size > c.budget && c.lru.Len() > 0 {
+		c.stats.Evictions++
+		c.remove(c.lru.Back())
+	}
+}
+
+// reserve makes room for a file of size bytes about to be read, it fails when
+// the reads in progress take the rest of the budget.
+func (c *Cache) reserve(size int64) bool {
+	if c.reserved+size > c.budget {
+		return false
+	}
+
+	c.evictFor(size)
+	c.reserved += size
+
+	return true
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := el.Value.(*entry)
+
+	c.lru.Remove(el)
+	delete(c.entries, e.path)
+	c.used -= int64(len(e.data))
+}
+
+// Stats returns a snapshot of the counters.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stats
+	s.Files = c.lru.Len()
+	s.Bytes = c.used
+	s.Budget = c.budget
+
+	return s
+}
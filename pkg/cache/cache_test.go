@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, dir string, name string, size int) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, bytes.Repeat([]byte(name[:1]), size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestHitsAndMisses(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "a", 100)
+	c := New(1000)
+
+	for range 3 {
+		data, err := c.Get(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(data) != 100 {
+			t.Fatalf("got %d bytes, expected 100", len(data))
+		}
+	}
+
+	if s := c.Stats(); s.Hits != 2 || s.Misses != 1 || s.Files != 1 || s.Bytes != 100 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	if _, err := c.Get(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Fatalf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "a", 100)
+	c := New(1000)
+
+	if _, err := c.Get(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("new content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// same size, only the modification time tells the change
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := c.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "new content" {
+		t.Fatalf("got stale content %q", data)
+	}
+
+	if s := c.Stats(); s.Invalidations != 1 || s.Misses != 2 || s.Bytes != int64(len(data)) {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a", 400)
+	b := writeFile(t, dir, "b", 400)
+	d := writeFile(t, dir, "d", 400)
+	c := New(1000)
+
+	for _, path := range []string{a, b, a, d} {
+		if _, err := c.Get(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// b was the least recently used one
+	if s := c.Stats(); s.Evictions != 1 || s.Files != 2 || s.Bytes != 800 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	if _, err := c.Get(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := c.Stats(); s.Hits != 2 {
+		t.Fatalf("a should still be cached, stats %+v", s)
+	}
+
+	c.SetBudget(500)
+
+	if s := c.Stats(); s.Files != 1 || s.Bytes != 400 {
+		t.Fatalf("unexpected stats after shrinking the budget %+v", s)
+	}
+
+	if _, err := c.Get(writeFile(t, dir, "large", 501)); !errors.Is(err, ErrNotCacheable) {
+		t.Fatalf("expected ErrNotCacheable, got %v", err)
+	}
+}
+
+func TestSharedCopy(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "a", 1<<20)
+	c := New(2 << 20)
+
+	var wg sync.WaitGroup
+
+	results := make([][]byte, 50)
+
+	for i := range results {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			data, err := c.Get(path)
+			if err != nil {
+				t.Error(err)
+			}
+
+			results[i] = data
+		}()
+	}
+
+	wg.Wait()
+
+	for _, data := range results {
+		if len(data) != 1<<20 || &data[0] != &results[0][0] {
+			t.Fatal("transfers do not share one copy of the file")
+		}
+	}
+
+	if s := c.Stats(); s.Misses != 1 || s.Hits != 49 {
+		t.Fatalf("file read more than once, stats %+v", s)
+	}
+}
+
+func TestLoadsWithinBudget(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a", 400)
+	b := writeFile(t, dir, "b", 400)
+	c := New(1000)
+
+	if _, err := c.Get(a); err != nil {
+		t.Fatal(err)
+	}
+
+	// a read of 500 bytes in progress takes its share of the budget, a is
+	// evicted to make room for b
+	c.reserved = 500
+
+	if _, err := c.Get(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := c.Stats(); s.Evictions != 1 || s.Files != 1 || s.Bytes != 400 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	// evicting b would not make room for d, it is read from disk and b stays
+	if _, err := c.Get(writeFile(t, dir, "d", 600)); !errors.Is(err, ErrNotCacheable) {
+		t.Fatalf("expected ErrNotCacheable, got %v", err)
+	}
+
+	if s := c.Stats(); s.Files != 1 {
+		t.Fatalf("b was evicted, stats %+v", s)
+	}
+
+	if c.reserved != 500 {
+		t.Fatalf("%d bytes reserved after the loads, expected 500", c.reserved)
+	}
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/server"
+)
+
+const DefaultParallelism = 4
+
+// Job is a single transfer of a batch, Op is either get or put.
+type Job struct {
+	Op     string
+	Remote string
+	Local  string
+}
+
+type Report struct {
+	Results   []*Result `json:"results"`
+	Succeeded int       `json:"succeeded"`
+	Failed    int       `json:"failed"`
+}
+
+type Batch struct {
+	c           Connector
+	server      string
+	parallelism int
+}
+
+// NewBatch returns a batch running at most parallelism transfers at once
+// through c, server is only used in the report.
+func NewBatch(c Connector, server string, parallelism int) *Batch {
+	return &Batch{c: c, server: server, parallelism: max(parallelism, 1)}
+}
+
+// Run executes the jobs and reports their results in the order of jobs.
+func (b *Batch) Run(jobs []Job) *Report {
+	results := make([]*Result, len(jobs))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for range min(b.parallelism, len(jobs)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				results[i] = b.run(jobs[i])
+			}
+		}()
+	}
+
+	for i := range jobs {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	report := &Report{Results: results}
+
+	for _, res := range results {
+		if res.Error != "" {
+			report.Failed++
+		} else {
+			report.Succeeded++
+		}
+	}
+
+	return report
+}
+
+func (b *Batch) run(job Job) *Result {
+	res := &Result{Op: job.Op, Server: b.server, Remote: job.Remote, Local: job.Local}
+	start := time.Now()
+
+	var (
+		stats *server.Stats
+		err   error
+	)
+
+	if job.Op == "get" {
+		stats, err = b.c.Download(job.Remote, job.Local)
+	} else {
+		stats, err = b.c.Upload(job.Local, job.Remote)
+	}
+
+	res.set(stats, err)
+	res.DurationMs = time.Since(start).Milliseconds()
+
+	return res
+}
+
+// ExitCode is the exit code of the first failed transfer.
+func (r *Report) ExitCode() int {
+	for _, res := range r.Results {
+		if res.ExitCode != ExitOK {
+			return res.ExitCode
+		}
+	}
+
+	return ExitOK
+}
+
+// Print writes one line per transfer followed by the totals, successful
+// transfers are left out when failedOnly is set.
+func (r *Report) Print(w io.Writer, failedOnly bool) {
+	for _, res := range r.Results {
+		name := res.Remote
+		if res.Op == "put" {
+			name = res.Local
+		}
+
+		switch {
+		case res.Error != "":
+			fmt.Fprintf(w, "%s %s: %s\n", res.Op, name, strings.TrimPrefix(res.Error, "error: "))
+		case !failedOnly:
+			fmt.Fprintf(w, "%s %s: %d bytes in %dms\n", res.Op, name, res.Bytes, res.DurationMs)
+		}
+	}
+
+	fmt.Fprintf(w, "%d transfers, %d succeeded, %d failed\n", len(r.Results), r.Succeeded, r.Failed)
+}
+
+// ParseManifest reads one transfer per line using the syntax of the get and
+// put commands. Empty lines and lines starting with # are skipped.
+func ParseManifest(r io.Reader) ([]Job, error) {
+	var jobs []Job
+
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if len(fields) < 2 || len(fields) > 3 || (fields[0] != "get" && fields[0] != "put") {
+			return nil, fmt.Errorf("line %d: expected get <remote> [local] or put <local> [remote]", line)
+		}
+
+		job := Job{Op: fields[0]}
+
+		var other string
+		if len(fields) == 3 {
+			other = fields[2]
+		}
+
+		if job.Op == "get" {
+			job.Remote, job.Local = fields[1], other
+		} else {
+			job.Local, job.Remote = fields[1], other
+		}
+
+		if job.Local == "-" {
+			return nil, fmt.Errorf("line %d: stdin and stdout can not be used in a batch", line)
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading manifest: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// GetJobs downloads every remote file next to the others in the current
+// directory.
+func GetJobs(remotes []string) []Job {
+	jobs := make([]Job, 0, len(remotes))
+	for _, remote := range remotes {
+		jobs = append(jobs, Job{Op: "get", Remote: remote})
+	}
+
+	return jobs
+}
+
+// PutJobs expands the local glob patterns, every matching file is uploaded
+// under its base name.
+func PutJobs(patterns []string) ([]Job, error) {
+	var jobs []Job
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no local file matches %s", pattern)
+		}
+
+		for _, match := range matches {
+			jobs = append(jobs, Job{Op: "put", Local: match})
+		}
+	}
+
+	return jobs, nil
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Wa4h1h/go-tftp/pkg/server"
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+)
+
+type batchConnector struct {
+	Connector
+	mu      sync.Mutex
+	running int
+	peak    int
+}
+
+func (b *batchConnector) Download(remote string, _ string) (*server.Stats, error) {
+	b.mu.Lock()
+	b.running++
+	b.peak = max(b.peak, b.running)
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.running--
+		b.mu.Unlock()
+	}()
+
+	if remote == "missing" {
+		return nil, &types.TFTPError{Code: types.ErrFileNotFound, Msg: "missing not found"}
+	}
+
+	return &server.Stats{Bytes: 1024, Blocks: 3}, nil
+}
+
+func TestBatch(t *testing.T) {
+	manifest := `# boot files
+get vmlinuz
+get initrd.img /tmp/initrd.img
+
+get missing
+get dtbs/a.dtb
+get dtbs/b.dtb
+`
+
+	jobs, err := ParseManifest(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs) != 5 || jobs[1].Local != "/tmp/initrd.img" {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+
+	c := &batchConnector{}
+	report := NewBatch(c, "", 2).Run(jobs)
+
+	if report.Succeeded != 4 || report.Failed != 1 || report.Results[2].Remote != "missing" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if c.peak > 2 {
+		t.Fatalf("%d transfers ran at once, expected at most 2", c.peak)
+	}
+
+	if code := report.ExitCode(); code != ExitRemote+int(types.ErrFileNotFound) {
+		t.Fatalf("got exit code %d", code)
+	}
+
+	if _, err := ParseManifest(strings.NewReader("get a\nfetch b\n")); err == nil || !strings.HasPrefix(err.Error(), "line 2") {
+		t.Fatalf("expected an error on line 2, got %v", err)
+	}
+}
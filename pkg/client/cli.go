@@ -1,45 +1,55 @@
 package client
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 
+	"github.com/Wa4h1h/go-tftp/pkg/lineedit"
 	"go.uber.org/zap"
 )
 
+const historyFile = ".tftp_history"
+
 type Cli struct {
-	l          *zap.SugaredLogger
-	tftpClient Connector
+	l           *zap.SugaredLogger
+	tftpClient  Connector
+	parallelism int
 }
 
-func NewCli(l *zap.SugaredLogger, tftpClient Connector) *Cli {
-	return &Cli{l: l, tftpClient: tftpClient}
+func NewCli(l *zap.SugaredLogger, tftpClient Connector, parallelism int) *Cli {
+	return &Cli{l: l, tftpClient: tftpClient, parallelism: parallelism}
 }
 
 func (c *Cli) Read() {
-	scanner := bufio.NewScanner(os.Stdin)
 	evaluator := NewEvaluator(c.l, c.tftpClient)
-	done := false
+	evaluator.parallelism = c.parallelism
+
+	var history string
+	if home, err := os.UserHomeDir(); err == nil {
+		history = filepath.Join(home, historyFile)
+	}
 
-	var err error
+	editor := lineedit.New(history, evaluator.Complete)
+	done := false
 
 	for !done {
-		fmt.Print("tftp> ")
+		line, err := editor.ReadLine("tftp> ")
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				fmt.Printf("%s\n", err.Error())
+			}
 
-		if !scanner.Scan() {
 			break
 		}
 
-		evaluator.line = scanner.Text()
+		evaluator.line = line
 
 		done, err = evaluator.evaluate()
 		if err != nil {
 			fmt.Printf("%s\n", err.Error())
 		}
 	}
-
-	if err := scanner.Err(); err != nil {
-		panic(err)
-	}
 }
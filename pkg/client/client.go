@@ -4,41 +4,108 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/Wa4h1h/go-tftp/pkg/backoff"
+	"github.com/Wa4h1h/go-tftp/pkg/progress"
 	"github.com/Wa4h1h/go-tftp/pkg/server"
 	"github.com/Wa4h1h/go-tftp/pkg/types"
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
 	"go.uber.org/zap"
 )
 
-type Op uint16
-
-const (
-	get Op = iota
-	put
-)
-
 type Connector interface {
 	Connect(addr string) error
 	SetTrace()
+	SetOverwrite()
+	SetResume()
+	SetProgress()
+	SetVerbose()
+	SetTransferSize()
 	SetTimeout(timeout uint)
-	execute(filename string, op Op) error
-	Get(filename string) error
-	Put(filename string) error
+	SetRexmt(rexmt uint)
+	SetBackoff(name string) error
+	SetBlockSize(size int) error
+	SetWindowSize(size int) error
+	SetMode(mode string) error
+	Settings() Settings
+	SetOutput(w io.Writer)
+	Stats() *server.Stats
+	Download(remote string, local string) (*server.Stats, error)
+	Upload(local string, remote string) (*server.Stats, error)
+	GetFile(remote string, local string) error
+	PutFile(local string, remote string) error
 }
 
 type Client struct {
 	remoteAddr *net.UDPAddr
 	l          *zap.SugaredLogger
+	out        io.Writer
+	stats      *server.Stats
+	mu         sync.Mutex
+	mode       string
 	timeout    time.Duration
+	rexmt      time.Duration
+	blockSize  int
+	windowSize int
 	numTries   uint
-	trace      bool
+	// requestRetries is the number of times an unanswered request is sent
+	// again from a new port
+	requestRetries uint
+	backoff        string
+	minRTO         time.Duration
+	maxRTO         time.Duration
+	trace          bool
+	overwrite      bool
+	resumable      bool
+	tsize          bool
+	verbose        bool
+	// showProgress renders a progress bar on stderr for GetFile and PutFile
+	showProgress bool
+	// wrapConn decorates the socket of each transfer, tests use it to
+	// simulate an impaired network
+	wrapConn func(conn net.Conn) net.Conn
+}
+
+// Settings is the configuration of a client as shown by the status command.
+type Settings struct {
+	Server         string
+	Mode           string
+	Timeout        time.Duration
+	Rexmt          time.Duration
+	Retries        uint
+	RequestRetries uint
+	Backoff        string
+	BlockSize      int
+	WindowSize     int
+	TransferSize   bool
+	Verbose        bool
+	Trace          bool
+	Overwrite      bool
+	Resume         bool
+	Progress       bool
 }
 
-func NewClient(l *zap.SugaredLogger, numTries uint) Connector {
-	c := &Client{l: l, numTries: numTries}
+// NewClient returns a client sending numTries times each packet before giving
+// up, a nil logger disables logging.
+func NewClient(l *zap.SugaredLogger, numTries uint) *Client {
+	if l == nil {
+		l = zap.NewNop().Sugar()
+	}
+
+	c := &Client{
+		l: l, numTries: numTries, mode: types.DefaultMode, out: os.Stdout,
+		backoff: backoff.NameFixed, minRTO: server.DefaultMinRTO,
+	}
 	c.timeout = time.Duration(types.DefaultClientTimeout) * time.Second
+	c.rexmt = time.Duration(types.DefaultRexmt) * time.Second
 
 	return c
 }
@@ -47,134 +114,680 @@ func (c *Client) SetTrace() {
 	c.trace = !c.trace
 }
 
+func (c *Client) SetOverwrite() {
+	c.overwrite = !c.overwrite
+}
+
+// SetTimeout sets the total deadline of GetFile, PutFile, Download and Upload
+// transfers, 0 disables it.
 func (c *Client) SetTimeout(timeout uint) {
 	c.timeout = time.Duration(timeout) * time.Second
 }
 
-func (c *Client) execute(filename string, op Op) error {
-	var err error
+// SetRequestRetries sets how many times a request left unanswered after all
+// its tries is sent again from a new port.
+func (c *Client) SetRequestRetries(retries uint) {
+	c.requestRetries = retries
+}
+
+// SetBackoff selects the backoff policy, fixed or exponential, spacing
+// retransmissions and request retries.
+func (c *Client) SetBackoff(name string) error {
+	if _, err := backoff.Parse(name); err != nil {
+		return fmt.Errorf("%w: %w", utils.ErrInvalidOption, err)
+	}
 
-	done := make(chan error)
+	c.backoff = strings.ToLower(name)
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-	defer cancel()
+	return nil
+}
+
+// SetConnWrapper wraps the socket of each following transfer.
+func (c *Client) SetConnWrapper(wrap func(conn net.Conn) net.Conn) {
+	c.wrapConn = wrap
+}
+
+// SetRTO bounds the adaptive retransmission timeout, see WithRTO.
+func (c *Client) SetRTO(minRTO time.Duration, maxRTO time.Duration) {
+	c.minRTO = minRTO
+	c.maxRTO = maxRTO
+}
+
+// transferContext returns the context of a transfer bounded by the total deadline.
+func (c *Client) transferContext() (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+// SetRexmt sets the time waited for an answer before a packet is sent again.
+func (c *Client) SetRexmt(rexmt uint) {
+	c.rexmt = time.Duration(rexmt) * time.Second
+}
+
+// SetBlockSize sets the blksize requested by the following transfers, 0
+// disables the option.
+func (c *Client) SetBlockSize(size int) error {
+	if size != 0 && (size < types.MinBlockSize || size > types.MaxBlockSize) {
+		return fmt.Errorf("%w: blksize %d not in [%d, %d]", utils.ErrInvalidOption,
+			size, types.MinBlockSize, types.MaxBlockSize)
+	}
+
+	c.blockSize = size
+
+	return nil
+}
 
-	go func(d chan<- error, file string) {
-		conn, errListen := net.DialUDP("udp", nil, c.remoteAddr)
-		if errListen != nil {
-			d <- fmt.Errorf("error while creating udp listener: %w", errListen)
+// SetWindowSize sets the windowsize requested by the following transfers, 0
+// disables the option.
+func (c *Client) SetWindowSize(size int) error {
+	if size < 0 || size > types.MaxWindowSize {
+		return fmt.Errorf("%w: windowsize %d not in [1, %d]", utils.ErrInvalidOption, size, types.MaxWindowSize)
+	}
+
+	c.windowSize = size
+
+	return nil
+}
+
+func (c *Client) SetTransferSize() {
+	c.tsize = !c.tsize
+}
+
+func (c *Client) SetVerbose() {
+	c.verbose = !c.verbose
+}
+
+func (c *Client) Settings() Settings {
+	s := Settings{
+		Mode:           c.mode,
+		Timeout:        c.timeout,
+		Rexmt:          c.rexmt,
+		Retries:        c.numTries,
+		RequestRetries: c.requestRetries,
+		Backoff:        c.backoff,
+		BlockSize:      c.blockSize,
+		WindowSize:     c.windowSize,
+		TransferSize:   c.tsize,
+		Verbose:        c.verbose,
+		Trace:          c.trace,
+		Overwrite:      c.overwrite,
+		Resume:         c.resumable,
+		Progress:       c.showProgress,
+	}
+
+	if c.remoteAddr != nil {
+		s.Server = c.remoteAddr.String()
+	}
+
+	return s
+}
+
+func (c *Client) SetMode(mode string) error {
+	mode = strings.ToLower(mode)
 
-			return
+	if mode != types.ModeOctet && mode != types.ModeNetascii {
+		return utils.ErrUnsupportedMode
+	}
+
+	c.mode = mode
+
+	return nil
+}
+
+func (c *Client) SetOutput(w io.Writer) {
+	c.out = w
+}
+
+// Stats returns the statistics of the last finished transfer.
+func (c *Client) Stats() *server.Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+func (c *Client) setStats(stats *server.Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats = stats
+}
+
+func (c *Client) Connect(addr string) error {
+	remoteAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return fmt.Errorf("error while listening %s: %w", addr, err)
+	}
+
+	c.remoteAddr = remoteAddr
+
+	return nil
+}
+
+type session struct {
+	ctx    context.Context
+	t      server.Transfer
+	conn   net.Conn
+	stop   func() bool
+	start  time.Time
+	offset int64
+}
+
+func (s *session) close() {
+	s.stop()
+	s.conn.Close()
+}
+
+// open sends the request for remote and negotiates its options, the returned
+// session is ready to send or receive the file. Requests left unanswered are
+// sent again from a new port up to o.requestRetries times.
+func (c *Client) open(ctx context.Context, op types.OpCode, remote string,
+	size int64, o *transferOptions,
+) (*session, error) {
+	if c.remoteAddr == nil {
+		return nil, utils.ErrNotConnected
+	}
+
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		s, err := c.dial(ctx, op, remote, size, o)
+		if err == nil || attempt >= o.requestRetries || !errors.Is(err, utils.ErrPacketCanNotBeSent) {
+			return s, err
 		}
 
-		defer func(c *net.UDPConn) {
-			conn.Close()
-		}(conn)
+		wait := o.backoff.Next(o.timeout, attempt)
+		c.l.Warnf("no answer to request for %s, retrying in %s", remote, wait)
 
-		req := &types.Request{
-			Filename: file,
-			Mode:     types.DefaultMode,
+		select {
+		case <-ctx.Done():
+			return nil, contextError(ctx, err)
+		case <-time.After(wait):
 		}
+	}
+}
+
+// dial makes a single attempt at opening a session.
+func (c *Client) dial(ctx context.Context, op types.OpCode, remote string,
+	size int64, o *transferOptions,
+) (*session, error) {
+	peer, err := dialPeer(c.remoteAddr)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating udp listener: %w", err)
+	}
+
+	var conn net.Conn = peer
+	if c.wrapConn != nil {
+		conn = c.wrapConn(conn)
+	}
 
-		if op == get {
-			req.Opcode = types.OpCodeRRQ
-		} else {
-			req.Opcode = types.OpCodeWRQ
+	s := &session{
+		ctx:   ctx,
+		conn:  conn,
+		t:     server.NewTransfer(conn, c.l, o.timeout, o.timeout, o.retries, c.trace),
+		stop:  context.AfterFunc(ctx, func() { conn.Close() }),
+		start: time.Now(),
+	}
+
+	s.t.SetProgress(o.progress)
+	s.t.SetBackoff(o.backoff)
+	s.t.SetRTO(o.minRTO, o.maxRTO)
+
+	if err := s.t.SetMode(o.mode); err != nil {
+		s.close()
+
+		return nil, err
+	}
+
+	oack, err := s.t.Request(o.request(op, remote, size))
+	if err != nil {
+		return nil, c.finish(s, err)
+	}
+
+	if oack == nil {
+		return s, nil
+	}
+
+	accepted, err := o.accept(oack)
+	if err != nil {
+		errPacket := &types.Error{
+			Opcode:    types.OpCodeError,
+			ErrorCode: types.ErrOptionNegotiation,
+			ErrMsg:    err.Error(),
 		}
+		if errSend := s.t.SendError(errPacket); errSend != nil {
+			c.l.Errorf("error while rejecting options: %s", errSend.Error())
+		}
+
+		s.close()
+
+		return nil, err
+	}
 
-		b, errM := req.MarshalBinary()
-		if errM != nil {
-			d <- fmt.Errorf("error while marshalling request: %w", errM)
+	s.t.SetOptions(accepted)
+	s.offset = accepted.Offset
 
-			return
+	if op == types.OpCodeRRQ {
+		if err := s.t.SendAck(0); err != nil {
+			return nil, c.finish(s, err)
 		}
+	}
+
+	return s, nil
+}
+
+// finish closes the session and turns err into the error returned to callers.
+func (c *Client) finish(s *session, err error) error {
+	s.close()
 
-		if _, err := conn.Write(b); err != nil {
-			d <- fmt.Errorf("error while writing request: %w", err)
+	stats := s.t.Stats()
+	stats.Duration = time.Since(s.start)
+	c.setStats(stats)
 
-			return
+	return contextError(s.ctx, err)
+}
+
+// contextError returns the cause of err when ctx is done, a deadline is
+// reported as ErrRequestTimeout.
+func contextError(ctx context.Context, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w: %w", utils.ErrRequestTimeout, ctx.Err())
 		}
 
-		t := server.NewTransfer(conn, c.l, c.timeout, c.timeout, int(c.numTries), c.trace)
+		return ctx.Err()
+	default:
+		return err
+	}
+}
+
+// Reader streams the content of a download.
+type Reader struct {
+	*io.PipeReader
+	stats *server.Stats
+	size  int64
+}
+
+// Size returns the size announced by the server with the tsize option, -1
+// when it is unknown.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// Stats returns the statistics of the download once Read returned io.EOF or
+// an error, nil before.
+func (r *Reader) Stats() *server.Stats {
+	return r.stats
+}
+
+// Get requests remote and returns a reader streaming its content. Closing the
+// reader before EOF aborts the transfer.
+func (c *Client) Get(ctx context.Context, remote string, opts ...Option) (*Reader, error) {
+	pr, pw := io.Pipe()
+	r := &Reader{PipeReader: pr}
+	opened := make(chan error, 1)
 
-		switch op {
-		case get:
-			if err := t.Receive(file); err != nil {
-				d <- fmt.Errorf("error while receiving file %s: %w", file, err)
+	go func() {
+		stats, err := c.receive(ctx, remote, opts, func(o *transferOptions, offset int64, size int64) (io.Writer, error) {
+			r.size = size
+			opened <- nil
+
+			if offset < o.offset {
+				return &skipWriter{w: pw, skip: o.offset - offset}, nil
 			}
-		case put:
-			{
-				if !checkFileExist(file) {
-					d <- fmt.Errorf("%s does not exist", file)
 
-					return
-				}
+			return pw, nil
+		})
+
+		r.stats = stats
+		pw.CloseWithError(err)
+		opened <- err
+	}()
 
-				buff := make([]byte, types.DatagramSize)
+	if err := <-opened; err != nil {
+		return nil, err
+	}
 
-				if _, err := conn.Read(buff); err != nil {
-					d <- fmt.Errorf("error while reading ack: %w", err)
+	return r, nil
+}
 
-					return
-				}
+// WriteTo downloads remote into w and returns the number of bytes written.
+func (c *Client) WriteTo(ctx context.Context, remote string, w io.Writer, opts ...Option) (int64, error) {
+	stats, err := c.writeTo(ctx, remote, w, opts)
+	if stats == nil {
+		return 0, err
+	}
+
+	return stats.Bytes, err
+}
 
-				var ack types.Ack
-				var errPacket types.Error
+func (c *Client) writeTo(ctx context.Context, remote string, w io.Writer, opts []Option) (*server.Stats, error) {
+	return c.receive(ctx, remote, opts, func(o *transferOptions, offset int64, _ int64) (io.Writer, error) {
+		if offset < o.offset {
+			return &skipWriter{w: w, skip: o.offset - offset}, nil
+		}
 
-				switch {
-				case ack.UnmarshalBinary(buff) == nil:
-					{
-						if ack.BlockNum != 0 {
-							d <- fmt.Errorf("expected BlockNum=0 but got %d", ack.BlockNum)
+		return w, nil
+	})
+}
 
-							return
-						}
-					}
-				case errPacket.UnmarshalBinary(buff) == nil:
-					{
-						fmt.Println(errPacket.ErrMsg)
+// receive downloads remote into the writer returned by dst, which is called
+// once the options are negotiated with the offset the server starts at and
+// the size of the file (-1 when unknown).
+func (c *Client) receive(ctx context.Context, remote string, opts []Option,
+	dst func(o *transferOptions, offset int64, size int64) (io.Writer, error),
+) (*server.Stats, error) {
+	o := c.transferOptions(opts)
 
-						return
-					}
-				}
+	s, err := c.open(ctx, types.OpCodeRRQ, remote, -1, o)
+	if err != nil {
+		return nil, err
+	}
 
-				if err = t.Send(file); err != nil {
-					d <- fmt.Errorf("error while sending file %s: %w", file, err)
-				}
-			}
+	w, err := dst(o, s.offset, s.t.Stats().Size)
+	if err != nil {
+		errPacket := &types.Error{
+			Opcode:    types.OpCodeError,
+			ErrorCode: types.ErrNotDefined,
+			ErrMsg:    "transfer aborted by the client",
 		}
+		if errSend := s.t.SendError(errPacket); errSend != nil {
+			c.l.Errorf("error while aborting transfer: %s", errSend.Error())
+		}
+
+		return s.t.Stats(), c.finish(s, err)
+	}
+
+	err = c.finish(s, s.t.ReceiveTo(w))
+
+	return s.t.Stats(), err
+}
+
+// Put uploads r to remote and returns the statistics of the transfer. A non
+// negative size is announced to the server with the tsize option.
+func (c *Client) Put(ctx context.Context, remote string, r io.Reader, size int64,
+	opts ...Option,
+) (*server.Stats, error) {
+	return c.readFrom(ctx, remote, r, size, opts)
+}
+
+// ReadFrom uploads everything read from r to remote and returns the number of
+// bytes sent.
+func (c *Client) ReadFrom(ctx context.Context, remote string, r io.Reader, opts ...Option) (int64, error) {
+	stats, err := c.readFrom(ctx, remote, r, -1, opts)
+	if stats == nil {
+		return 0, err
+	}
+
+	return stats.Bytes, err
+}
+
+func (c *Client) readFrom(ctx context.Context, remote string, r io.Reader,
+	size int64, opts []Option,
+) (*server.Stats, error) {
+	s, err := c.openWrite(ctx, remote, size, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.finish(s, s.t.SendFrom(r))
+
+	return s.t.Stats(), err
+}
+
+func (c *Client) openWrite(ctx context.Context, remote string, size int64, opts []Option) (*session, error) {
+	s, err := c.open(ctx, types.OpCodeWRQ, remote, size, c.transferOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	if s.t.Stats().Size < 0 {
+		// the server did not acknowledge tsize, the size is still known
+		s.t.SetOptions(&server.TransferOptions{Size: size})
+	}
+
+	return s, nil
+}
+
+// Writer streams the content of an upload.
+type Writer struct {
+	*io.PipeWriter
+	done  chan struct{}
+	stats *server.Stats
+	err   error
+}
+
+// Close ends the upload and waits for the server to acknowledge it.
+func (w *Writer) Close() error {
+	return w.CloseWithError(nil)
+}
+
+// CloseWithError aborts the upload with err, nil ends it like Close. It
+// returns once the transfer is over.
+func (w *Writer) CloseWithError(err error) error {
+	w.PipeWriter.CloseWithError(err)
+	<-w.done
 
-		close(d)
-	}(done, filename)
+	return w.err
+}
 
+// Stats returns the statistics of the upload once it is closed, nil before.
+func (w *Writer) Stats() *server.Stats {
 	select {
-	case <-ctx.Done():
-		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-			err = errors.New(fmt.Sprintf("request exceeded timeout %ds", int(c.timeout.Seconds())))
-		} else {
-			err = ctx.Err()
+	case <-w.done:
+		return w.stats
+	default:
+		return nil
+	}
+}
+
+// Create requests to write remote and returns a writer streaming its content
+// once the server accepted the request. A non negative size is announced
+// with the tsize option.
+func (c *Client) Create(ctx context.Context, remote string, size int64, opts ...Option) (*Writer, error) {
+	s, err := c.openWrite(ctx, remote, size, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	w := &Writer{PipeWriter: pw, done: make(chan struct{})}
+
+	go func() {
+		defer close(w.done)
+
+		w.err = c.finish(s, s.t.SendFrom(pr))
+		w.stats = s.t.Stats()
+		// writes after a failed transfer return its error
+		pr.CloseWithError(w.err)
+	}()
+
+	return w, nil
+}
+
+// summary returns where the transfer summary is printed, it must not end up
+// in the file content streamed to stdout.
+func (c *Client) summary(local string) io.Writer {
+	if local == "-" && c.out == io.Writer(os.Stdout) {
+		return os.Stderr
+	}
+
+	return c.out
+}
+
+// Download fetches remote into the local file, named after remote when empty.
+func (c *Client) Download(remote string, local string) (*server.Stats, error) {
+	return c.download(remote, local, nil)
+}
+
+func (c *Client) download(remote string, local string, opts []Option) (*server.Stats, error) {
+	if local == "" {
+		local = path.Base(remote)
+	}
+
+	if c.canResume(local) {
+		if !c.overwrite && checkFileExist(local) {
+			return nil, fmt.Errorf("%w: %s", utils.ErrFileExists, local)
+		}
+
+		stats, err := c.resume(remote, local, opts)
+		if err != nil {
+			return stats, fmt.Errorf("error while receiving file %s: %w", remote, err)
 		}
-	case err = <-done:
+
+		return stats, nil
 	}
 
-	return err
+	dst, done, err := openDestination(local, c.overwrite)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.transferContext()
+	defer cancel()
+
+	stats, err := c.writeTo(ctx, remote, dst, opts)
+	if errDone := done(err == nil); errDone != nil && err == nil {
+		err = errDone
+	}
+
+	if err != nil {
+		return stats, fmt.Errorf("error while receiving file %s: %w", remote, err)
+	}
+
+	return stats, nil
 }
 
-func (c *Client) Connect(addr string) error {
-	remoteAddr, err := net.ResolveUDPAddr("udp", addr)
+// Upload sends the local file to remote, named after local when empty.
+func (c *Client) Upload(local string, remote string) (*server.Stats, error) {
+	return c.upload(local, remote, nil)
+}
+
+func (c *Client) upload(local string, remote string, opts []Option) (*server.Stats, error) {
+	if remote == "" {
+		if local == "-" {
+			return nil, utils.ErrRemoteNameRequired
+		}
+
+		remote = filepath.Base(local)
+	}
+
+	src, err := openSource(local)
 	if err != nil {
-		return fmt.Errorf("error while listening %s: %w", addr, err)
+		return nil, err
 	}
 
-	c.remoteAddr = remoteAddr
+	defer func() {
+		if err := src.Close(); err != nil {
+			c.l.Errorf("error while closing %s: %s", local, err.Error())
+		}
+	}()
 
-	return nil
+	ctx, cancel := c.transferContext()
+	defer cancel()
+
+	size := int64(-1)
+	if f, ok := src.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			size = info.Size()
+		}
+	}
+
+	stats, err := c.readFrom(ctx, remote, src, size, opts)
+	if err != nil {
+		return stats, fmt.Errorf("error while sending file %s: %w", local, err)
+	}
+
+	return stats, nil
 }
 
-func (c *Client) Get(filename string) error {
-	return c.execute(filename, get)
+func (c *Client) SetProgress() {
+	c.showProgress = !c.showProgress
 }
 
-func (c *Client) Put(filename string) error {
-	return c.execute(filename, put)
+// progressBar returns the options feeding a progress bar for name and the
+// function closing it, they are empty when the bar is disabled.
+func (c *Client) progressBar(name string) ([]Option, func(stats *server.Stats)) {
+	if !c.showProgress || c.trace {
+		return nil, func(*server.Stats) {}
+	}
+
+	bar := progress.NewBar(os.Stderr, name)
+	update := func(stats *server.Stats) {
+		bar.Update(stats.Bytes, stats.Size)
+	}
+
+	return []Option{WithProgress(update)}, func(stats *server.Stats) {
+		if stats != nil {
+			bar.Finish(stats.Bytes, stats.Size)
+		}
+	}
+}
+
+func summaryLine(verb string, stats *server.Stats) string {
+	line := fmt.Sprintf("%s %d blocks, %s %d bytes in %s (%s/s), %d retransmits, %d timeouts",
+		verb, stats.Blocks, verb, stats.Bytes, stats.Duration.Round(time.Millisecond),
+		progress.FormatBytes(int64(stats.Throughput())), stats.Retransmits, stats.Timeouts)
+
+	if stats.SRTT > 0 {
+		line += fmt.Sprintf(", srtt %s, rto %s", stats.SRTT.Round(time.Microsecond), stats.RTO.Round(time.Millisecond))
+	}
+
+	return line
+}
+
+func (c *Client) GetFile(remote string, local string) error {
+	if c.verbose {
+		name := local
+		if name == "" {
+			name = path.Base(remote)
+		}
+
+		fmt.Fprintf(c.summary(local), "getting from %s:%s to %s [%s]\n", c.Settings().Server, remote, name, c.mode)
+	}
+
+	opts, done := c.progressBar(remote)
+
+	stats, err := c.download(remote, local, opts)
+	done(stats)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.summary(local), summaryLine("received", stats))
+
+	return nil
+}
+
+func (c *Client) PutFile(local string, remote string) error {
+	if c.verbose {
+		name := remote
+		if name == "" {
+			name = filepath.Base(local)
+		}
+
+		fmt.Fprintf(c.summary(local), "putting %s to %s:%s [%s]\n", local, c.Settings().Server, name, c.mode)
+	}
+
+	opts, done := c.progressBar(local)
+
+	stats, err := c.upload(local, remote, opts)
+	done(stats)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.summary(local), summaryLine("sent", stats))
+
+	return nil
 }
@@ -0,0 +1,231 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/server"
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+	"go.uber.org/zap"
+)
+
+func TestLibraryRoundTrip(t *testing.T) {
+	s := server.NewServer(zap.NewNop().Sugar(), []string{"127.0.0.1"}, "0", 1, 1, 3, t.TempDir(), false)
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve()
+
+	defer s.Close()
+
+	c := NewClient(nil, 3)
+	if err := c.Connect(s.Addrs()[0].String()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	opts := []Option{WithBlockSize(1024), WithWindowSize(4), WithTimeout(time.Second)}
+
+	var updates int
+
+	stats, err := c.Put(ctx, "file", bytes.NewReader(content), int64(len(content)),
+		append(opts, WithProgress(func(*server.Stats) { updates++ }))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updates != stats.Blocks || stats.Bytes != int64(len(content)) || stats.Duration <= 0 {
+		t.Fatalf("unexpected stats %+v after %d progress updates", stats, updates)
+	}
+
+	r, err := c.Get(ctx, "file", append(opts, WithTransferSize())...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, content) {
+		t.Fatalf("received %d bytes, expected %d", len(got), len(content))
+	}
+
+	if stats := r.Stats(); stats.Size != int64(len(content)) || stats.Blocks != 10 {
+		t.Fatalf("got size %d in %d blocks, expected %d in 10 blocks", stats.Size, stats.Blocks, len(content))
+	}
+
+	_, err = c.WriteTo(ctx, "missing", io.Discard)
+
+	var tftpErr *types.TFTPError
+	if !errors.As(err, &tftpErr) || tftpErr.Code != types.ErrFileNotFound {
+		t.Fatalf("expected file not found error, got %v", err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	s := server.NewServer(zap.NewNop().Sugar(), []string{"127.0.0.1"}, "0", 1, 1, 3, t.TempDir(), false)
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve()
+
+	defer s.Close()
+
+	c := NewClient(nil, 3)
+	if err := c.Connect(s.Addrs()[0].String()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	content := bytes.Repeat([]byte("streamed"), 500)
+
+	w, err := c.Create(ctx, "created", int64(len(content)), WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// written in pieces not aligned on blocks
+	for off := 0; off < len(content); off += 300 {
+		if _, err := w.Write(content[off:min(off+300, len(content))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := w.Stats(); stats.Bytes != int64(len(content)) {
+		t.Fatalf("sent %d bytes, expected %d", stats.Bytes, len(content))
+	}
+
+	r, err := c.Get(ctx, "created", WithTransferSize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Size() != int64(len(content)) {
+		t.Fatalf("announced size %d, expected %d", r.Size(), len(content))
+	}
+
+	if got, _ := io.ReadAll(r); !bytes.Equal(got, content) {
+		t.Fatalf("read back %d bytes, expected %d", len(got), len(content))
+	}
+
+	// an aborted upload reports the error it was aborted with
+	w, err = c.Create(ctx, "aborted", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	abort := errors.New("source failed")
+	if err := w.CloseWithError(abort); !errors.Is(err, abort) {
+		t.Fatalf("expected the abort error, got %v", err)
+	}
+}
+
+type quickBackoff struct{}
+
+func (quickBackoff) Next(time.Duration, int) time.Duration {
+	return 20 * time.Millisecond
+}
+
+func TestRequestRetries(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	c := NewClient(nil, 2)
+	if err := c.Connect(conn.LocalAddr().String()); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.WriteTo(context.Background(), "file", io.Discard,
+		WithRetries(2), WithRequestRetries(2), WithBackoff(quickBackoff{}), WithRTO(0, 0))
+	if !errors.Is(err, utils.ErrPacketCanNotBeSent) {
+		t.Fatalf("expected ErrPacketCanNotBeSent, got %v", err)
+	}
+
+	ports := make(map[string]int)
+	buffer := make([]byte, types.DatagramSize)
+
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+
+		_, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			break
+		}
+
+		ports[addr.String()]++
+	}
+
+	// 3 requests sent twice each from their own port
+	if len(ports) != 3 {
+		t.Fatalf("requests sent from %d ports, expected 3: %v", len(ports), ports)
+	}
+
+	for port, n := range ports {
+		if n != 2 {
+			t.Fatalf("request sent %d times from %s, expected 2", n, port)
+		}
+	}
+}
+
+func TestAdaptiveTimeout(t *testing.T) {
+	s := server.NewServer(zap.NewNop().Sugar(), []string{"127.0.0.1"}, "0", 1, 1, 3, t.TempDir(), false)
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve()
+
+	defer s.Close()
+
+	c := NewClient(nil, 3)
+	if err := c.Connect(s.Addrs()[0].String()); err != nil {
+		t.Fatal(err)
+	}
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	stats, err := c.Put(context.Background(), "file", bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.SRTT <= 0 || stats.RTO != server.DefaultMinRTO {
+		t.Fatalf("expected a measured srtt and a loopback rto of %s, got srtt=%s rto=%s",
+			server.DefaultMinRTO, stats.SRTT, stats.RTO)
+	}
+
+	stats, err = c.Put(context.Background(), "other", bytes.NewReader(content), int64(len(content)),
+		WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.SRTT != 0 {
+		t.Fatalf("negotiated timeout should disable the estimation, got srtt=%s", stats.SRTT)
+	}
+}
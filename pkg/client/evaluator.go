@@ -1,97 +1,422 @@
 package client
 
 import (
-	"errors"
 	"fmt"
-	"regexp"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/Wa4h1h/go-tftp/pkg/types"
 	"go.uber.org/zap"
 )
 
-var (
-	getRegex     = "^get\\s+([\\S\\s]+)$"
-	putRegex     = "^put\\s+([\\S\\s]+)$"
-	timeoutRegex = "^timeout\\s+(\\d+)$"
-	connectRegex = "^connect\\s+([\\S\\s]+)\\s+([\\S\\s]+)$"
-	traceRegex   = "^trace$"
-	quitRegex    = "^quit$"
-	helpRegex    = "^help$"
-)
+type command struct {
+	name  string
+	usage string
+	help  string
+	// minArgs and maxArgs bound the number of arguments, maxArgs -1 means
+	// unlimited
+	minArgs int
+	maxArgs int
+	run     func(e *Evaluator, args []string) (bool, error)
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"connect", "connect <host> [port]", "set the server used by the following transfers", 1, 2, runConnect},
+		{"get", "get <remote file> [local file]", "download a file, remote can be host:file", 1, 2, runGet},
+		{"put", "put <local file> [remote file]", "upload a file, remote can be host:file", 1, 2, runPut},
+		{"mget", "mget <remote file>...", "download files concurrently", 1, -1, runMget},
+		{"mput", "mput <local file or glob>...", "upload files concurrently", 1, -1, runMput},
+		{"parallel", "parallel <integer>", "number of concurrent transfers of mget and mput", 1, 1, runParallel},
+		{"mode", "mode [ascii|binary]", "set or show the transfer mode", 0, 1, runMode},
+		{"ascii", "ascii", "use netascii transfers", 0, 0, runMode},
+		{"binary", "binary", "use octet transfers", 0, 0, runMode},
+		{"status", "status", "show the current settings", 0, 0, runStatus},
+		{"timeout", "timeout <seconds>", "set the total time allowed for a transfer, 0 disables it", 1, 1, runTimeout},
+		{"rexmt", "rexmt <seconds>", "set the time waited before a packet is sent again", 1, 1, runTimeout},
+		{"backoff", "backoff [fixed|exponential]", "set or show the spacing of retransmissions", 0, 1, runBackoff},
+		{"blksize", "blksize [size]", "set or show the requested blksize, 0 disables the option", 0, 1, runOptionSize},
+		{"windowsize", "windowsize [size]", "set or show the requested windowsize, 0 disables the option", 0, 1, runOptionSize},
+		{"tsize", "tsize", "toggle requesting the transfer size", 0, 0, runToggle},
+		{"verbose", "verbose", "toggle verbose mode", 0, 0, runToggle},
+		{"trace", "trace", "toggle packet tracing", 0, 0, runToggle},
+		{"overwrite", "overwrite", "toggle overwriting existing local files", 0, 0, runToggle},
+		{"resume", "resume", "toggle resuming interrupted downloads", 0, 0, runToggle},
+		{"progress", "progress", "toggle the progress bar", 0, 0, runToggle},
+		{"literal", "literal", "toggle literal mode, host:file is then a plain file name", 0, 0, runLiteral},
+		{"help", "help [command]", "print help", 0, 1, runHelp},
+		{"?", "? [command]", "print help", 0, 1, runHelp},
+		{"quit", "quit", "exit tftp", 0, 0, func(*Evaluator, []string) (bool, error) { return true, nil }},
+	}
+}
 
 type Evaluator struct {
-	l             *zap.SugaredLogger
-	client        Connector
-	line          string
-	regexPatterns map[string]*regexp.Regexp
+	l           *zap.SugaredLogger
+	client      Connector
+	out         io.Writer
+	line        string
+	commands    map[string]*command
+	parallelism int
+	literal     bool
 }
 
 func NewEvaluator(l *zap.SugaredLogger, client Connector) *Evaluator {
 	e := &Evaluator{
-		l:      l,
-		client: client,
+		l:           l,
+		client:      client,
+		out:         os.Stdout,
+		parallelism: DefaultParallelism,
 	}
 
-	e.regexPatterns = make(map[string]*regexp.Regexp)
-
-	e.regexPatterns["get"] = regexp.MustCompile(getRegex)
-	e.regexPatterns["put"] = regexp.MustCompile(putRegex)
-	e.regexPatterns["timeout"] = regexp.MustCompile(timeoutRegex)
-	e.regexPatterns["connect"] = regexp.MustCompile(connectRegex)
-	e.regexPatterns["trace"] = regexp.MustCompile(traceRegex)
-	e.regexPatterns["quit"] = regexp.MustCompile(quitRegex)
-	e.regexPatterns["help"] = regexp.MustCompile(helpRegex)
+	e.commands = make(map[string]*command, len(commands))
+	for _, cmd := range commands {
+		e.commands[cmd.name] = cmd
+	}
 
 	return e
 }
 
 func (e *Evaluator) evaluate() (bool, error) {
-	e.line = strings.TrimSuffix(e.line, "\n")
+	fields := strings.Fields(e.line)
+	if len(fields) == 0 {
+		return false, nil
+	}
 
-	if matches := e.regexPatterns["get"].FindStringSubmatch(e.line); len(matches) == 2 {
-		return false, e.client.Get(matches[1])
+	cmd, ok := e.commands[fields[0]]
+	if !ok {
+		return false, fmt.Errorf("unknown command %s, try help", fields[0])
 	}
 
-	if matches := e.regexPatterns["put"].FindStringSubmatch(e.line); len(matches) == 2 {
-		return false, e.client.Put(matches[1])
+	args := fields[1:]
+	if len(args) < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) > cmd.maxArgs) {
+		return false, fmt.Errorf("usage: %s", cmd.usage)
 	}
 
-	if matches := e.regexPatterns["timeout"].FindStringSubmatch(e.line); len(matches) == 2 {
-		n, err := strconv.ParseUint(matches[1], 10, 32)
-		if err != nil {
-			return false, fmt.Errorf("timeout value can not be parsed: %w", err)
+	return cmd.run(e, append([]string{cmd.name}, args...))
+}
+
+// Complete returns the commands or local files starting with word.
+func (e *Evaluator) Complete(word string, first bool) []string {
+	var matches []string
+
+	if first {
+		for _, cmd := range commands {
+			if strings.HasPrefix(cmd.name, word) {
+				matches = append(matches, cmd.name)
+			}
 		}
 
-		e.client.SetTimeout(uint(n))
+		return matches
+	}
+
+	files, _ := filepath.Glob(word + "*")
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil && info.IsDir() {
+			f += string(filepath.Separator)
+		}
+
+		matches = append(matches, f)
+	}
+
+	sort.Strings(matches)
+
+	return matches
+}
+
+// splitHostFile splits host:file, [ipv6]:file is accepted as well.
+func splitHostFile(arg string) (string, string, bool) {
+	if strings.HasPrefix(arg, "[") {
+		host, file, ok := strings.Cut(arg[1:], "]:")
+
+		return host, file, ok && host != "" && file != ""
+	}
+
+	host, file, ok := strings.Cut(arg, ":")
+
+	return host, file, ok && host != "" && file != ""
+}
+
+// remoteFile connects to the host of a host:file argument unless literal
+// mode is on and returns the file name.
+func (e *Evaluator) remoteFile(arg string) (string, error) {
+	if e.literal {
+		return arg, nil
+	}
+
+	host, file, ok := splitHostFile(arg)
+	if !ok {
+		return arg, nil
+	}
+
+	if err := e.client.Connect(JoinHostPort(host, "69")); err != nil {
+		return "", err
+	}
+
+	return file, nil
+}
+
+func runConnect(e *Evaluator, args []string) (bool, error) {
+	port := "69"
+	if len(args) == 3 {
+		port = args[2]
+	}
+
+	return false, e.client.Connect(JoinHostPort(args[1], port))
+}
+
+func runGet(e *Evaluator, args []string) (bool, error) {
+	remote, err := e.remoteFile(args[1])
+	if err != nil {
+		return false, err
+	}
+
+	var local string
+	if len(args) == 3 {
+		local = args[2]
+	}
+
+	return false, e.client.GetFile(remote, local)
+}
+
+func runPut(e *Evaluator, args []string) (bool, error) {
+	var (
+		remote string
+		err    error
+	)
+
+	if len(args) == 3 {
+		if remote, err = e.remoteFile(args[2]); err != nil {
+			return false, err
+		}
+	}
+
+	return false, e.client.PutFile(args[1], remote)
+}
+
+func runMget(e *Evaluator, args []string) (bool, error) {
+	return false, e.batch(GetJobs(args[1:]))
+}
+
+func runMput(e *Evaluator, args []string) (bool, error) {
+	jobs, err := PutJobs(args[1:])
+	if err != nil {
+		return false, err
+	}
+
+	return false, e.batch(jobs)
+}
+
+func (e *Evaluator) batch(jobs []Job) error {
+	report := NewBatch(e.client, "", e.parallelism).Run(jobs)
+	report.Print(e.out, false)
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d transfers failed", report.Failed, len(report.Results))
+	}
+
+	return nil
+}
+
+func runParallel(e *Evaluator, args []string) (bool, error) {
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 1 {
+		return false, fmt.Errorf("parallelism must be a positive integer: %s", args[1])
+	}
+
+	e.parallelism = n
+
+	return false, nil
+}
+
+func runMode(e *Evaluator, args []string) (bool, error) {
+	mode := ""
+
+	switch {
+	case args[0] == "ascii":
+		mode = types.ModeNetascii
+	case args[0] == "binary":
+		mode = types.ModeOctet
+	case len(args) == 2:
+		switch args[1] {
+		case "ascii":
+			mode = types.ModeNetascii
+		case "binary":
+			mode = types.ModeOctet
+		default:
+			mode = args[1]
+		}
+	default:
+		fmt.Fprintf(e.out, "Using %s mode to transfer files.\n", e.client.Settings().Mode)
 
 		return false, nil
 	}
 
-	if matches := e.regexPatterns["connect"].FindStringSubmatch(e.line); len(matches) == 3 {
-		return false, e.client.Connect(fmt.Sprintf("%s:%s", matches[1], matches[2]))
+	if err := e.client.SetMode(mode); err != nil {
+		return false, fmt.Errorf("%w: %s", err, mode)
 	}
 
-	if matches := e.regexPatterns["trace"].FindStringSubmatch(e.line); len(matches) == 1 {
-		e.client.SetTrace()
+	return false, nil
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+
+	return "off"
+}
+
+func runStatus(e *Evaluator, _ []string) (bool, error) {
+	s := e.client.Settings()
+
+	if s.Server != "" {
+		fmt.Fprintf(e.out, "Connected to %s.\n", s.Server)
+	} else {
+		fmt.Fprintln(e.out, "Not connected.")
+	}
+
+	fmt.Fprintf(e.out, "Mode: %s Verbose: %s Tracing: %s Literal: %s\n",
+		s.Mode, onOff(s.Verbose), onOff(s.Trace), onOff(e.literal))
+	fmt.Fprintf(e.out, "Rexmt-interval: %d seconds, Max-timeout: %s, Backoff: %s\n",
+		int(s.Rexmt.Seconds()), maxTimeout(s.Timeout), s.Backoff)
+	fmt.Fprintf(e.out, "Retries: %d Request-retries: %d\n", s.Retries, s.RequestRetries)
+	fmt.Fprintf(e.out, "Blksize: %s Windowsize: %s Tsize: %s\n",
+		optionSize(s.BlockSize), optionSize(s.WindowSize), onOff(s.TransferSize))
+	fmt.Fprintf(e.out, "Overwrite: %s Resume: %s Progress: %s Parallel: %d\n",
+		onOff(s.Overwrite), onOff(s.Resume), onOff(s.Progress), e.parallelism)
+
+	return false, nil
+}
+
+func maxTimeout(timeout time.Duration) string {
+	if timeout <= 0 {
+		return "none"
+	}
+
+	return fmt.Sprintf("%d seconds", int(timeout.Seconds()))
+}
+
+func optionSize(size int) string {
+	if size == 0 {
+		return "default"
+	}
+
+	return strconv.Itoa(size)
+}
+
+func runTimeout(e *Evaluator, args []string) (bool, error) {
+	n, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil || (n == 0 && args[0] == "rexmt") {
+		return false, fmt.Errorf("%s must be a positive number of seconds: %s", args[0], args[1])
+	}
+
+	if args[0] == "rexmt" {
+		e.client.SetRexmt(uint(n))
+	} else {
+		e.client.SetTimeout(uint(n))
+	}
+
+	return false, nil
+}
+
+func runBackoff(e *Evaluator, args []string) (bool, error) {
+	if len(args) == 1 {
+		fmt.Fprintf(e.out, "Backoff: %s\n", e.client.Settings().Backoff)
+
+		return false, nil
+	}
+
+	return false, e.client.SetBackoff(args[1])
+}
+
+func runOptionSize(e *Evaluator, args []string) (bool, error) {
+	s := e.client.Settings()
+
+	if len(args) == 1 {
+		size := s.BlockSize
+		if args[0] == "windowsize" {
+			size = s.WindowSize
+		}
+
+		fmt.Fprintf(e.out, "%s: %s\n", args[0], optionSize(size))
 
 		return false, nil
 	}
 
-	if matches := e.regexPatterns["help"].FindStringSubmatch(e.line); len(matches) == 1 {
-		fmt.Println(`Commands:
-	connect <host> <port>
-	get <file>
-	put <file>
-	timeout <integer>
-	trace
-	quit`)
+	n, err := strconv.Atoi(args[1])
+	if err != nil {
+		return false, fmt.Errorf("%s must be an integer: %s", args[0], args[1])
+	}
+
+	if args[0] == "windowsize" {
+		return false, e.client.SetWindowSize(n)
+	}
+
+	return false, e.client.SetBlockSize(n)
+}
+
+func runToggle(e *Evaluator, args []string) (bool, error) {
+	var on bool
+
+	switch args[0] {
+	case "tsize":
+		e.client.SetTransferSize()
+		on = e.client.Settings().TransferSize
+	case "verbose":
+		e.client.SetVerbose()
+		on = e.client.Settings().Verbose
+	case "trace":
+		e.client.SetTrace()
+		on = e.client.Settings().Trace
+	case "overwrite":
+		e.client.SetOverwrite()
+		on = e.client.Settings().Overwrite
+	case "resume":
+		e.client.SetResume()
+		on = e.client.Settings().Resume
+	case "progress":
+		e.client.SetProgress()
+		on = e.client.Settings().Progress
+	}
+
+	fmt.Fprintf(e.out, "%s %s.\n", strings.ToUpper(args[0][:1])+args[0][1:], onOff(on))
+
+	return false, nil
+}
+
+func runLiteral(e *Evaluator, _ []string) (bool, error) {
+	e.literal = !e.literal
+	fmt.Fprintf(e.out, "Literal mode %s.\n", onOff(e.literal))
+
+	return false, nil
+}
+
+func runHelp(e *Evaluator, args []string) (bool, error) {
+	if len(args) == 2 {
+		cmd, ok := e.commands[args[1]]
+		if !ok {
+			return false, fmt.Errorf("unknown command %s", args[1])
+		}
+
+		fmt.Fprintf(e.out, "%s\n\t%s\n", cmd.usage, cmd.help)
+
 		return false, nil
 	}
 
-	if matches := e.regexPatterns["quit"].FindStringSubmatch(e.line); len(matches) == 1 {
-		return true, nil
+	w := tabwriter.NewWriter(e.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Commands:")
+
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "\t%s\t%s\n", cmd.usage, cmd.help)
 	}
 
-	return false, errors.New(fmt.Sprintf("unknow command  arguments: %s", e.line))
+	return false, w.Flush()
 }
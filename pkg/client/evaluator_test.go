@@ -1 +1,109 @@
 package client
+
+import (
+	"io"
+	"testing"
+)
+
+type fakeConnector struct {
+	Connector
+	addr string
+}
+
+func (f *fakeConnector) Connect(addr string) error {
+	f.addr = addr
+
+	return nil
+}
+
+func TestEvaluateConnect(t *testing.T) {
+	tests := map[string]string{
+		"connect localhost 69": "localhost:69",
+		"connect 10.0.0.1 69":  "10.0.0.1:69",
+		"connect ::1 69":       "[::1]:69",
+		"connect [::1] 69":     "[::1]:69",
+	}
+
+	for line, expected := range tests {
+		f := &fakeConnector{}
+		e := NewEvaluator(nil, f)
+		e.line = line
+
+		if _, err := e.evaluate(); err != nil {
+			t.Fatalf("%s: %s", line, err.Error())
+		}
+
+		if f.addr != expected {
+			t.Fatalf("%s: connected to %s, expected %s", line, f.addr, expected)
+		}
+	}
+}
+
+type settingsConnector struct {
+	fakeConnector
+	settings Settings
+}
+
+func (s *settingsConnector) Settings() Settings {
+	return s.settings
+}
+
+func (s *settingsConnector) SetMode(mode string) error {
+	s.settings.Mode = mode
+
+	return nil
+}
+
+func (s *settingsConnector) SetBlockSize(size int) error {
+	s.settings.BlockSize = size
+
+	return nil
+}
+
+func (s *settingsConnector) GetFile(remote string, local string) error {
+	s.settings.Server = s.addr + " " + remote
+
+	return nil
+}
+
+func TestEvaluateCommands(t *testing.T) {
+	tests := []struct {
+		lines    []string
+		expected Settings
+		err      bool
+	}{
+		{lines: []string{"binary"}, expected: Settings{Mode: "octet"}},
+		{lines: []string{"ascii"}, expected: Settings{Mode: "netascii"}},
+		{lines: []string{"mode ascii"}, expected: Settings{Mode: "netascii"}},
+		{lines: []string{"blksize 1024"}, expected: Settings{BlockSize: 1024}},
+		{lines: []string{"blksize big"}, err: true},
+		{lines: []string{"get host:file"}, expected: Settings{Server: "host:69 file"}},
+		{lines: []string{"get [::1]:file"}, expected: Settings{Server: "[::1]:69 file"}},
+		{lines: []string{"literal", "get host:file"}, expected: Settings{Server: " host:file"}},
+		{lines: []string{"get"}, err: true},
+		{lines: []string{"unknown"}, err: true},
+		{lines: []string{"help get"}},
+		{lines: []string{"? nope"}, err: true},
+	}
+
+	for _, test := range tests {
+		s := &settingsConnector{}
+		e := NewEvaluator(nil, s)
+		e.out = io.Discard
+
+		var err error
+
+		for _, line := range test.lines {
+			e.line = line
+			_, err = e.evaluate()
+		}
+
+		if (err != nil) != test.err {
+			t.Fatalf("%v: unexpected error %v", test.lines, err)
+		}
+
+		if s.settings != test.expected {
+			t.Fatalf("%v: got settings %+v, expected %+v", test.lines, s.settings, test.expected)
+		}
+	}
+}
@@ -1,7 +1,14 @@
 package client
 
 import (
+	"fmt"
+	"io"
+	"net"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
 )
 
 func checkFileExist(file string) bool {
@@ -9,3 +16,62 @@ func checkFileExist(file string) bool {
 
 	return err == nil
 }
+
+func JoinHostPort(host string, port string) string {
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), port)
+}
+
+func openSource(local string) (io.ReadCloser, error) {
+	if local == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening %s: %w", local, err)
+	}
+
+	return f, nil
+}
+
+// openDestination returns the file a download is written to. Unless local is
+// "-" (stdout) data goes to a temporary file next to local which done moves
+// into place once the transfer succeeded, or removes otherwise.
+func openDestination(local string, overwrite bool) (*os.File, func(ok bool) error, error) {
+	if local == "-" {
+		return os.Stdout, func(bool) error { return nil }, nil
+	}
+
+	if !overwrite && checkFileExist(local) {
+		return nil, nil, fmt.Errorf("%w: %s", utils.ErrFileExists, local)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(local), fmt.Sprintf(".%s.*.part", filepath.Base(local)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while creating temporary file: %w", err)
+	}
+
+	done := func(ok bool) error {
+		errClose := tmp.Close()
+
+		if !ok || errClose != nil {
+			if err := os.Remove(tmp.Name()); err != nil {
+				return fmt.Errorf("error while removing temporary file: %w", err)
+			}
+
+			return errClose
+		}
+
+		if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+			return fmt.Errorf("error while setting file permissions: %w", err)
+		}
+
+		if err := os.Rename(tmp.Name(), local); err != nil {
+			return fmt.Errorf("error while moving %s to %s: %w", tmp.Name(), local, err)
+		}
+
+		return nil
+	}
+
+	return tmp, done, nil
+}
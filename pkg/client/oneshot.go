@@ -0,0 +1,160 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/server"
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	ExitUsage   = 2
+	ExitTimeout = 3
+	// ExitRemote is added to the error code sent by the server, a missing
+	// file exits with 11 and a full disk with 13.
+	ExitRemote = 10
+)
+
+type Result struct {
+	Op          string         `json:"op"`
+	Server      string         `json:"server"`
+	Remote      string         `json:"remote"`
+	Local       string         `json:"local"`
+	Error       string         `json:"error,omitempty"`
+	ErrCode     *types.ErrCode `json:"err_code,omitempty"`
+	Bytes       int64          `json:"bytes"`
+	Blocks      int            `json:"blocks"`
+	Retransmits int            `json:"retransmits"`
+	Timeouts    int            `json:"timeouts"`
+	Duplicates  int            `json:"duplicates"`
+	SRTTMs      float64        `json:"srtt_ms,omitempty"`
+	RTOMs       float64        `json:"rto_ms,omitempty"`
+	DurationMs  int64          `json:"duration_ms"`
+	ExitCode    int            `json:"exit_code"`
+}
+
+func (r *Result) set(stats *server.Stats, err error) {
+	r.ExitCode = ExitCode(err)
+
+	if stats != nil {
+		r.Bytes = stats.Bytes
+		r.Blocks = stats.Blocks
+		r.Retransmits = stats.Retransmits
+		r.Timeouts = stats.Timeouts
+		r.Duplicates = stats.Duplicates
+		r.SRTTMs = float64(stats.SRTT) / float64(time.Millisecond)
+		r.RTOMs = float64(stats.RTO) / float64(time.Millisecond)
+	}
+
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	var tftpErr *types.TFTPError
+	if errors.As(err, &tftpErr) {
+		r.ErrCode = &tftpErr.Code
+	}
+}
+
+func ExitCode(err error) int {
+	var tftpErr *types.TFTPError
+
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &tftpErr):
+		return ExitRemote + int(tftpErr.Code)
+	case errors.Is(err, utils.ErrRequestTimeout), errors.Is(err, utils.ErrPacketCanNotBeSent):
+		return ExitTimeout
+	default:
+		return ExitFailure
+	}
+}
+
+// ServerAddr accepts host, host:port, [ipv6] and [ipv6]:port and falls back to
+// port when none is given.
+func ServerAddr(addr string, port string) string {
+	if host, p, err := net.SplitHostPort(addr); err == nil {
+		return net.JoinHostPort(host, p)
+	}
+
+	return JoinHostPort(addr, port)
+}
+
+type OneShot struct {
+	c       Connector
+	out     io.Writer
+	errOut  io.Writer
+	port    string
+	quiet   bool
+	jsonOut bool
+}
+
+func NewOneShot(c Connector, port string, quiet bool, jsonOut bool) *OneShot {
+	return &OneShot{c: c, out: os.Stdout, errOut: os.Stderr, port: port, quiet: quiet, jsonOut: jsonOut}
+}
+
+func (o *OneShot) Run(args []string) int {
+	if len(args) < 3 || len(args) > 4 || (args[0] != "get" && args[0] != "put") {
+		fmt.Fprintln(o.errOut, "usage: get <host[:port]> <remote> [local] | put <host[:port]> <local> [remote]")
+
+		return ExitUsage
+	}
+
+	res := &Result{Op: args[0], Server: ServerAddr(args[1], o.port)}
+
+	var other string
+	if len(args) == 4 {
+		other = args[3]
+	}
+
+	if res.Op == "get" {
+		res.Remote, res.Local = args[2], other
+	} else {
+		res.Local, res.Remote = args[2], other
+	}
+
+	if o.quiet || o.jsonOut {
+		o.c.SetOutput(io.Discard)
+	}
+
+	start := time.Now()
+
+	err := o.c.Connect(res.Server)
+	if err == nil {
+		if res.Op == "get" {
+			err = o.c.GetFile(res.Remote, res.Local)
+		} else {
+			err = o.c.PutFile(res.Local, res.Remote)
+		}
+	}
+
+	res.DurationMs = time.Since(start).Milliseconds()
+	res.set(o.c.Stats(), err)
+
+	switch {
+	case o.jsonOut:
+		b, errM := json.Marshal(res)
+		if errM != nil {
+			fmt.Fprintln(o.errOut, errM.Error())
+
+			return ExitFailure
+		}
+
+		fmt.Fprintln(o.out, string(b))
+	case err != nil:
+		fmt.Fprintln(o.errOut, strings.TrimPrefix(err.Error(), "error: "))
+	}
+
+	return res.ExitCode
+}
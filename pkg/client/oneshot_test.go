@@ -0,0 +1,42 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+func TestServerAddr(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.1":      "10.0.0.1:69",
+		"10.0.0.1:1069": "10.0.0.1:1069",
+		"localhost":     "localhost:69",
+		"::1":           "[::1]:69",
+		"[::1]":         "[::1]:69",
+		"[::1]:1069":    "[::1]:1069",
+	}
+
+	for addr, expected := range tests {
+		if got := ServerAddr(addr, "69"); got != expected {
+			t.Fatalf("%s: got %s, expected %s", addr, got, expected)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := map[error]int{
+		nil:                     ExitOK,
+		utils.ErrRequestTimeout: ExitTimeout,
+		utils.ErrFileExists:     ExitFailure,
+		fmt.Errorf("error while receiving file f: %w", &types.TFTPError{Code: types.ErrFileNotFound}): 11,
+		&types.TFTPError{Code: types.ErrDiskFull}:                                                     13,
+	}
+
+	for err, expected := range tests {
+		if got := ExitCode(err); got != expected {
+			t.Fatalf("%v: got %d, expected %d", err, got, expected)
+		}
+	}
+}
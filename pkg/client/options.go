@@ -0,0 +1,255 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/backoff"
+	"github.com/Wa4h1h/go-tftp/pkg/server"
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+// Option customizes a single transfer of the library API.
+type Option func(o *transferOptions)
+
+type transferOptions struct {
+	mode       string
+	blockSize  int
+	windowSize int
+	timeout    time.Duration
+	retries    int
+	// requestRetries is the number of times an unanswered request is sent
+	// again from a new port
+	requestRetries int
+	backoff        backoff.Policy
+	minRTO         time.Duration
+	maxRTO         time.Duration
+	offset         int64
+	progress       func(stats *server.Stats)
+	tsize          bool
+	negotiate      bool
+}
+
+// WithMode sets the transfer mode, octet or netascii.
+func WithMode(mode string) Option {
+	return func(o *transferOptions) {
+		o.mode = strings.ToLower(mode)
+	}
+}
+
+// WithBlockSize requests the blksize option (RFC 2348).
+func WithBlockSize(size int) Option {
+	return func(o *transferOptions) {
+		o.blockSize = size
+	}
+}
+
+// WithWindowSize requests the windowsize option (RFC 7440).
+func WithWindowSize(size int) Option {
+	return func(o *transferOptions) {
+		o.windowSize = size
+	}
+}
+
+// WithTransferSize requests the tsize option (RFC 2349), the size announced
+// by the server is available in the transfer stats.
+func WithTransferSize() Option {
+	return func(o *transferOptions) {
+		o.tsize = true
+	}
+}
+
+// WithTimeout sets the per packet timeout and requests the server to use it
+// with the timeout option (RFC 2349), it is rounded to whole seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *transferOptions) {
+		o.timeout = timeout
+		o.negotiate = true
+	}
+}
+
+// WithOffset starts a download at the given byte offset using the offset
+// option. Servers ignoring it send the whole file, the client then discards
+// the bytes before offset.
+func WithOffset(offset int64) Option {
+	return func(o *transferOptions) {
+		o.offset = offset
+	}
+}
+
+// WithProgress calls fn after each transferred block, the stats must not be
+// retained after fn returned.
+func WithProgress(fn func(stats *server.Stats)) Option {
+	return func(o *transferOptions) {
+		o.progress = fn
+	}
+}
+
+// WithRetries sets how many times a packet is sent before giving up.
+func WithRetries(retries int) Option {
+	return func(o *transferOptions) {
+		o.retries = retries
+	}
+}
+
+// WithRequestRetries sets how many times a request left unanswered after all
+// its tries is sent again from a new port.
+func WithRequestRetries(retries int) Option {
+	return func(o *transferOptions) {
+		o.requestRetries = retries
+	}
+}
+
+// WithBackoff sets the policy spacing the retransmissions of a packet and the
+// request retries.
+func WithBackoff(p backoff.Policy) Option {
+	return func(o *transferOptions) {
+		o.backoff = p
+	}
+}
+
+// WithRTO bounds the retransmission timeout adapted to the measured round
+// trip time (RFC 6298), a max of 0 stands for the per packet timeout and a min
+// of 0 disables the adaptation.
+func WithRTO(minRTO time.Duration, maxRTO time.Duration) Option {
+	return func(o *transferOptions) {
+		o.minRTO = minRTO
+		o.maxRTO = maxRTO
+	}
+}
+
+func (c *Client) transferOptions(opts []Option) *transferOptions {
+	o := &transferOptions{
+		mode:           c.mode,
+		timeout:        c.rexmt,
+		retries:        int(c.numTries),
+		requestRetries: int(c.requestRetries),
+		backoff:        c.backoffPolicy(),
+		minRTO:         c.minRTO,
+		maxRTO:         c.maxRTO,
+		blockSize:      c.blockSize,
+		windowSize:     c.windowSize,
+		tsize:          c.tsize,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+func (c *Client) backoffPolicy() backoff.Policy {
+	p, err := backoff.Parse(c.backoff)
+	if err != nil {
+		return backoff.Fixed{}
+	}
+
+	return p
+}
+
+func (o *transferOptions) validate() error {
+	if o.mode != types.ModeOctet && o.mode != types.ModeNetascii {
+		return utils.ErrUnsupportedMode
+	}
+
+	if o.blockSize != 0 && (o.blockSize < types.MinBlockSize || o.blockSize > types.MaxBlockSize) {
+		return fmt.Errorf("%w: blksize %d not in [%d, %d]", utils.ErrInvalidOption,
+			o.blockSize, types.MinBlockSize, types.MaxBlockSize)
+	}
+
+	if o.windowSize != 0 && (o.windowSize < 1 || o.windowSize > types.MaxWindowSize) {
+		return fmt.Errorf("%w: windowsize %d not in [1, %d]", utils.ErrInvalidOption,
+			o.windowSize, types.MaxWindowSize)
+	}
+
+	if o.timeout < time.Second || (o.negotiate && o.timeout > types.MaxTimeout*time.Second) {
+		return fmt.Errorf("%w: timeout %s not in [1s, %ds]", utils.ErrInvalidOption, o.timeout, types.MaxTimeout)
+	}
+
+	if o.offset < 0 {
+		return fmt.Errorf("%w: negative offset %d", utils.ErrInvalidOption, o.offset)
+	}
+
+	if o.retries < 1 {
+		return fmt.Errorf("%w: retries must be greater than 0", utils.ErrInvalidOption)
+	}
+
+	if o.requestRetries < 0 {
+		return fmt.Errorf("%w: request retries must not be negative", utils.ErrInvalidOption)
+	}
+
+	if o.backoff == nil {
+		return fmt.Errorf("%w: missing backoff policy", utils.ErrInvalidOption)
+	}
+
+	return nil
+}
+
+func (o *transferOptions) request(op types.OpCode, remote string, size int64) *types.Request {
+	req := &types.Request{
+		Opcode:   op,
+		Filename: remote,
+		Mode:     o.mode,
+	}
+
+	if o.blockSize != 0 {
+		req.Options.Set(types.OptionBlockSize, strconv.Itoa(o.blockSize))
+	}
+
+	if o.windowSize != 0 {
+		req.Options.Set(types.OptionWindowSize, strconv.Itoa(o.windowSize))
+	}
+
+	if o.negotiate {
+		req.Options.Set(types.OptionTimeout, strconv.Itoa(int(o.timeout/time.Second)))
+	}
+
+	if op == types.OpCodeRRQ && o.offset > 0 {
+		req.Options.Set(types.OptionOffset, strconv.FormatInt(o.offset, 10))
+	}
+
+	switch {
+	case op == types.OpCodeWRQ && size >= 0:
+		req.Options.Set(types.OptionTransferSize, strconv.FormatInt(size, 10))
+	case op == types.OpCodeRRQ && o.tsize:
+		req.Options.Set(types.OptionTransferSize, "0")
+	}
+
+	return req
+}
+
+// accept checks the options acknowledged by the server against the requested
+// ones and returns the settings to apply to the transfer.
+func (o *transferOptions) accept(oack types.Options) (*server.TransferOptions, error) {
+	accepted := &server.TransferOptions{Size: -1}
+
+	for _, opt := range oack {
+		n, err := strconv.ParseInt(opt.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s=%q", utils.ErrOptionNegotiation, opt.Name, opt.Value)
+		}
+
+		switch {
+		case opt.Name == types.OptionBlockSize && o.blockSize != 0 &&
+			n >= types.MinBlockSize && n <= int64(o.blockSize):
+			accepted.BlockSize = int(n)
+		case opt.Name == types.OptionWindowSize && o.windowSize != 0 &&
+			n >= 1 && n <= int64(o.windowSize):
+			accepted.WindowSize = int(n)
+		case opt.Name == types.OptionTimeout && o.negotiate && n == int64(o.timeout/time.Second):
+			accepted.Timeout = o.timeout
+		case opt.Name == types.OptionTransferSize && n >= 0:
+			accepted.Size = n
+		case opt.Name == types.OptionOffset && o.offset > 0 && n == o.offset:
+			accepted.Offset = n
+		default:
+			return nil, fmt.Errorf("%w: %s=%s", utils.ErrOptionNegotiation, opt.Name, opt.Value)
+		}
+	}
+
+	return accepted, nil
+}
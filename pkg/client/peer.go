@@ -0,0 +1,72 @@
+package client
+
+import (
+	"net"
+
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+)
+
+// peerConn is the client side of a transfer. Servers answer from a new port
+// (their transfer identifier), so the socket can not be connected up front:
+// it locks on the port of the first answer coming from the server host and
+// rejects packets from any other port.
+type peerConn struct {
+	*net.UDPConn
+	peer   *net.UDPAddr
+	locked bool
+}
+
+func dialPeer(addr *net.UDPAddr) (*peerConn, error) {
+	network := "udp4"
+	if addr.IP.To4() == nil {
+		network = "udp6"
+	}
+
+	conn, err := net.ListenUDP(network, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &peerConn{UDPConn: conn, peer: addr}, nil
+}
+
+func (p *peerConn) Read(b []byte) (int, error) {
+	for {
+		n, addr, err := p.ReadFromUDP(b)
+		if err != nil {
+			return n, err
+		}
+
+		if !addr.IP.Equal(p.peer.IP) {
+			continue
+		}
+
+		if !p.locked {
+			p.peer = addr
+			p.locked = true
+		}
+
+		if addr.Port != p.peer.Port {
+			unknownTID := &types.Error{
+				Opcode:    types.OpCodeError,
+				ErrorCode: types.ErrUnknownTransferId,
+				ErrMsg:    "unknown transfer id",
+			}
+			if b, err := unknownTID.MarshalBinary(); err == nil {
+				_, _ = p.WriteToUDP(b, addr)
+			}
+
+			continue
+		}
+
+		return n, nil
+	}
+}
+
+func (p *peerConn) Write(b []byte) (int, error) {
+	return p.WriteToUDP(b, p.peer)
+}
+
+func (p *peerConn) RemoteAddr() net.Addr {
+	return p.peer
+}
@@ -0,0 +1,266 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/server"
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+// skipWriter discards the first skip bytes written to it.
+type skipWriter struct {
+	w    io.Writer
+	skip int64
+}
+
+func (s *skipWriter) Write(b []byte) (int, error) {
+	n := len(b)
+
+	if s.skip > 0 {
+		skipped := min(s.skip, int64(len(b)))
+		s.skip -= skipped
+		b = b[skipped:]
+	}
+
+	if len(b) == 0 {
+		return n, nil
+	}
+
+	if _, err := s.w.Write(b); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// partialState describes a download that did not complete, it is stored as
+// json next to the partial file.
+type partialState struct {
+	Server  string    `json:"server"`
+	Remote  string    `json:"remote"`
+	Size    int64     `json:"size"`
+	Bytes   int64     `json:"bytes"`
+	Updated time.Time `json:"updated"`
+}
+
+// partial is the partial file of a resumable download of remote into local.
+type partial struct {
+	f     *os.File
+	path  string
+	local string
+	state partialState
+	pos   int64
+	// verify is the number of bytes of the existing prefix that are compared
+	// with the data sent by the server instead of being written.
+	verify int64
+}
+
+func partialPath(local string) string {
+	return filepath.Join(filepath.Dir(local), fmt.Sprintf(".%s.part", filepath.Base(local)))
+}
+
+// openPartial opens the partial file of local, previous state is kept when
+// it belongs to the same server and remote file.
+func openPartial(local string, server string, remote string) (*partial, error) {
+	p := &partial{
+		path:  partialPath(local),
+		local: local,
+		state: partialState{Server: server, Remote: remote, Size: -1},
+	}
+
+	var state partialState
+
+	if b, err := os.ReadFile(p.path + ".json"); err == nil && json.Unmarshal(b, &state) == nil &&
+		state.Server == server && state.Remote == remote {
+		p.state = state
+	}
+
+	f, err := os.OpenFile(p.path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening partial file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+
+		return nil, fmt.Errorf("error while opening partial file: %w", err)
+	}
+
+	p.f = f
+	p.state.Bytes = min(p.state.Bytes, info.Size())
+
+	if err := p.truncate(p.state.Bytes); err != nil {
+		f.Close()
+
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *partial) truncate(size int64) error {
+	if err := p.f.Truncate(size); err != nil {
+		return fmt.Errorf("error while truncating partial file: %w", err)
+	}
+
+	if _, err := p.f.Seek(size, io.SeekStart); err != nil {
+		return fmt.Errorf("error while seeking partial file: %w", err)
+	}
+
+	p.pos = size
+	p.state.Bytes = size
+
+	return nil
+}
+
+// start prepares the partial file for a transfer starting at offset of a
+// remote file of the given size.
+func (p *partial) start(offset int64, size int64) error {
+	if size >= 0 && p.state.Size >= 0 && size != p.state.Size {
+		// the remote file changed since the last attempt, restart from scratch
+		if offset > 0 {
+			return fmt.Errorf("%w: %s", utils.ErrRemoteChanged, p.state.Remote)
+		}
+
+		if err := p.truncate(0); err != nil {
+			return err
+		}
+	}
+
+	p.state.Size = size
+
+	if offset == 0 && p.state.Bytes > 0 {
+		// the server ignored the offset option, the prefix is downloaded again
+		// and checked against what we already have
+		p.verify = p.state.Bytes
+		p.pos = 0
+
+		if _, err := p.f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("error while seeking partial file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (p *partial) Write(b []byte) (int, error) {
+	n := len(b)
+
+	if p.verify > 0 {
+		chunk := b[:min(p.verify, int64(len(b)))]
+		existing := make([]byte, len(chunk))
+
+		if _, err := io.ReadFull(p.f, existing); err != nil {
+			return 0, fmt.Errorf("error while reading partial file: %w", err)
+		}
+
+		if !bytes.Equal(chunk, existing) {
+			// the prefix differs, keep the downloaded data from here on
+			p.verify = 0
+
+			if err := p.truncate(p.pos); err != nil {
+				return 0, err
+			}
+		} else {
+			p.verify -= int64(len(chunk))
+			p.pos += int64(len(chunk))
+			b = b[len(chunk):]
+		}
+	}
+
+	if len(b) == 0 {
+		return n, nil
+	}
+
+	written, err := p.f.Write(b)
+	p.pos += int64(written)
+	p.state.Bytes = max(p.state.Bytes, p.pos)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// finish moves the partial file into place when ok, otherwise it saves the
+// state of the download next to it so that the next attempt resumes it.
+func (p *partial) finish(ok bool) error {
+	errClose := p.f.Close()
+
+	if ok && errClose == nil {
+		errs := []error{os.Chmod(p.path, 0o644), os.Rename(p.path, p.local)}
+		if err := os.Remove(p.path + ".json"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+
+		if err := errors.Join(errs...); err != nil {
+			return fmt.Errorf("error while moving %s to %s: %w", p.path, p.local, err)
+		}
+
+		return nil
+	}
+
+	p.state.Updated = time.Now().UTC()
+
+	b, err := json.Marshal(&p.state)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(p.path+".json", b, 0o600); err != nil {
+		return fmt.Errorf("error while saving partial download state: %w", err)
+	}
+
+	return errClose
+}
+
+// resume downloads remote into local, continuing from the data a previous
+// attempt left behind.
+func (c *Client) resume(remote string, local string, opts []Option) (*server.Stats, error) {
+	if c.remoteAddr == nil {
+		return nil, utils.ErrNotConnected
+	}
+
+	p, err := openPartial(local, c.remoteAddr.String(), remote)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.transferContext()
+	defer cancel()
+
+	opts = append([]Option{WithTransferSize(), WithOffset(p.state.Bytes)}, opts...)
+
+	stats, err := c.receive(ctx, remote, opts, func(_ *transferOptions, offset int64, size int64) (io.Writer, error) {
+		return p, p.start(offset, size)
+	})
+	if errors.Is(err, utils.ErrRemoteChanged) {
+		p.state = partialState{Server: p.state.Server, Remote: remote, Size: -1}
+	}
+
+	if errFinish := p.finish(err == nil); errFinish != nil && err == nil {
+		err = errFinish
+	}
+
+	return stats, err
+}
+
+func (c *Client) SetResume() {
+	c.resumable = !c.resumable
+}
+
+// canResume reports whether a download into local can be resumed, only
+// octet downloads into files are.
+func (c *Client) canResume(local string) bool {
+	return c.resumable && local != "-" && c.mode == types.ModeOctet
+}
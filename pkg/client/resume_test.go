@@ -0,0 +1,114 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wa4h1h/go-tftp/pkg/server"
+	"go.uber.org/zap"
+)
+
+func TestResumeDownload(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+
+	if err := os.WriteFile(filepath.Join(dir, "image"), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := server.NewServer(zap.NewNop().Sugar(), []string{"127.0.0.1"}, "0", 1, 1, 3, dir, false)
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve()
+
+	defer s.Close()
+
+	c := NewClient(nil, 3)
+	c.SetResume()
+
+	if err := c.Connect(s.Addrs()[0].String()); err != nil {
+		t.Fatal(err)
+	}
+
+	local := filepath.Join(t.TempDir(), "image")
+	state, _ := json.Marshal(&partialState{Server: c.remoteAddr.String(), Remote: "image", Size: -1, Bytes: 10000})
+
+	if err := os.WriteFile(partialPath(local), content[:10000], 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(partialPath(local)+".json", state, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := c.Download("image", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Bytes != int64(len(content)-10000) {
+		t.Fatalf("downloaded %d bytes, expected only the missing %d", stats.Bytes, len(content)-10000)
+	}
+
+	got, err := os.ReadFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, content) {
+		t.Fatalf("resumed file differs from the remote one")
+	}
+
+	if _, err := os.Stat(partialPath(local) + ".json"); !os.IsNotExist(err) {
+		t.Fatalf("partial state was not removed: %v", err)
+	}
+}
+
+func TestPartialVerifiesPrefix(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "image")
+	content := bytes.Repeat([]byte("0123456789abcdef"), 100)
+	corrupted := append(append([]byte(nil), content[:500]...), bytes.Repeat([]byte{0}, 300)...)
+
+	if err := os.WriteFile(partialPath(local), corrupted, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	state, _ := json.Marshal(&partialState{Server: "srv", Remote: "image", Size: -1, Bytes: 800})
+	if err := os.WriteFile(partialPath(local)+".json", state, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := openPartial(local, "srv", "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server ignored the offset and sends the whole file again
+	if err := p.start(0, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	for b := content; len(b) > 0; b = b[min(512, len(b)):] {
+		if _, err := p.Write(b[:min(512, len(b))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := p.finish(true); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, content) {
+		t.Fatalf("corrupted prefix was kept")
+	}
+}
@@ -0,0 +1,94 @@
+package compression
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is a compression format of stored files, recognized by extension.
+type Codec struct {
+	Name      string
+	Ext       string
+	newReader func(r io.Reader) (io.ReadCloser, error)
+	newWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	Gzip = &Codec{
+		Name: "gzip",
+		Ext:  ".gz",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+	}
+	Zstd = &Codec{
+		Name: "zstd",
+		Ext:  ".zst",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			// one goroutine per transfer, they already run in parallel
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+			if err != nil {
+				return nil, err
+			}
+
+			return d.IOReadCloser(), nil
+		},
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		},
+	}
+)
+
+// Codecs are tried in order when looking for the compressed copy of a file.
+var Codecs = []*Codec{Gzip, Zstd}
+
+// Parse returns the codec named name, nil for the empty string and "none".
+func Parse(name string) (*Codec, error) {
+	if name == "" || name == "none" {
+		return nil, nil
+	}
+
+	for _, c := range Codecs {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+
+	return nil, fmt.Errorf("error: unknown compression %q, expected gzip, zstd or none", name)
+}
+
+func (c *Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return c.newReader(r)
+}
+
+// NewWriter compresses to w, the content is complete once the writer is
+// closed.
+func (c *Codec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return c.newWriter(w)
+}
+
+// Find returns the compressed copy of path, the error wraps fs.ErrNotExist
+// when there is none.
+func Find(path string) (string, *Codec, error) {
+	for _, c := range Codecs {
+		info, err := os.Stat(path + c.Ext)
+
+		switch {
+		case err == nil && info.Mode().IsRegular():
+			return path + c.Ext, c, nil
+		case err != nil && !errors.Is(err, fs.ErrNotExist):
+			return "", nil, err
+		}
+	}
+
+	return "", nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+}
@@ -0,0 +1,172 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+func writeCompressed(t *testing.T, path string, codec *Codec, content []byte) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	w, err := codec.NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write(content); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	content := bytes.Repeat([]byte("firmware"), 10000)
+
+	for _, codec := range Codecs {
+		t.Run(codec.Name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fw.bin"+codec.Ext)
+			writeCompressed(t, path, codec, content)
+
+			r, err := Open(path, codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer r.Close()
+
+			if _, err := r.Seek(8, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := r.Seek(8, io.SeekCurrent); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := r.Seek(0, io.SeekStart); !errors.Is(err, utils.ErrNotSeekable) {
+				t.Fatalf("expected ErrNotSeekable, got %v", err)
+			}
+
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, content[16:]) {
+				t.Fatalf("read %d bytes, expected %d", len(got), len(content)-16)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fw.bin")
+
+	if _, _, err := Find(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	writeCompressed(t, path+".zst", Zstd, []byte("zstd"))
+
+	if found, codec, err := Find(path); err != nil || found != path+".zst" || codec != Zstd {
+		t.Fatalf("found %s %v %v", found, codec, err)
+	}
+
+	// gzip comes first
+	writeCompressed(t, path+".gz", Gzip, []byte("gzip"))
+
+	if found, codec, err := Find(path); err != nil || found != path+".gz" || codec != Gzip {
+		t.Fatalf("found %s %v %v", found, codec, err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for name, want := range map[string]*Codec{"": nil, "none": nil, "gzip": Gzip, "zstd": Zstd} {
+		if c, err := Parse(name); err != nil || c != want {
+			t.Fatalf("Parse(%q) = %v, %v", name, c, err)
+		}
+	}
+
+	if _, err := Parse("lz4"); err == nil {
+		t.Fatal("expected an error for an unknown compression")
+	}
+}
+
+func TestSizeIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fw.bin.gz")
+	writeCompressed(t, path, Gzip, make([]byte, 12345))
+
+	s := NewSizeIndex()
+
+	for range 3 {
+		size, err := s.Size(path, Gzip)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if size != 12345 {
+			t.Fatalf("got size %d, expected 12345", size)
+		}
+	}
+
+	if s.computed != 1 {
+		t.Fatalf("size computed %d times, expected once", s.computed)
+	}
+
+	writeCompressed(t, path, Gzip, make([]byte, 100))
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if size, err := s.Size(path, Gzip); err != nil || size != 100 {
+		t.Fatalf("got size %d %v after the file changed, expected 100", size, err)
+	}
+}
+
+func TestSizeIndexConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fw.bin.zst")
+	writeCompressed(t, path, Zstd, make([]byte, 1<<22))
+
+	s := NewSizeIndex()
+
+	var wg sync.WaitGroup
+
+	for range 8 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if size, err := s.Size(path, Zstd); err != nil || size != 1<<22 {
+				t.Errorf("got size %d %v, expected %d", size, err, 1<<22)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if s.computed != 1 {
+		t.Fatalf("size computed %d times by concurrent lookups, expected once", s.computed)
+	}
+}
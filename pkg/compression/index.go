@@ -0,0 +1,95 @@
+package compression
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// SizeIndex remembers the decompressed size of files, computing it reads the
+// whole file. Entries are dropped when the compressed file changes, the
+// concurrent lookups of a file wait for a single computation.
+type SizeIndex struct {
+	mu      sync.Mutex
+	entries map[string]sizeEntry
+	pending map[string]*sizeCall
+	// computed counts the files decompressed to find their size
+	computed int
+}
+
+type sizeEntry struct {
+	modTime time.Time
+	size    int64
+	// uncompressed is the size of the content
+	uncompressed int64
+}
+
+// sizeCall is a computation in progress, done is closed once n and err are
+// set.
+type sizeCall struct {
+	done    chan struct{}
+	modTime time.Time
+	size    int64
+	n       int64
+	err     error
+}
+
+func NewSizeIndex() *SizeIndex {
+	return &SizeIndex{entries: make(map[string]sizeEntry), pending: make(map[string]*sizeCall)}
+}
+
+// Size returns the decompressed size of path.
+func (s *SizeIndex) Size(path string, codec *Codec) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+
+	if e, ok := s.entries[path]; ok && e.modTime.Equal(info.ModTime()) && e.size == info.Size() {
+		s.mu.Unlock()
+
+		return e.uncompressed, nil
+	}
+
+	if c, ok := s.pending[path]; ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		s.mu.Unlock()
+		<-c.done
+
+		return c.n, c.err
+	}
+
+	c := &sizeCall{done: make(chan struct{}), modTime: info.ModTime(), size: info.Size()}
+	s.pending[path] = c
+	s.mu.Unlock()
+
+	c.n, c.err = decompressedSize(path, codec)
+
+	s.mu.Lock()
+	if s.pending[path] == c {
+		delete(s.pending, path)
+	}
+
+	if c.err == nil {
+		s.entries[path] = sizeEntry{modTime: c.modTime, size: c.size, uncompressed: c.n}
+		s.computed++
+	}
+	s.mu.Unlock()
+
+	close(c.done)
+
+	return c.n, c.err
+}
+
+func decompressedSize(path string, codec *Codec) (int64, error) {
+	r, err := Open(path, codec)
+	if err != nil {
+		return 0, err
+	}
+
+	defer r.Close()
+
+	return io.Copy(io.Discard, r)
+}
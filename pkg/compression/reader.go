@@ -0,0 +1,38 @@
+package compression
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+// Reader streams the decompressed content of a file, it seeks forward by
+// decompressing and offsets relative to the end are not supported.
+type Reader struct {
+	utils.ForwardSeeker
+	f *os.File
+	r io.ReadCloser
+}
+
+// Open decompresses path with codec while it is read.
+func Open(path string, codec *Codec) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := codec.NewReader(f)
+	if err != nil {
+		f.Close()
+
+		return nil, err
+	}
+
+	return &Reader{ForwardSeeker: utils.NewForwardSeeker(r, -1), f: f, r: r}, nil
+}
+
+func (r *Reader) Close() error {
+	return errors.Join(r.r.Close(), r.f.Close())
+}
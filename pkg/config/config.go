@@ -0,0 +1,596 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/backoff"
+	"github.com/Wa4h1h/go-tftp/pkg/compression"
+	"github.com/Wa4h1h/go-tftp/pkg/proxy"
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+type Audit struct {
+	Path       string `yaml:"path"`
+	MaxSize    uint   `yaml:"max_size"`
+	MaxBackups uint   `yaml:"max_backups"`
+}
+
+type Proxy struct {
+	Routes   Routes `yaml:"routes"`
+	CacheDir string `yaml:"cache_dir"`
+	Timeout  uint   `yaml:"timeout"`
+}
+
+// Routes maps the filename prefixes proxied to the base url of their
+// upstream.
+type Routes map[string]string
+
+func (r *Routes) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		routes, err := parseRoutes(n.Value)
+		if err != nil {
+			return err
+		}
+
+		*r = routes
+
+		return nil
+	}
+
+	var m map[string]string
+
+	if err := n.Decode(&m); err != nil {
+		return err
+	}
+
+	*r = m
+
+	return nil
+}
+
+// parseRoutes parses comma separated prefix=url pairs.
+func parseRoutes(val string) (Routes, error) {
+	routes := make(Routes)
+
+	for _, pair := range strings.Split(val, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		prefix, u, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("%q is not a prefix=url pair", pair)
+		}
+
+		routes[strings.TrimSpace(prefix)] = strings.TrimSpace(u)
+	}
+
+	return routes, nil
+}
+
+type Relay struct {
+	Routes  RelayRoutes `yaml:"routes"`
+	Timeout uint        `yaml:"timeout"`
+}
+
+// RelayRoute forwards the files below Prefix to the tftp server at Upstream,
+// an empty prefix forwards every file. Timeout overrides the timeout of the
+// relay for this upstream.
+type RelayRoute struct {
+	Prefix   string `yaml:"prefix"`
+	Upstream string `yaml:"upstream"`
+	Timeout  uint   `yaml:"timeout"`
+}
+
+type RelayRoutes []RelayRoute
+
+func (r *RelayRoutes) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		routes, err := parseRelayRoutes(n.Value)
+		if err != nil {
+			return err
+		}
+
+		*r = routes
+
+		return nil
+	}
+
+	var list []RelayRoute
+
+	if err := n.Decode(&list); err != nil {
+		return err
+	}
+
+	*r = list
+
+	return nil
+}
+
+// parseRelayRoutes parses comma separated prefix=host:port pairs, the
+// upstream can be followed by @ and its timeout in seconds.
+func parseRelayRoutes(val string) (RelayRoutes, error) {
+	var routes RelayRoutes
+
+	for _, pair := range strings.Split(val, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		prefix, upstream, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("%q is not a prefix=host:port pair", pair)
+		}
+
+		route := RelayRoute{Prefix: strings.TrimSpace(prefix), Upstream: strings.TrimSpace(upstream)}
+
+		if upstream, timeout, found := strings.Cut(route.Upstream, "@"); found {
+			route.Upstream = upstream
+
+			if err := setUint(&route.Timeout, timeout); err != nil {
+				return nil, err
+			}
+		}
+
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
+
+type Addresses []string
+
+func (a *Addresses) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*a = splitAddresses(n.Value)
+
+		return nil
+	}
+
+	var list []string
+
+	if err := n.Decode(&list); err != nil {
+		return err
+	}
+
+	*a = list
+
+	return nil
+}
+
+func (a Addresses) String() string {
+	return strings.Join(a, ",")
+}
+
+func splitAddresses(val string) Addresses {
+	var a Addresses
+
+	for _, addr := range strings.Split(val, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			a = append(a, addr)
+		}
+	}
+
+	return a
+}
+
+type Server struct {
+	Address      Addresses `yaml:"address"`
+	Port         string    `yaml:"port"`
+	LogLevel     string    `yaml:"log_level"`
+	BaseDir      string    `yaml:"base_dir"`
+	Audit        Audit     `yaml:"audit"`
+	Proxy        Proxy     `yaml:"proxy"`
+	Relay        Relay     `yaml:"relay"`
+	ReadTimeout  uint      `yaml:"read_timeout"`
+	WriteTimeout uint      `yaml:"write_timeout"`
+	NumTries     uint      `yaml:"num_tries"`
+	Backoff      string    `yaml:"backoff"`
+	MinRTO       uint      `yaml:"rto_min_ms"`
+	MaxRTO       uint      `yaml:"rto_max_ms"`
+	ReadAhead    uint      `yaml:"read_ahead"`
+	Mmap         bool      `yaml:"mmap"`
+	CacheSize    uint      `yaml:"cache_size_mb"`
+	Archives     bool      `yaml:"archives"`
+	Compression  string    `yaml:"compress_uploads"`
+	Trace        bool      `yaml:"trace"`
+
+	sources map[string]string
+}
+
+// maxReadAhead bounds the blocks read in advance per transfer, up to 64MiB
+// with the largest block size.
+const maxReadAhead = 1024
+
+// maxCacheSize bounds the memory budget of the file cache in MB.
+const maxCacheSize = 1 << 20
+
+type FieldError struct {
+	Source string
+	Field  string
+	Msg    string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Source, e.Field, e.Msg)
+}
+
+type field struct {
+	key string
+	env string
+	set func(c *Server, val string) error
+}
+
+var fields = []field{
+	{"address", "TFTP_ADDRESS", func(c *Server, v string) error { c.Address = splitAddresses(v); return nil }},
+	{"port", "TFTP_PORT", func(c *Server, v string) error { c.Port = v; return nil }},
+	{"log_level", "TFTP_LOG_LEVEL", func(c *Server, v string) error { c.LogLevel = v; return nil }},
+	{"read_timeout", "TFTP_READ_TIMEOUT", func(c *Server, v string) error { return setUint(&c.ReadTimeout, v) }},
+	{"write_timeout", "TFTP_WRITE_TIMEOUT", func(c *Server, v string) error { return setUint(&c.WriteTimeout, v) }},
+	{"num_tries", "TFTP_NUM_TRIES", func(c *Server, v string) error { return setUint(&c.NumTries, v) }},
+	{"backoff", "TFTP_BACKOFF", func(c *Server, v string) error { c.Backoff = v; return nil }},
+	{"rto_min_ms", "TFTP_RTO_MIN_MS", func(c *Server, v string) error { return setUint(&c.MinRTO, v) }},
+	{"rto_max_ms", "TFTP_RTO_MAX_MS", func(c *Server, v string) error { return setUint(&c.MaxRTO, v) }},
+	{"read_ahead", "TFTP_READ_AHEAD", func(c *Server, v string) error { return setUint(&c.ReadAhead, v) }},
+	{"mmap", "TFTP_MMAP", func(c *Server, v string) error { return setBool(&c.Mmap, v) }},
+	{"cache_size_mb", "TFTP_CACHE_SIZE_MB", func(c *Server, v string) error { return setUint(&c.CacheSize, v) }},
+	{"archives", "TFTP_ARCHIVES", func(c *Server, v string) error { return setBool(&c.Archives, v) }},
+	{"compress_uploads", "TFTP_COMPRESS_UPLOADS", func(c *Server, v string) error { c.Compression = v; return nil }},
+	{"base_dir", "TFTP_BASE_DIR", func(c *Server, v string) error { c.BaseDir = v; return nil }},
+	{"trace", "TFTP_TRACE", func(c *Server, v string) error { return setBool(&c.Trace, v) }},
+	{"audit.path", "TFTP_AUDIT_LOG", func(c *Server, v string) error { c.Audit.Path = v; return nil }},
+	{"audit.max_size", "TFTP_AUDIT_LOG_MAX_SIZE", func(c *Server, v string) error { return setUint(&c.Audit.MaxSize, v) }},
+	{"audit.max_backups", "TFTP_AUDIT_LOG_MAX_BACKUPS", func(c *Server, v string) error {
+		return setUint(&c.Audit.MaxBackups, v)
+	}},
+	{"proxy.routes", "TFTP_PROXY_ROUTES", func(c *Server, v string) error {
+		routes, err := parseRoutes(v)
+		c.Proxy.Routes = routes
+
+		return err
+	}},
+	{"proxy.cache_dir", "TFTP_PROXY_CACHE_DIR", func(c *Server, v string) error { c.Proxy.CacheDir = v; return nil }},
+	{"proxy.timeout", "TFTP_PROXY_TIMEOUT", func(c *Server, v string) error { return setUint(&c.Proxy.Timeout, v) }},
+	{"relay.routes", "TFTP_RELAY_ROUTES", func(c *Server, v string) error {
+		routes, err := parseRelayRoutes(v)
+		c.Relay.Routes = routes
+
+		return err
+	}},
+	{"relay.timeout", "TFTP_RELAY_TIMEOUT", func(c *Server, v string) error { return setUint(&c.Relay.Timeout, v) }},
+}
+
+func setUint(dst *uint, val string) error {
+	v, err := strconv.ParseUint(val, 10, 32)
+	if err != nil {
+		return fmt.Errorf("%q is not an unsigned integer", val)
+	}
+
+	*dst = uint(v)
+
+	return nil
+}
+
+func setBool(dst *bool, val string) error {
+	v, err := strconv.ParseBool(val)
+	if err != nil {
+		return fmt.Errorf("%q is not a boolean", val)
+	}
+
+	*dst = v
+
+	return nil
+}
+
+func DefaultBaseDir() string {
+	p, err := os.UserHomeDir()
+	if err != nil {
+		return "tftp"
+	}
+
+	return filepath.Join(p, "tftp")
+}
+
+func Default() *Server {
+	return &Server{
+		Port:         "69",
+		LogLevel:     "debug",
+		ReadTimeout:  5,
+		WriteTimeout: 5,
+		NumTries:     5,
+		Backoff:      backoff.NameFixed,
+		MinRTO:       200,
+		ReadAhead:    8,
+		BaseDir:      DefaultBaseDir(),
+		Trace:        true,
+		Audit: Audit{
+			MaxSize:    100,
+			MaxBackups: 5,
+		},
+		Proxy: Proxy{
+			Timeout: 10,
+		},
+		Relay: Relay{
+			Timeout: 5,
+		},
+		sources: make(map[string]string),
+	}
+}
+
+// BackoffPolicy returns the retransmission policy of a validated
+// configuration.
+func (c *Server) BackoffPolicy() backoff.Policy {
+	p, err := backoff.Parse(c.Backoff)
+	if err != nil {
+		return backoff.Fixed{}
+	}
+
+	return p
+}
+
+// UploadCodec returns the compression of uploads of a validated
+// configuration, nil when they are stored as received.
+func (c *Server) UploadCodec() *compression.Codec {
+	codec, err := compression.Parse(c.Compression)
+	if err != nil {
+		return nil
+	}
+
+	return codec
+}
+
+// UpstreamProxy returns the proxy of a validated configuration, nil when no
+// route is configured.
+func (c *Server) UpstreamProxy() (*proxy.Proxy, error) {
+	if len(c.Proxy.Routes) == 0 {
+		return nil, nil
+	}
+
+	return proxy.New(c.Proxy.Routes, c.Proxy.CacheDir, time.Duration(c.Proxy.Timeout)*time.Second)
+}
+
+// RouteTimeout returns the seconds to wait for a packet of the upstream of r,
+// the timeout of the relay when r does not override it.
+func (c *Server) RouteTimeout(r RelayRoute) time.Duration {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = c.Relay.Timeout
+	}
+
+	return time.Duration(timeout) * time.Second
+}
+
+// RTO returns the bounds of the adaptive retransmission timeout.
+func (c *Server) RTO() (time.Duration, time.Duration) {
+	return time.Duration(c.MinRTO) * time.Millisecond, time.Duration(c.MaxRTO) * time.Millisecond
+}
+
+func (c *Server) source(key string) string {
+	if s, ok := c.sources[key]; ok {
+		return s
+	}
+
+	return "default"
+}
+
+func (c *Server) IsDefault(key string) bool {
+	_, ok := c.sources[key]
+
+	return !ok
+}
+
+func (c *Server) Set(key, val, source string) error {
+	for _, f := range fields {
+		if f.key != key {
+			continue
+		}
+
+		if err := f.set(c, val); err != nil {
+			return &FieldError{Source: source, Field: key, Msg: err.Error()}
+		}
+
+		c.sources[key] = source
+
+		return nil
+	}
+
+	return &FieldError{Source: source, Field: key, Msg: "unknown setting"}
+}
+
+func (c *Server) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error while reading config file: %w", err)
+	}
+
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if len(doc.Content) > 0 {
+		recordLines(c.sources, path, "", doc.Content[0])
+	}
+
+	return nil
+}
+
+func recordLines(sources map[string]string, path string, prefix string, n *yaml.Node) {
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key := prefix + n.Content[i].Value
+		sources[key] = fmt.Sprintf("%s:%d", path, n.Content[i].Line)
+
+		recordLines(sources, path, key+".", n.Content[i+1])
+	}
+}
+
+func (c *Server) loadEnv() error {
+	var errs []error
+
+	for _, f := range fields {
+		if val, ok := os.LookupEnv(f.env); ok {
+			errs = append(errs, c.Set(f.key, val, "env "+f.env))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Server) Validate() error {
+	var errs []error
+
+	invalid := func(key, msg string) {
+		errs = append(errs, &FieldError{Source: c.source(key), Field: key, Msg: msg})
+	}
+
+	for _, addr := range c.Address {
+		if net.ParseIP(strings.SplitN(addr, "%", 2)[0]) != nil {
+			continue
+		}
+
+		if _, err := net.InterfaceByName(addr); err != nil {
+			invalid("address", fmt.Sprintf("%q is neither an ip address nor an interface", addr))
+		}
+	}
+
+	if port, err := strconv.ParseUint(c.Port, 10, 16); err != nil || port == 0 {
+		invalid("port", fmt.Sprintf("%q is not a valid port", c.Port))
+	}
+
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "error":
+	default:
+		invalid("log_level", fmt.Sprintf("%q is not one of debug, info, warn, error", c.LogLevel))
+	}
+
+	if c.ReadTimeout == 0 {
+		invalid("read_timeout", "must be greater than 0")
+	}
+
+	if c.WriteTimeout == 0 {
+		invalid("write_timeout", "must be greater than 0")
+	}
+
+	if c.NumTries == 0 {
+		invalid("num_tries", "must be greater than 0")
+	}
+
+	if _, err := backoff.Parse(c.Backoff); err != nil {
+		invalid("backoff", err.Error())
+	}
+
+	if c.MaxRTO != 0 && c.MaxRTO < c.MinRTO {
+		invalid("rto_max_ms", "must not be lower than rto_min_ms")
+	}
+
+	if c.ReadAhead > maxReadAhead {
+		invalid("read_ahead", fmt.Sprintf("must not exceed %d blocks", maxReadAhead))
+	}
+
+	if c.CacheSize > maxCacheSize {
+		invalid("cache_size_mb", fmt.Sprintf("must not exceed %d", maxCacheSize))
+	}
+
+	if _, err := compression.Parse(c.Compression); err != nil {
+		invalid("compress_uploads", err.Error())
+	}
+
+	for prefix, u := range c.Proxy.Routes {
+		if strings.Trim(prefix, "/") == "" {
+			invalid("proxy.routes", "prefixes must not be empty")
+		}
+
+		if _, err := proxy.ParseUpstream(u); err != nil {
+			invalid("proxy.routes", err.Error())
+		}
+	}
+
+	if c.Proxy.Timeout == 0 {
+		invalid("proxy.timeout", "must be greater than 0")
+	}
+
+	prefixes := make(map[string]bool)
+
+	for _, r := range c.Relay.Routes {
+		prefix := strings.Trim(r.Prefix, "/")
+		if prefixes[prefix] {
+			invalid("relay.routes", fmt.Sprintf("prefix %q is routed twice", prefix))
+		}
+
+		prefixes[prefix] = true
+
+		if _, _, err := net.SplitHostPort(r.Upstream); err != nil {
+			invalid("relay.routes", err.Error())
+		}
+
+		if r.Timeout > types.MaxTimeout {
+			invalid("relay.routes", fmt.Sprintf("timeout of %s must not exceed %d", r.Upstream, types.MaxTimeout))
+		}
+	}
+
+	if c.Relay.Timeout == 0 || c.Relay.Timeout > types.MaxTimeout {
+		invalid("relay.timeout", fmt.Sprintf("must be between 1 and %d", types.MaxTimeout))
+	}
+
+	if c.Proxy.CacheDir != "" {
+		if info, err := os.Stat(c.Proxy.CacheDir); err != nil {
+			invalid("proxy.cache_dir", err.Error())
+		} else if !info.IsDir() {
+			invalid("proxy.cache_dir", fmt.Sprintf("%s is not a directory", c.Proxy.CacheDir))
+		}
+	}
+
+	if info, err := os.Stat(c.BaseDir); err != nil {
+		invalid("base_dir", err.Error())
+	} else if !info.IsDir() {
+		invalid("base_dir", fmt.Sprintf("%s is not a directory", c.BaseDir))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Load builds the server configuration from the defaults, the config file at
+// path (if any), the environment and finally the command line overrides.
+func Load(path string, o *Overrides) (*Server, error) {
+	c := Default()
+
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if o != nil {
+		if err := o.apply(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
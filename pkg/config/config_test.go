@@ -0,0 +1,154 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tftp.yaml")
+
+	content := "port: \"1069\"\nbase_dir: " + dir + "\nread_timeout: 0\nnum_tries: 3\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TFTP_NUM_TRIES", "7")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	o := RegisterFlags(fs)
+
+	if err := fs.Parse([]string{"-port", "2069", "-trace=false"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load(path, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Port != "2069" || c.NumTries != 7 || c.Trace || c.BaseDir != dir {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+
+	err = c.Validate()
+
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) {
+		t.Fatalf("expected a field error, got %v", err)
+	}
+
+	if fieldErr.Field != "read_timeout" || fieldErr.Source != path+":3" {
+		t.Fatalf("unexpected field error: %v", fieldErr)
+	}
+}
+
+func TestProxyRoutes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tftp.yaml")
+
+	content := "base_dir: " + dir + "\nproxy:\n  routes:\n    artifacts: http://artifacts.internal/pxe\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Proxy.Routes["artifacts"] != "http://artifacts.internal/pxe" {
+		t.Fatalf("unexpected routes: %v", c.Proxy.Routes)
+	}
+
+	t.Setenv("TFTP_PROXY_ROUTES", "a=http://a, b=ftp://b")
+
+	c, err = Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.Proxy.Routes) != 2 || c.Proxy.Routes["a"] != "http://a" {
+		t.Fatalf("unexpected routes: %v", c.Proxy.Routes)
+	}
+
+	var fieldErr *FieldError
+	if err := c.Validate(); !errors.As(err, &fieldErr) || fieldErr.Field != "proxy.routes" {
+		t.Fatalf("expected a proxy.routes error, got %v", err)
+	}
+}
+
+func TestRelayRoutes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tftp.yaml")
+
+	content := "base_dir: " + dir + "\nrelay:\n  timeout: 3\n  routes:\n" +
+		"    - prefix: pxe\n      upstream: 10.0.0.1:69\n      timeout: 1\n" +
+		"    - upstream: 10.0.0.2:69\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := RelayRoutes{{Prefix: "pxe", Upstream: "10.0.0.1:69", Timeout: 1}, {Upstream: "10.0.0.2:69"}}
+	if !slices.Equal(c.Relay.Routes, expected) || c.Relay.Timeout != 3 {
+		t.Fatalf("unexpected relay: %+v", c.Relay)
+	}
+
+	// routes without a timeout wait for the timeout of the relay
+	if c.RouteTimeout(c.Relay.Routes[0]) != time.Second || c.RouteTimeout(c.Relay.Routes[1]) != 3*time.Second {
+		t.Fatalf("unexpected route timeouts: %+v", c.Relay)
+	}
+
+	t.Setenv("TFTP_RELAY_ROUTES", "pxe=10.0.0.1:69@2, pxe=10.0.0.2")
+
+	c, err = Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = RelayRoutes{{Prefix: "pxe", Upstream: "10.0.0.1:69", Timeout: 2}, {Prefix: "pxe", Upstream: "10.0.0.2"}}
+	if !slices.Equal(c.Relay.Routes, expected) {
+		t.Fatalf("unexpected routes: %+v", c.Relay.Routes)
+	}
+
+	var fieldErr *FieldError
+	if err := c.Validate(); !errors.As(err, &fieldErr) || fieldErr.Field != "relay.routes" {
+		t.Fatalf("expected a relay.routes error, got %v", err)
+	}
+}
+
+func TestCompressUploadsNone(t *testing.T) {
+	dir := t.TempDir()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	o := RegisterFlags(fs)
+
+	// the default shown by the help is accepted
+	if err := fs.Parse([]string{"-base-dir", dir, "-compress-uploads", "none"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load("", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.UploadCodec() != nil {
+		t.Fatalf("uploads compressed with %s", c.UploadCodec().Name)
+	}
+}
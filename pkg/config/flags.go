@@ -0,0 +1,93 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+type Overrides struct {
+	values map[string]string
+	order  []string
+}
+
+type override struct {
+	o      *Overrides
+	key    string
+	isBool bool
+}
+
+func (v *override) String() string {
+	return ""
+}
+
+func (v *override) Set(val string) error {
+	if _, ok := v.o.values[v.key]; !ok {
+		v.o.order = append(v.o.order, v.key)
+	}
+
+	v.o.values[v.key] = val
+
+	return nil
+}
+
+func (v *override) IsBoolFlag() bool {
+	return v.isBool
+}
+
+func FlagName(key string) string {
+	return strings.NewReplacer("_", "-", ".", "-").Replace(key)
+}
+
+func RegisterFlags(fs *flag.FlagSet) *Overrides {
+	o := &Overrides{values: make(map[string]string)}
+	d := Default()
+
+	defaults := map[string]string{
+		"address":           "all interfaces",
+		"port":              d.Port,
+		"log_level":         d.LogLevel,
+		"read_timeout":      fmt.Sprint(d.ReadTimeout),
+		"write_timeout":     fmt.Sprint(d.WriteTimeout),
+		"num_tries":         fmt.Sprint(d.NumTries),
+		"backoff":           d.Backoff,
+		"rto_min_ms":        fmt.Sprint(d.MinRTO),
+		"read_ahead":        fmt.Sprint(d.ReadAhead),
+		"mmap":              fmt.Sprint(d.Mmap),
+		"cache_size_mb":     fmt.Sprint(d.CacheSize),
+		"archives":          fmt.Sprint(d.Archives),
+		"compress_uploads":  "none",
+		"base_dir":          d.BaseDir,
+		"trace":             fmt.Sprint(d.Trace),
+		"audit.max_size":    fmt.Sprint(d.Audit.MaxSize),
+		"audit.max_backups": fmt.Sprint(d.Audit.MaxBackups),
+		"proxy.timeout":     fmt.Sprint(d.Proxy.Timeout),
+		"relay.timeout":     fmt.Sprint(d.Relay.Timeout),
+	}
+
+	for _, f := range fields {
+		usage := fmt.Sprintf("overrides %s and $%s", f.key, f.env)
+		if def, ok := defaults[f.key]; ok {
+			usage = fmt.Sprintf("%s (default %s)", usage, def)
+		}
+
+		fs.Var(&override{o: o, key: f.key, isBool: isBool(f.key)}, FlagName(f.key), usage)
+	}
+
+	return o
+}
+
+func isBool(key string) bool {
+	return key == "trace" || key == "mmap" || key == "archives"
+}
+
+func (o *Overrides) apply(c *Server) error {
+	var errs []error
+
+	for _, key := range o.order {
+		errs = append(errs, c.Set(key, o.values[key], "flag -"+FlagName(key)))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,361 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const maxHistory = 1000
+
+// Completer returns the candidates completing word, the word before the
+// cursor. first is set when word is the first word of the line.
+type Completer func(word string, first bool) []string
+
+// Editor reads lines from a terminal with emacs style editing, history and
+// completion. Input that is not a terminal is read line by line.
+type Editor struct {
+	in          *os.File
+	out         io.Writer
+	r           *bufio.Reader
+	complete    Completer
+	history     []string
+	historyPath string
+}
+
+// New returns an editor on stdin and stdout, the history is loaded from and
+// saved to historyPath unless it is empty.
+func New(historyPath string, complete Completer) *Editor {
+	e := &Editor{
+		in:          os.Stdin,
+		out:         os.Stdout,
+		r:           bufio.NewReader(os.Stdin),
+		complete:    complete,
+		historyPath: historyPath,
+	}
+
+	if historyPath != "" {
+		if b, err := os.ReadFile(historyPath); err == nil {
+			for _, line := range strings.Split(string(b), "\n") {
+				if line != "" {
+					e.history = append(e.history, line)
+				}
+			}
+		}
+	}
+
+	return e
+}
+
+// ReadLine prints prompt and returns the next line without its line ending.
+// It returns io.EOF once the input is exhausted or Ctrl-D is typed on an
+// empty line.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+
+	restore, err := makeRaw(e.in)
+	if err != nil {
+		// not a terminal
+		line, err := e.r.ReadString('\n')
+		if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+			return "", err
+		}
+
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	defer restore()
+
+	line, err := e.edit(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	e.addHistory(line)
+
+	return line, nil
+}
+
+func (e *Editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+
+	if e.historyPath == "" {
+		return
+	}
+
+	f, err := os.OpenFile(e.historyPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	fmt.Fprintln(f, line)
+}
+
+const (
+	keyCtrlA     = 0x01
+	keyCtrlB     = 0x02
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyCtrlF     = 0x06
+	keyBackspace = 0x08
+	keyTab       = 0x09
+	keyLF        = 0x0a
+	keyCtrlK     = 0x0b
+	keyCR        = 0x0d
+	keyCtrlN     = 0x0e
+	keyCtrlP     = 0x10
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyEscape    = 0x1b
+	keyDelete    = 0x7f
+)
+
+// state is the line being edited.
+type state struct {
+	prompt string
+	line   []rune
+	pos    int
+	// index in the history, len(history) is the line being typed
+	index int
+	typed []rune
+}
+
+// edit processes the keys typed until the line is accepted.
+func (e *Editor) edit(prompt string) (string, error) {
+	s := &state{prompt: prompt, index: len(e.history)}
+	tabs := 0
+
+	for {
+		r, _, err := e.r.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		if r == keyTab {
+			tabs++
+			e.tab(s, tabs > 1)
+
+			continue
+		}
+
+		tabs = 0
+
+		switch r {
+		case keyCR, keyLF:
+			fmt.Fprint(e.out, "\r\n")
+
+			return string(s.line), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+
+			return "", nil
+		case keyCtrlD:
+			if len(s.line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+
+				return "", io.EOF
+			}
+
+			s.delete(s.pos)
+		case keyBackspace, keyDelete:
+			if s.pos > 0 {
+				s.pos--
+				s.delete(s.pos)
+			}
+		case keyCtrlA:
+			s.pos = 0
+		case keyCtrlE:
+			s.pos = len(s.line)
+		case keyCtrlB:
+			s.pos = max(s.pos-1, 0)
+		case keyCtrlF:
+			s.pos = min(s.pos+1, len(s.line))
+		case keyCtrlK:
+			s.line = s.line[:s.pos]
+		case keyCtrlU:
+			s.line = s.line[s.pos:]
+			s.pos = 0
+		case keyCtrlW:
+			start := s.pos
+			for start > 0 && s.line[start-1] == ' ' {
+				start--
+			}
+
+			for start > 0 && s.line[start-1] != ' ' {
+				start--
+			}
+
+			s.line = append(s.line[:start], s.line[s.pos:]...)
+			s.pos = start
+		case keyCtrlP:
+			e.recall(s, -1)
+		case keyCtrlN:
+			e.recall(s, 1)
+		case keyEscape:
+			if err := e.escape(s); err != nil {
+				return "", err
+			}
+		default:
+			if unicode.IsPrint(r) {
+				s.line = append(s.line[:s.pos], append([]rune{r}, s.line[s.pos:]...)...)
+				s.pos++
+			}
+		}
+
+		e.redraw(s)
+	}
+}
+
+// escape handles the ANSI sequences of the arrow, home, end and delete keys.
+func (e *Editor) escape(s *state) error {
+	b, err := e.r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	if b != '[' && b != 'O' {
+		return nil
+	}
+
+	var seq []byte
+
+	for {
+		c, err := e.r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		seq = append(seq, c)
+		if c >= 0x40 && c <= 0x7e {
+			break
+		}
+	}
+
+	switch string(seq) {
+	case "A":
+		e.recall(s, -1)
+	case "B":
+		e.recall(s, 1)
+	case "C":
+		s.pos = min(s.pos+1, len(s.line))
+	case "D":
+		s.pos = max(s.pos-1, 0)
+	case "H", "1~":
+		s.pos = 0
+	case "F", "4~":
+		s.pos = len(s.line)
+	case "3~":
+		if s.pos < len(s.line) {
+			s.delete(s.pos)
+		}
+	}
+
+	return nil
+}
+
+func (s *state) delete(i int) {
+	if i < len(s.line) {
+		s.line = append(s.line[:i], s.line[i+1:]...)
+	}
+}
+
+// recall moves by delta in the history, the typed line is kept when leaving
+// it.
+func (e *Editor) recall(s *state, delta int) {
+	index := s.index + delta
+	if index < 0 || index > len(e.history) {
+		return
+	}
+
+	if s.index == len(e.history) {
+		s.typed = s.line
+	}
+
+	s.index = index
+
+	if index == len(e.history) {
+		s.line = s.typed
+	} else {
+		s.line = []rune(e.history[index])
+	}
+
+	s.pos = len(s.line)
+}
+
+// tab completes the word before the cursor, candidates are listed when the
+// completion is ambiguous and list is set.
+func (e *Editor) tab(s *state, list bool) {
+	if e.complete == nil {
+		return
+	}
+
+	start := s.pos
+	for start > 0 && s.line[start-1] != ' ' {
+		start--
+	}
+
+	word := string(s.line[start:s.pos])
+	first := strings.TrimSpace(string(s.line[:start])) == ""
+	candidates := e.complete(word, first)
+
+	switch {
+	case len(candidates) == 0:
+		return
+	case len(candidates) == 1:
+		completion := candidates[0]
+		if !strings.HasSuffix(completion, "/") {
+			completion += " "
+		}
+
+		s.insert(start, completion)
+	default:
+		if prefix := commonPrefix(candidates); len(prefix) > len(word) {
+			s.insert(start, prefix)
+		} else if list {
+			fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+		}
+	}
+
+	e.redraw(s)
+}
+
+// insert replaces the word from start to the cursor with word.
+func (s *state) insert(start int, word string) {
+	rest := append([]rune(word), s.line[s.pos:]...)
+	s.line = append(s.line[:start], rest...)
+	s.pos = start + len([]rune(word))
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	return prefix
+}
+
+func (e *Editor) redraw(s *state) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", s.prompt, string(s.line))
+
+	if back := len(s.line) - s.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
@@ -0,0 +1,56 @@
+package lineedit
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEdit(t *testing.T) {
+	complete := func(word string, first bool) []string {
+		if first {
+			return nil
+		}
+
+		var matches []string
+
+		for _, f := range []string{"initrd.img", "images/", "vmlinuz"} {
+			if strings.HasPrefix(f, word) {
+				matches = append(matches, f)
+			}
+		}
+
+		return matches
+	}
+
+	tests := map[string]string{
+		"get vmlinuz\r":                       "get vmlinuz",
+		"get vmlinux\x7fz\r":                  "get vmlinuz",
+		"put a\x01\x1b[3~\x1b[3~\x1b[3~get\r": "get a",
+		"get vm\t\r":                          "get vmlinuz ",
+		"get i\tn\t\r":                        "get initrd.img ",
+		"get foo bar\x17\x17vm\t\r":           "get vmlinuz ",
+		"\x1b[A\x1b[A\r":                      "put initrd.img",
+		"\x10\x10\x0e\r":                      "get pxelinux.0",
+		"junk\x15get x\x1b[D\x0bz\r":          "get z",
+	}
+
+	for keys, expected := range tests {
+		e := &Editor{
+			out:      io.Discard,
+			r:        bufio.NewReader(strings.NewReader(keys)),
+			complete: complete,
+			history:  []string{"put initrd.img", "get pxelinux.0"},
+		}
+
+		line, err := e.edit("tftp> ")
+		if err != nil {
+			t.Fatalf("%q: %s", keys, err.Error())
+		}
+
+		if line != expected {
+			t.Fatalf("%q: got %q, expected %q", keys, line, expected)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package netascii
+
+import (
+	"bufio"
+	"io"
+)
+
+const (
+	cr  = '\r'
+	lf  = '\n'
+	nul = 0
+)
+
+type reader struct {
+	r       *bufio.Reader
+	pending int
+	next    byte
+}
+
+// NewReader translates local text read from r into netascii:
+// LF becomes CR LF and a bare CR becomes CR NUL.
+func NewReader(r io.Reader) io.Reader {
+	return &reader{r: bufio.NewReader(r), pending: -1}
+}
+
+func (n *reader) Read(p []byte) (int, error) {
+	i := 0
+
+	for i < len(p) {
+		if n.pending >= 0 {
+			p[i] = byte(n.pending)
+			n.pending = -1
+			i++
+
+			continue
+		}
+
+		b, err := n.r.ReadByte()
+		if err != nil {
+			if i > 0 {
+				return i, nil
+			}
+
+			return 0, err
+		}
+
+		switch b {
+		case lf:
+			p[i] = cr
+			n.pending = lf
+		case cr:
+			p[i] = cr
+			n.pending = nul
+		default:
+			p[i] = b
+		}
+
+		i++
+	}
+
+	return i, nil
+}
+
+type Writer struct {
+	w       io.Writer
+	pending bool
+}
+
+// NewWriter translates netascii written to it back into local text:
+// CR LF becomes LF and CR NUL becomes CR. Flush must be called once
+// the transfer is done to write a trailing CR.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (n *Writer) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p)+1)
+
+	for _, b := range p {
+		if n.pending {
+			n.pending = false
+
+			switch b {
+			case lf:
+				out = append(out, lf)
+
+				continue
+			case nul:
+				out = append(out, cr)
+
+				continue
+			default:
+				out = append(out, cr)
+			}
+		}
+
+		if b == cr {
+			n.pending = true
+
+			continue
+		}
+
+		out = append(out, b)
+	}
+
+	if _, err := n.w.Write(out); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (n *Writer) Flush() error {
+	if !n.pending {
+		return nil
+	}
+
+	n.pending = false
+
+	_, err := n.w.Write([]byte{cr})
+
+	return err
+}
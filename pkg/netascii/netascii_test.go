@@ -0,0 +1,40 @@
+package netascii
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	local := []byte("line one\nline\rtwo\r\n\n\r")
+	wire := []byte("line one\r\nline\r\x00two\r\x00\r\n\r\n\r\x00")
+
+	encoded, err := io.ReadAll(NewReader(bytes.NewReader(local)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(encoded, wire) {
+		t.Fatalf("encoded %q, expected %q", encoded, wire)
+	}
+
+	var decoded bytes.Buffer
+
+	w := NewWriter(&decoded)
+
+	// split the input in the middle of a CR LF pair
+	for _, chunk := range [][]byte{wire[:9], wire[9:]} {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decoded.Bytes(), local) {
+		t.Fatalf("decoded %q, expected %q", decoded.Bytes(), local)
+	}
+}
@@ -0,0 +1,201 @@
+package netsim_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/client"
+	"github.com/Wa4h1h/go-tftp/pkg/netsim"
+	"github.com/Wa4h1h/go-tftp/pkg/server"
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+	"go.uber.org/zap"
+)
+
+var scenarios = []struct {
+	name string
+	sim  func() *netsim.Sim
+}{
+	{"clean", func() *netsim.Sim { return netsim.New(1) }},
+	{"drop nth", func() *netsim.Sim { return netsim.New(1).Outgoing(netsim.DropNth(2, 3, 7)) }},
+	{"duplicate acks", func() *netsim.Sim { return netsim.New(1).Outgoing(netsim.DuplicateACKs()) }},
+	{"duplicate data", func() *netsim.Sim { return netsim.New(1).Outgoing(netsim.DuplicateData()) }},
+	{"delay data", func() *netsim.Sim {
+		// every third block is overtaken by the following ones
+		return netsim.New(1).Outgoing(netsim.Match(func(p *netsim.Packet) bool {
+			return p.Opcode == types.OpCodeDATA && p.Block%3 == 0
+		}, netsim.Action{Delay: 20 * time.Millisecond}))
+	}},
+	// TFTP has no checksum, only corrupted headers can be detected
+	{"corrupt", func() *netsim.Sim { return netsim.New(1).Outgoing(netsim.CorruptNth(4, 0), netsim.CorruptNth(6, 1)) }},
+	{"random loss", func() *netsim.Sim { return netsim.New(42).Outgoing(netsim.DropRate(0.1)) }},
+}
+
+type fixture struct {
+	dir     string
+	server  *server.Server
+	client  *client.Client
+	content []byte
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	f := &fixture{dir: t.TempDir()}
+	f.content = make([]byte, 20*512+100)
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range f.content {
+		f.content[i] = byte(rng.UintN(256))
+	}
+
+	if err := os.WriteFile(filepath.Join(f.dir, "src"), f.content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	f.server = server.NewServer(zap.NewNop().Sugar(), []string{"127.0.0.1"}, "0", 1, 1, 5, f.dir, false)
+	f.server.SetRTO(20*time.Millisecond, 200*time.Millisecond)
+
+	f.client = client.NewClient(nil, 5)
+	f.client.SetRTO(20*time.Millisecond, 200*time.Millisecond)
+
+	return f
+}
+
+func (f *fixture) start(t *testing.T) {
+	t.Helper()
+
+	if err := f.server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	go f.server.Serve()
+
+	t.Cleanup(func() { f.server.Close() })
+
+	if err := f.client.Connect(f.server.Addrs()[0].String()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// run downloads and uploads the test file and checks that both arrive intact.
+func (f *fixture) run(t *testing.T, windowSize int) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	var got bytes.Buffer
+
+	if _, err := f.client.WriteTo(ctx, "src", &got, client.WithWindowSize(windowSize)); err != nil {
+		t.Fatalf("get: %s", err.Error())
+	}
+
+	if !bytes.Equal(got.Bytes(), f.content) {
+		t.Fatalf("get: received %d bytes, expected %d", got.Len(), len(f.content))
+	}
+
+	remote := fmt.Sprintf("dst-%d", windowSize)
+
+	if _, err := f.client.Put(ctx, remote, bytes.NewReader(f.content), int64(len(f.content)),
+		client.WithWindowSize(windowSize)); err != nil {
+		t.Fatalf("put: %s", err.Error())
+	}
+
+	stored, err := os.ReadFile(filepath.Join(f.dir, remote))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(stored, f.content) {
+		t.Fatalf("put: stored %d bytes, expected %d", len(stored), len(f.content))
+	}
+}
+
+func TestConformance(t *testing.T) {
+	for _, side := range []string{"client", "server"} {
+		for _, scenario := range scenarios {
+			for _, windowSize := range []int{1, 4} {
+				name := fmt.Sprintf("%s/%s/windowsize %d", side, scenario.name, windowSize)
+
+				t.Run(name, func(t *testing.T) {
+					t.Parallel()
+
+					f := newFixture(t)
+					sim := scenario.sim()
+
+					if side == "client" {
+						f.client.SetConnWrapper(sim.Conn)
+					} else {
+						f.server.SetConnWrapper(sim.Conn)
+					}
+
+					f.start(t)
+					f.run(t, windowSize)
+
+					if stats := sim.Stats(); stats.Packets == 0 {
+						t.Fatal("no packet went through the simulator")
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestListenerLosesRequest(t *testing.T) {
+	f := newFixture(t)
+	sim := netsim.New(1).Incoming(netsim.DropNth(1))
+
+	f.server.SetListenerWrapper(func(conn net.PacketConn) net.PacketConn { return sim.PacketConn(conn) })
+	f.start(t)
+	f.run(t, 1)
+
+	if stats := sim.Stats(); stats.Dropped != 1 || stats.Packets != 3 {
+		t.Fatalf("expected the first of 3 requests to be dropped, got %+v", stats)
+	}
+}
+
+func TestTransferOverImpairedConn(t *testing.T) {
+	f := newFixture(t)
+	sim := netsim.New(7).Outgoing(netsim.DropNth(1, 4), netsim.DuplicateData())
+
+	// the simulator plugs into a transfer created by hand as well
+	f.server.SetConnWrapper(sim.Conn)
+	f.start(t)
+
+	conn, err := net.DialUDP("udp", nil, f.server.Addrs()[0].(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	req := &types.Request{Opcode: types.OpCodeRRQ, Filename: "src", Mode: types.ModeOctet}
+
+	b, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+
+	tr := server.NewTransfer(netsim.New(3).Outgoing(netsim.DuplicateACKs()).Conn(conn),
+		zap.NewNop().Sugar(), 100*time.Millisecond, time.Second, 5, false)
+	if err := tr.ReceiveTo(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got.Bytes(), f.content) || tr.Stats().Duplicates == 0 {
+		t.Fatalf("received %d bytes with %d duplicates, expected %d bytes", got.Len(), tr.Stats().Duplicates, len(f.content))
+	}
+}
@@ -0,0 +1,182 @@
+package netsim
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// counters numbers the packets of a wrapped connection.
+type counters struct {
+	mu  sync.Mutex
+	out int
+	in  int
+}
+
+func (c *counters) next(dir Direction) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if dir == Outgoing {
+		c.out++
+
+		return c.out
+	}
+
+	c.in++
+
+	return c.in
+}
+
+// Conn wraps a connected socket, e.g. the one given to server.NewTransfer.
+func (s *Sim) Conn(conn net.Conn) net.Conn {
+	return &simConn{Conn: conn, sim: s}
+}
+
+type simConn struct {
+	net.Conn
+	sim     *Sim
+	n       counters
+	mu      sync.Mutex
+	pending [][]byte
+}
+
+func (c *simConn) Write(b []byte) (int, error) {
+	act, data := c.sim.apply(Outgoing, c.n.next(Outgoing), b)
+	if act.Drop {
+		return len(b), nil
+	}
+
+	if act.Delay > 0 {
+		data = append([]byte(nil), data...)
+
+		time.AfterFunc(act.Delay, func() {
+			for range act.Duplicate + 1 {
+				_, _ = c.Conn.Write(data)
+			}
+		})
+
+		return len(b), nil
+	}
+
+	for range act.Duplicate + 1 {
+		if _, err := c.Conn.Write(data); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+func (c *simConn) Read(b []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		if len(c.pending) > 0 {
+			n := copy(b, c.pending[0])
+			c.pending = c.pending[1:]
+			c.mu.Unlock()
+
+			return n, nil
+		}
+		c.mu.Unlock()
+
+		n, err := c.Conn.Read(b)
+		if err != nil {
+			return n, err
+		}
+
+		act, data := c.sim.apply(Incoming, c.n.next(Incoming), b[:n])
+		if act.Drop {
+			continue
+		}
+
+		time.Sleep(act.Delay)
+
+		c.mu.Lock()
+		for range act.Duplicate {
+			c.pending = append(c.pending, append([]byte(nil), data...))
+		}
+		c.mu.Unlock()
+
+		return copy(b, data), nil
+	}
+}
+
+// PacketConn wraps an unconnected socket, e.g. a server listener.
+func (s *Sim) PacketConn(conn net.PacketConn) net.PacketConn {
+	return &simPacketConn{PacketConn: conn, sim: s}
+}
+
+type datagram struct {
+	b    []byte
+	addr net.Addr
+}
+
+type simPacketConn struct {
+	net.PacketConn
+	sim     *Sim
+	n       counters
+	mu      sync.Mutex
+	pending []datagram
+}
+
+func (c *simPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	act, data := c.sim.apply(Outgoing, c.n.next(Outgoing), b)
+	if act.Drop {
+		return len(b), nil
+	}
+
+	if act.Delay > 0 {
+		data = append([]byte(nil), data...)
+
+		time.AfterFunc(act.Delay, func() {
+			for range act.Duplicate + 1 {
+				_, _ = c.PacketConn.WriteTo(data, addr)
+			}
+		})
+
+		return len(b), nil
+	}
+
+	for range act.Duplicate + 1 {
+		if _, err := c.PacketConn.WriteTo(data, addr); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+func (c *simPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c.mu.Lock()
+		if len(c.pending) > 0 {
+			d := c.pending[0]
+			c.pending = c.pending[1:]
+			c.mu.Unlock()
+
+			return copy(b, d.b), d.addr, nil
+		}
+		c.mu.Unlock()
+
+		n, addr, err := c.PacketConn.ReadFrom(b)
+		if err != nil {
+			return n, addr, err
+		}
+
+		act, data := c.sim.apply(Incoming, c.n.next(Incoming), b[:n])
+		if act.Drop {
+			continue
+		}
+
+		time.Sleep(act.Delay)
+
+		c.mu.Lock()
+		for range act.Duplicate {
+			c.pending = append(c.pending, datagram{b: append([]byte(nil), data...), addr: addr})
+		}
+		c.mu.Unlock()
+
+		return copy(b, data), addr, nil
+	}
+}
@@ -0,0 +1,212 @@
+// Package netsim simulates an impaired network for protocol tests. It wraps
+// the connections of a client or a server and drops, duplicates, delays or
+// corrupts the packets matching scripted rules. Random decisions come from a
+// seeded generator so that a failing run can be replayed.
+package netsim
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+)
+
+type Direction int
+
+const (
+	Outgoing Direction = iota
+	Incoming
+)
+
+// Packet describes a packet going through a wrapped connection.
+type Packet struct {
+	Dir Direction
+	// N is the position of the packet among the packets going in the same
+	// direction through the same connection, starting at 1.
+	N      int
+	Opcode types.OpCode
+	// Block is the block# of DATA and ACK packets.
+	Block uint16
+	Data  []byte
+}
+
+// Action is what happens to a packet. The actions of several matching rules
+// add up.
+type Action struct {
+	Drop bool
+	// Duplicate is the number of extra copies delivered.
+	Duplicate int
+	Delay     time.Duration
+	// Corrupt lists the offsets of the bytes to invert, negative offsets pick
+	// a random byte.
+	Corrupt []int
+}
+
+// Rule decides the action applied to a packet, rng is the seeded generator
+// of the simulator.
+type Rule func(p *Packet, rng *rand.Rand) Action
+
+// Stats counts the impairments applied by a simulator.
+type Stats struct {
+	Packets    int64
+	Dropped    int64
+	Duplicated int64
+	Delayed    int64
+	Corrupted  int64
+}
+
+// Sim applies rules to the packets of the connections it wraps.
+type Sim struct {
+	mu    sync.Mutex
+	rng   *rand.Rand
+	rules [2][]Rule
+
+	packets    atomic.Int64
+	dropped    atomic.Int64
+	duplicated atomic.Int64
+	delayed    atomic.Int64
+	corrupted  atomic.Int64
+}
+
+// New returns a simulator without rules whose random decisions derive from
+// seed.
+func New(seed uint64) *Sim {
+	return &Sim{rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// Outgoing adds rules applied to the packets written to wrapped connections.
+func (s *Sim) Outgoing(rules ...Rule) *Sim {
+	s.rules[Outgoing] = append(s.rules[Outgoing], rules...)
+
+	return s
+}
+
+// Incoming adds rules applied to the packets read from wrapped connections.
+func (s *Sim) Incoming(rules ...Rule) *Sim {
+	s.rules[Incoming] = append(s.rules[Incoming], rules...)
+
+	return s
+}
+
+func (s *Sim) Stats() Stats {
+	return Stats{
+		Packets:    s.packets.Load(),
+		Dropped:    s.dropped.Load(),
+		Duplicated: s.duplicated.Load(),
+		Delayed:    s.delayed.Load(),
+		Corrupted:  s.corrupted.Load(),
+	}
+}
+
+// apply decides the fate of b, the n-th packet in direction dir. It returns
+// the action and the bytes to deliver, a corrupted copy of b if needed.
+func (s *Sim) apply(dir Direction, n int, b []byte) (Action, []byte) {
+	p := &Packet{Dir: dir, N: n, Data: b}
+
+	if len(b) >= 2 {
+		p.Opcode = types.OpCode(binary.BigEndian.Uint16(b))
+	}
+
+	if len(b) >= 4 && (p.Opcode == types.OpCodeDATA || p.Opcode == types.OpCodeACK) {
+		p.Block = binary.BigEndian.Uint16(b[2:])
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var act Action
+
+	for _, rule := range s.rules[dir] {
+		a := rule(p, s.rng)
+		act.Drop = act.Drop || a.Drop
+		act.Duplicate += a.Duplicate
+		act.Delay += a.Delay
+		act.Corrupt = append(act.Corrupt, a.Corrupt...)
+	}
+
+	s.packets.Add(1)
+
+	switch {
+	case act.Drop:
+		s.dropped.Add(1)
+
+		return act, nil
+	case act.Duplicate > 0:
+		s.duplicated.Add(1)
+	}
+
+	if act.Delay > 0 {
+		s.delayed.Add(1)
+	}
+
+	if len(act.Corrupt) > 0 && len(b) > 0 {
+		s.corrupted.Add(1)
+		b = append([]byte(nil), b...)
+
+		for _, offset := range act.Corrupt {
+			if offset < 0 || offset >= len(b) {
+				offset = s.rng.IntN(len(b))
+			}
+
+			b[offset] ^= 0xff
+		}
+	}
+
+	return act, b
+}
+
+// DropNth drops the packets at the given positions.
+func DropNth(n ...int) Rule {
+	return func(p *Packet, _ *rand.Rand) Action {
+		for _, i := range n {
+			if p.N == i {
+				return Action{Drop: true}
+			}
+		}
+
+		return Action{}
+	}
+}
+
+// DropRate drops packets with the given probability.
+func DropRate(rate float64) Rule {
+	return func(_ *Packet, rng *rand.Rand) Action {
+		return Action{Drop: rng.Float64() < rate}
+	}
+}
+
+// DuplicateACKs delivers every ACK twice.
+func DuplicateACKs() Rule {
+	return Match(func(p *Packet) bool { return p.Opcode == types.OpCodeACK }, Action{Duplicate: 1})
+}
+
+// DuplicateData delivers every DATA packet twice.
+func DuplicateData() Rule {
+	return Match(func(p *Packet) bool { return p.Opcode == types.OpCodeDATA }, Action{Duplicate: 1})
+}
+
+// DelayData holds every DATA packet back for d, later packets can overtake
+// it.
+func DelayData(d time.Duration) Rule {
+	return Match(func(p *Packet) bool { return p.Opcode == types.OpCodeDATA }, Action{Delay: d})
+}
+
+// CorruptNth inverts the byte at offset of the n-th packet, a negative offset
+// picks a random byte.
+func CorruptNth(n int, offset int) Rule {
+	return Match(func(p *Packet) bool { return p.N == n }, Action{Corrupt: []int{offset}})
+}
+
+// Match applies act to the packets for which match returns true.
+func Match(match func(p *Packet) bool, act Action) Rule {
+	return func(p *Packet, _ *rand.Rand) Action {
+		if match(p) {
+			return act
+		}
+
+		return Action{}
+	}
+}
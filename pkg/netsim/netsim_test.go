@@ -0,0 +1,60 @@
+package netsim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+)
+
+func TestApply(t *testing.T) {
+	data := []byte{0, byte(types.OpCodeDATA), 0, 7, 'x'}
+	ack := []byte{0, byte(types.OpCodeACK), 0, 7}
+
+	s := New(1).Outgoing(DropNth(2), DuplicateACKs(), DelayData(time.Second), CorruptNth(3, 4))
+
+	if act, _ := s.apply(Outgoing, 1, data); act.Drop || act.Delay != time.Second || act.Duplicate != 0 {
+		t.Fatalf("unexpected action on DATA %+v", act)
+	}
+
+	if act, _ := s.apply(Outgoing, 2, ack); !act.Drop {
+		t.Fatalf("second packet not dropped: %+v", act)
+	}
+
+	if act, b := s.apply(Outgoing, 4, ack); act.Duplicate != 1 || b[3] != 7 {
+		t.Fatalf("unexpected action on ACK %+v", act)
+	}
+
+	if _, b := s.apply(Outgoing, 3, data); b[4] != 'x'^0xff || data[4] != 'x' {
+		t.Fatalf("expected a corrupted copy, got %v", b)
+	}
+
+	if act, _ := s.apply(Incoming, 2, ack); act.Drop {
+		t.Fatal("outgoing rules applied to an incoming packet")
+	}
+
+	if stats := s.Stats(); stats.Packets != 5 || stats.Dropped != 1 || stats.Corrupted != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSeedReplays(t *testing.T) {
+	run := func() []bool {
+		s := New(99).Outgoing(DropRate(0.5))
+		drops := make([]bool, 50)
+
+		for i := range drops {
+			act, _ := s.apply(Outgoing, i+1, []byte{0, 3, 0, 1})
+			drops[i] = act.Drop
+		}
+
+		return drops
+	}
+
+	first, second := run(), run()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("packet %d: runs with the same seed differ", i+1)
+		}
+	}
+}
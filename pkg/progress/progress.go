@@ -0,0 +1,112 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	barWidth       = 30
+	redrawInterval = 100 * time.Millisecond
+)
+
+// Bar renders the progress of a transfer on a single terminal line.
+type Bar struct {
+	w     io.Writer
+	name  string
+	start time.Time
+	drawn time.Time
+	width int
+}
+
+func NewBar(w io.Writer, name string) *Bar {
+	return &Bar{w: w, name: name, start: time.Now()}
+}
+
+// IsTerminal reports whether f is a character device, the bar is only
+// useful there.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Update redraws the bar, at most every redrawInterval. size is -1 when the
+// size of the transfer is unknown.
+func (b *Bar) Update(bytes int64, size int64) {
+	now := time.Now()
+	if now.Sub(b.drawn) < redrawInterval {
+		return
+	}
+
+	b.drawn = now
+	b.draw(bytes, size, now.Sub(b.start))
+}
+
+// Finish draws the final state of the bar and ends its line.
+func (b *Bar) Finish(bytes int64, size int64) {
+	b.draw(bytes, size, time.Since(b.start))
+	fmt.Fprintln(b.w)
+}
+
+func (b *Bar) draw(bytes int64, size int64, elapsed time.Duration) {
+	rate := Rate(bytes, elapsed)
+
+	var line string
+
+	if size > 0 {
+		done := min(float64(bytes)/float64(size), 1)
+		filled := int(done * barWidth)
+
+		line = fmt.Sprintf("%s [%s%s] %3.0f%% %s/%s %s/s ETA %s", b.name,
+			strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled), done*100,
+			FormatBytes(bytes), FormatBytes(size), FormatBytes(int64(rate)), eta(bytes, size, rate))
+	} else {
+		line = fmt.Sprintf("%s %s %s/s", b.name, FormatBytes(bytes), FormatBytes(int64(rate)))
+	}
+
+	// pad with spaces to erase the end of a longer previous line
+	padding := max(b.width-len(line), 0)
+	b.width = len(line)
+
+	fmt.Fprintf(b.w, "\r%s%s", line, strings.Repeat(" ", padding))
+}
+
+func eta(bytes int64, size int64, rate float64) string {
+	if rate <= 0 {
+		return "--"
+	}
+
+	left := time.Duration(float64(max(size-bytes, 0)) / rate * float64(time.Second))
+
+	return left.Round(time.Second).String()
+}
+
+// Rate returns the throughput in bytes per second.
+func Rate(bytes int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(bytes) / elapsed.Seconds()
+}
+
+// FormatBytes formats n with a binary unit, e.g. 1.5 MiB.
+func FormatBytes(n int64) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
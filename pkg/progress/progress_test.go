@@ -0,0 +1,34 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:             "0 B",
+		1023:          "1023 B",
+		1536:          "1.5 KiB",
+		5 << 20:       "5.0 MiB",
+		3<<30 + 1<<29: "3.5 GiB",
+	}
+
+	for n, expected := range tests {
+		if got := FormatBytes(n); got != expected {
+			t.Fatalf("%d: got %s, expected %s", n, got, expected)
+		}
+	}
+}
+
+func TestBarFinish(t *testing.T) {
+	var out bytes.Buffer
+
+	b := NewBar(&out, "image")
+	b.Finish(512, 1024)
+
+	if line := out.String(); !strings.Contains(line, " 50% 512 B/1.0 KiB") || !strings.HasSuffix(line, "\n") {
+		t.Fatalf("unexpected bar %q", line)
+	}
+}
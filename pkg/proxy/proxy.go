@@ -0,0 +1,377 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+type route struct {
+	prefix string
+	base   *url.URL
+}
+
+// Proxy fetches the files below configured prefixes from HTTP upstreams.
+// With a cache directory the files carrying an ETag are kept on disk and
+// revalidated on each request.
+type Proxy struct {
+	client   *http.Client
+	routes   []route
+	cacheDir string
+	timeout  time.Duration
+	// mu serialises the commits to the cache with the reads of its metadata,
+	// so that the metadata always describes the content next to it
+	mu sync.Mutex
+}
+
+// New routes the requests below each prefix to the URL it is mapped to,
+// timeout bounds the wait for the response headers of an upstream and for
+// each read of a body.
+func New(routes map[string]string, cacheDir string, timeout time.Duration) (*Proxy, error) {
+	p := &Proxy{cacheDir: cacheDir, timeout: timeout}
+
+	for prefix, raw := range routes {
+		base, err := ParseUpstream(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		p.routes = append(p.routes, route{prefix: strings.Trim(prefix, "/"), base: base})
+	}
+
+	// the longest prefix wins
+	sort.Slice(p.routes, func(i, j int) bool {
+		return len(p.routes[i].prefix) > len(p.routes[j].prefix)
+	})
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	p.client = &http.Client{Transport: transport}
+
+	return p, nil
+}
+
+// ParseUpstream parses the base URL of an upstream.
+func ParseUpstream(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("error: %s is not an http or https url", raw)
+	}
+
+	return u, nil
+}
+
+// URL returns the upstream URL of filename, ok is false when no prefix
+// matches.
+func (p *Proxy) URL(filename string) (string, bool) {
+	filename = strings.TrimPrefix(filename, "/")
+
+	for _, r := range p.routes {
+		rest, found := strings.CutPrefix(filename, r.prefix+"/")
+		if !found || !fs.ValidPath(rest) || rest == "." {
+			continue
+		}
+
+		return r.base.JoinPath(rest).String(), true
+	}
+
+	return "", false
+}
+
+// meta describes a cached file.
+type meta struct {
+	URL  string `json:"url"`
+	ETag string `json:"etag"`
+	Size int64  `json:"size"`
+}
+
+func (p *Proxy) cachePath(u string) string {
+	sum := sha256.Sum256([]byte(u))
+
+	return filepath.Join(p.cacheDir, hex.EncodeToString(sum[:]))
+}
+
+// cached returns the cached copy of u, if any.
+func (p *Proxy) cached(u string) (*meta, bool) {
+	if p.cacheDir == "" {
+		return nil, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.cachedLocked(u)
+}
+
+func (p *Proxy) cachedLocked(u string) (*meta, bool) {
+	path := p.cachePath(u)
+
+	b, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return nil, false
+	}
+
+	var m meta
+	if err := json.Unmarshal(b, &m); err != nil || m.URL != u {
+		return nil, false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != m.Size {
+		return nil, false
+	}
+
+	return &m, true
+}
+
+// Open fetches u. Missing files wrap fs.ErrNotExist. A cached copy still
+// matching the ETag of the upstream is read from disk, it is also served,
+// marked stale, when the upstream can not be reached. The request is
+// cancelled with ctx, when the body is closed or when the upstream sends
+// nothing for the timeout of the proxy.
+func (p *Proxy) Open(ctx context.Context, u string) (*Body, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	b, err := p.open(ctx, cancel, u)
+	if err != nil || b.Cached {
+		cancel()
+	}
+
+	return b, err
+}
+
+func (p *Proxy) open(ctx context.Context, cancel context.CancelFunc, u string) (*Body, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	m, isCached := p.cached(u)
+	if isCached {
+		req.Header.Set("If-None-Match", m.ETag)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if isCached {
+			b, errOpen := p.openCached(u)
+			if errOpen == nil {
+				b.Stale = true
+
+				return b, nil
+			}
+		}
+
+		return nil, fmt.Errorf("error while fetching %s: %w", u, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && isCached:
+		resp.Body.Close()
+
+		return p.openCached(u)
+	case resp.StatusCode == http.StatusOK:
+		return p.stream(u, resp, newIdleReader(resp.Body, p.timeout, cancel)), nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		resp.Body.Close()
+
+		return nil, &fs.PathError{Op: "fetch", Path: u, Err: fs.ErrNotExist}
+	default:
+		resp.Body.Close()
+
+		return nil, fmt.Errorf("error: upstream answered %s for %s", resp.Status, u)
+	}
+}
+
+// openCached opens the cached copy of u. It is looked up again since another
+// fetch may have replaced it while the upstream was asked.
+func (p *Proxy) openCached(u string) (*Body, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m, ok := p.cachedLocked(u)
+	if !ok {
+		return nil, fmt.Errorf("error: cached copy of %s is gone", u)
+	}
+
+	f, err := os.Open(p.cachePath(u))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Body{ForwardSeeker: utils.NewForwardSeeker(f, m.Size), Size: m.Size, Cached: true, closer: f}, nil
+}
+
+// stream returns the body of resp read through r, stored in the cache while it
+// is read when the upstream sent an ETag.
+func (p *Proxy) stream(u string, resp *http.Response, r *idleReader) *Body {
+	b := &Body{ForwardSeeker: utils.NewForwardSeeker(r, resp.ContentLength), Size: resp.ContentLength, closer: r}
+
+	etag := resp.Header.Get("ETag")
+	if p.cacheDir == "" || etag == "" {
+		return b
+	}
+
+	tmp, err := os.CreateTemp(p.cacheDir, ".fetch-*")
+	if err != nil {
+		return b
+	}
+
+	b.fetch = &fetch{r: r, size: b.Size, tmp: tmp}
+	b.ForwardSeeker = utils.NewForwardSeeker(b.fetch, b.Size)
+	b.fetch.commit = func(size int64) error {
+		path := p.cachePath(u)
+
+		data, err := json.Marshal(&meta{URL: u, ETag: etag, Size: size})
+		if err != nil {
+			return err
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		// the previous metadata must not describe the new content
+		if err := os.Remove(path + ".json"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			return err
+		}
+
+		return os.WriteFile(path+".json", data, 0o644)
+	}
+
+	return b
+}
+
+// idleReader fails a read of an upstream body waiting longer than timeout by
+// cancelling its request, the body is closed with the request.
+type idleReader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	cancel  context.CancelFunc
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+func newIdleReader(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleReader {
+	r := &idleReader{body: body, timeout: timeout, cancel: cancel}
+	r.timer = time.AfterFunc(timeout, func() {
+		r.expired.Store(true)
+		cancel()
+	})
+	r.timer.Stop()
+
+	return r
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	// the timer only runs while waiting for the upstream, not while the
+	// content is being sent
+	r.timer.Reset(r.timeout)
+	n, err := r.body.Read(p)
+	r.timer.Stop()
+
+	if err != nil && r.expired.Load() {
+		return n, fmt.Errorf("error: upstream sent nothing for %s: %w", r.timeout, err)
+	}
+
+	return n, err
+}
+
+func (r *idleReader) Close() error {
+	r.timer.Stop()
+	r.cancel()
+
+	return r.body.Close()
+}
+
+// Body is the content of an upstream file, Size is -1 when the upstream did
+// not announce it. Bodies fetched from the upstream only seek forward.
+type Body struct {
+	utils.ForwardSeeker
+	Size int64
+	// Cached is set for bodies read from the cache, Stale when the upstream
+	// could not confirm that they are up to date
+	Cached bool
+	Stale  bool
+
+	closer io.Closer
+	// fetch stores the content in the cache while it is read, nil when it
+	// is not cached
+	fetch *fetch
+}
+
+// Close releases the body, content not read to the end is not cached.
+func (b *Body) Close() error {
+	if b.fetch != nil && b.fetch.tmp != nil {
+		b.fetch.discard()
+	}
+
+	return b.closer.Close()
+}
+
+// fetch copies the content read from an upstream to tmp, commit moves it into
+// the cache once it is complete. Skipped content is read too.
+type fetch struct {
+	r      io.Reader
+	size   int64
+	n      int64
+	tmp    *os.File
+	commit func(size int64) error
+}
+
+func (f *fetch) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	f.n += int64(n)
+
+	if f.tmp != nil && n > 0 {
+		if _, errWrite := f.tmp.Write(p[:n]); errWrite != nil {
+			f.discard()
+		}
+	}
+
+	if errors.Is(err, io.EOF) && f.tmp != nil {
+		f.store()
+	}
+
+	return n, err
+}
+
+// store moves the fetched content into the cache, content shorter than
+// announced is dropped.
+func (f *fetch) store() {
+	tmp := f.tmp
+	f.tmp = nil
+
+	if errClose := tmp.Close(); errClose != nil || f.size >= 0 && f.n != f.size || f.commit(f.n) != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+func (f *fetch) discard() {
+	f.tmp.Close()
+	os.Remove(f.tmp.Name())
+	f.tmp = nil
+}
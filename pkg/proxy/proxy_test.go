@@ -0,0 +1,339 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// upstream serves one file with an ETag and records the revalidations.
+type upstream struct {
+	mu      sync.Mutex
+	content string
+	etag    string
+	// conditional counts the requests carrying If-None-Match
+	conditional int
+	requests    int
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.requests++
+
+	if r.URL.Path != "/pxe/boot/kernel" {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		u.conditional++
+
+		if inm == u.etag {
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+	}
+
+	if u.etag != "" {
+		w.Header().Set("ETag", u.etag)
+	}
+
+	io.WriteString(w, u.content)
+}
+
+func (u *upstream) set(content string, etag string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.content, u.etag = content, etag
+}
+
+func newProxy(t *testing.T, srv *httptest.Server, cacheDir string) *Proxy {
+	t.Helper()
+
+	p, err := New(map[string]string{"artifacts": srv.URL + "/pxe", "artifacts/other": "http://other.invalid"}, cacheDir, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func read(t *testing.T, p *Proxy, filename string) (string, *Body) {
+	t.Helper()
+
+	u, ok := p.URL(filename)
+	if !ok {
+		t.Fatalf("no route for %s", filename)
+	}
+
+	b, err := p.Open(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return string(got), b
+}
+
+func TestURL(t *testing.T) {
+	p, err := New(map[string]string{"artifacts": "http://a/pxe/", "artifacts/other": "https://b"}, "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for filename, want := range map[string]string{
+		"artifacts/boot/kernel":   "http://a/pxe/boot/kernel",
+		"/artifacts/boot/kernel":  "http://a/pxe/boot/kernel",
+		"artifacts/other/kernel":  "https://b/kernel",
+		"artifacts/a b":           "http://a/pxe/a%20b",
+		"artifacts":               "",
+		"artifactsx/kernel":       "",
+		"artifacts/../etc/passwd": "",
+		"kernel":                  "",
+	} {
+		got, ok := p.URL(filename)
+		if got != want || ok != (want != "") {
+			t.Fatalf("URL(%q) = %q, %t, expected %q", filename, got, ok, want)
+		}
+	}
+
+	if _, err := New(map[string]string{"a": "ftp://host"}, "", time.Second); err == nil {
+		t.Fatal("expected an error for a non http upstream")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	up := &upstream{content: strings.Repeat("k", 1000)}
+	srv := httptest.NewServer(up)
+	defer srv.Close()
+
+	p := newProxy(t, srv, "")
+
+	got, b := read(t, p, "artifacts/boot/kernel")
+	if got != up.content || b.Size != 1000 || b.Cached {
+		t.Fatalf("read %d bytes, size %d, cached %t", len(got), b.Size, b.Cached)
+	}
+
+	u, _ := p.URL("artifacts/missing")
+	if _, err := p.Open(context.Background(), u); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	up := &upstream{content: "0123456789", etag: `"v1"`}
+	srv := httptest.NewServer(up)
+	defer srv.Close()
+
+	p := newProxy(t, srv, t.TempDir())
+
+	for _, cached := range []bool{false, true} {
+		u, _ := p.URL("artifacts/boot/kernel")
+
+		b, err := p.Open(context.Background(), u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if b.Cached != cached {
+			t.Fatalf("cached is %t, expected %t", b.Cached, cached)
+		}
+
+		if _, err := b.Seek(4, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		got, _ := io.ReadAll(b)
+		b.Close()
+
+		if string(got) != "456789" {
+			t.Fatalf("read %q after seeking", got)
+		}
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	up := &upstream{content: "v1 content", etag: `"v1"`}
+	srv := httptest.NewServer(up)
+	defer srv.Close()
+
+	p := newProxy(t, srv, t.TempDir())
+
+	if got, b := read(t, p, "artifacts/boot/kernel"); got != "v1 content" || b.Cached {
+		t.Fatalf("first read %q, cached %t", got, b.Cached)
+	}
+
+	if got, b := read(t, p, "artifacts/boot/kernel"); got != "v1 content" || !b.Cached || up.conditional != 1 {
+		t.Fatalf("second read %q, cached %t, %d conditional requests", got, b.Cached, up.conditional)
+	}
+
+	up.set("v2 content!", `"v2"`)
+
+	if got, b := read(t, p, "artifacts/boot/kernel"); got != "v2 content!" || b.Cached {
+		t.Fatalf("read %q after the upstream changed, cached %t", got, b.Cached)
+	}
+
+	if got, b := read(t, p, "artifacts/boot/kernel"); got != "v2 content!" || !b.Cached {
+		t.Fatalf("read %q, cached %t", got, b.Cached)
+	}
+
+	// the upstream is down, the cached copy is served
+	srv.Close()
+
+	if got, b := read(t, p, "artifacts/boot/kernel"); got != "v2 content!" || !b.Stale {
+		t.Fatalf("read %q, stale %t", got, b.Stale)
+	}
+}
+
+func TestCacheSkipsIncompleteReads(t *testing.T) {
+	up := &upstream{content: strings.Repeat("k", 1000), etag: `"v1"`}
+	srv := httptest.NewServer(up)
+	defer srv.Close()
+
+	p := newProxy(t, srv, t.TempDir())
+	u, _ := p.URL("artifacts/boot/kernel")
+
+	b, err := p.Open(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Close()
+
+	if got, b := read(t, p, "artifacts/boot/kernel"); got != up.content || b.Cached {
+		t.Fatalf("read %d bytes, cached %t", len(got), b.Cached)
+	}
+
+	// files without ETag can not be revalidated and are not cached
+	up.set("no etag", "")
+
+	read(t, p, "artifacts/boot/kernel")
+
+	if _, b := read(t, p, "artifacts/boot/kernel"); b.Cached {
+		t.Fatal("a file without ETag was cached")
+	}
+}
+
+func TestStalledBody(t *testing.T) {
+	stalled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		io.WriteString(w, "partial")
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-stalled:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(stalled)
+
+	p, err := New(map[string]string{"artifacts": srv.URL}, "", 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := p.URL("artifacts/kernel")
+
+	b, err := p.Open(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer b.Close()
+
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := io.ReadAll(b)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("read a stalled body to the end")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read of a stalled body did not time out")
+	}
+}
+
+func TestCacheConcurrentFetches(t *testing.T) {
+	up := &upstream{content: "v1 content", etag: `"v1"`}
+	srv := httptest.NewServer(up)
+	defer srv.Close()
+
+	p := newProxy(t, srv, t.TempDir())
+	u, _ := p.URL("artifacts/boot/kernel")
+	contents := map[string]string{`"v1"`: "v1 content", `"v2"`: "v2 content"}
+
+	for range 50 {
+		// both fetches are open before either stores its content
+		up.set(contents[`"v1"`], `"v1"`)
+		first, err := p.Open(context.Background(), u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		up.set(contents[`"v2"`], `"v2"`)
+		second, err := p.Open(context.Background(), u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		for _, b := range []*Body{first, second} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				io.ReadAll(b)
+				b.Close()
+			}()
+		}
+		wg.Wait()
+
+		// the metadata describes the content it sits next to
+		m, ok := p.cached(u)
+		if !ok {
+			continue
+		}
+
+		b, err := p.openCached(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, _ := io.ReadAll(b)
+		b.Close()
+
+		if string(got) != contents[m.ETag] {
+			t.Fatalf("cached %q under the ETag %s", got, m.ETag)
+		}
+	}
+}
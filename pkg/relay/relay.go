@@ -0,0 +1,130 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/client"
+	"github.com/Wa4h1h/go-tftp/pkg/server"
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+	"go.uber.org/zap"
+)
+
+// Route forwards the files below Prefix to the TFTP server at Upstream, an
+// empty prefix matches every file. Timeout is the per packet timeout of the
+// upstream leg, it is requested with the timeout option.
+type Route struct {
+	Prefix   string
+	Upstream string
+	Timeout  time.Duration
+}
+
+type route struct {
+	Route
+	client *client.Client
+}
+
+// Relay forwards requests to upstream TFTP servers with the package client,
+// it implements server.Relay.
+type Relay struct {
+	routes []route
+}
+
+var _ server.Relay = (*Relay)(nil)
+
+// New returns a relay for routes, numTries bounds the retransmissions of a
+// packet to an upstream.
+func New(l *zap.SugaredLogger, routes []Route, numTries uint) (*Relay, error) {
+	r := &Relay{}
+
+	for _, rt := range routes {
+		if _, _, err := net.SplitHostPort(rt.Upstream); err != nil {
+			return nil, fmt.Errorf("error: invalid upstream %s: %w", rt.Upstream, err)
+		}
+
+		c := client.NewClient(l, numTries)
+		if err := c.Connect(rt.Upstream); err != nil {
+			return nil, err
+		}
+
+		rt.Prefix = strings.Trim(rt.Prefix, "/")
+		r.routes = append(r.routes, route{Route: rt, client: c})
+	}
+
+	// the longest prefix wins
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return len(r.routes[i].Prefix) > len(r.routes[j].Prefix)
+	})
+
+	return r, nil
+}
+
+// match returns the route of filename and the name it has on the upstream,
+// the prefix is stripped from it.
+func (r *Relay) match(filename string) (*route, string, bool) {
+	filename = strings.TrimPrefix(filename, "/")
+
+	for i := range r.routes {
+		rt := &r.routes[i]
+
+		if rt.Prefix == "" {
+			return rt, filename, filename != ""
+		}
+
+		rest, found := strings.CutPrefix(filename, rt.Prefix+"/")
+		if !found || !fs.ValidPath(rest) || rest == "." {
+			continue
+		}
+
+		return rt, rest, true
+	}
+
+	return nil, "", false
+}
+
+func (r *Relay) Route(filename string) (string, bool) {
+	rt, remote, ok := r.match(filename)
+	if !ok {
+		return "", false
+	}
+
+	return fmt.Sprintf("tftp://%s/%s", rt.Upstream, remote), true
+}
+
+func (r *Relay) options(rt *route) []client.Option {
+	opts := []client.Option{client.WithMode(types.ModeOctet)}
+	if rt.Timeout > 0 {
+		opts = append(opts, client.WithTimeout(rt.Timeout))
+	}
+
+	return opts
+}
+
+func (r *Relay) Open(ctx context.Context, filename string) (io.ReadCloser, int64, error) {
+	rt, remote, ok := r.match(filename)
+	if !ok {
+		return nil, 0, fmt.Errorf("error: %s is not relayed", filename)
+	}
+
+	body, err := rt.client.Get(ctx, remote, append(r.options(rt), client.WithTransferSize())...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return body, body.Size(), nil
+}
+
+func (r *Relay) Create(ctx context.Context, filename string, size int64) (server.RelayWriter, error) {
+	rt, remote, ok := r.match(filename)
+	if !ok {
+		return nil, fmt.Errorf("error: %s is not relayed", filename)
+	}
+
+	return rt.client.Create(ctx, remote, size, r.options(rt)...)
+}
@@ -0,0 +1,143 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/client"
+	"github.com/Wa4h1h/go-tftp/pkg/server"
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+	"go.uber.org/zap"
+)
+
+func listen(t *testing.T, dir string) *server.Server {
+	t.Helper()
+
+	s := server.NewServer(zap.NewNop().Sugar(), []string{"127.0.0.1"}, "0", 1, 1, 3, dir, false)
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve()
+
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func TestRelay(t *testing.T) {
+	images, configs := t.TempDir(), t.TempDir()
+	kernel := bytes.Repeat([]byte("kernel"), 3000)
+
+	if err := os.WriteFile(filepath.Join(images, "vmlinuz"), kernel, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	imagesAddr := listen(t, images).Addrs()[0].String()
+	configsAddr := listen(t, configs).Addrs()[0].String()
+
+	r, err := New(zap.NewNop().Sugar(), []Route{
+		{Prefix: "", Upstream: imagesAddr, Timeout: time.Second},
+		{Prefix: "/configs/", Upstream: configsAddr, Timeout: time.Second},
+	}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := listen(t, t.TempDir())
+	s.SetRelay(r)
+
+	c := client.NewClient(nil, 3)
+	if err := c.Connect(s.Addrs()[0].String()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the catch-all route
+	var got bytes.Buffer
+	if _, err := c.WriteTo(ctx, "vmlinuz", &got, client.WithBlockSize(1024), client.WithTransferSize()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got.Bytes(), kernel) {
+		t.Fatalf("received %d bytes, expected %d", got.Len(), len(kernel))
+	}
+
+	if stats := c.Stats(); stats.Size != int64(len(kernel)) {
+		t.Fatalf("relayed tsize %d, expected %d", stats.Size, len(kernel))
+	}
+
+	// resuming discards the content before the offset
+	got.Reset()
+	if _, err := c.WriteTo(ctx, "vmlinuz", &got, client.WithOffset(6000)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got.Bytes(), kernel[6000:]) {
+		t.Fatalf("received %d bytes from the offset, expected %d", got.Len(), len(kernel)-6000)
+	}
+
+	// uploads below the prefix reach the other upstream without it
+	config := bytes.Repeat([]byte("menu\n"), 400)
+	if _, err := c.Put(ctx, "configs/default", bytes.NewReader(config), int64(len(config))); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := os.ReadFile(filepath.Join(configs, "default"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(stored, config) {
+		t.Fatalf("upstream stored %d bytes, expected %d", len(stored), len(config))
+	}
+
+	// errors of the upstream reach the client
+	_, err = c.WriteTo(ctx, "configs/missing", io.Discard)
+
+	var tftpErr *types.TFTPError
+	if !errors.As(err, &tftpErr) || tftpErr.Code != types.ErrFileNotFound {
+		t.Fatalf("expected file not found error, got %v", err)
+	}
+
+	_, err = c.Put(ctx, "configs/default", bytes.NewReader(config), int64(len(config)))
+	if !errors.As(err, &tftpErr) || tftpErr.Code != types.ErrFileAlreadyExists {
+		t.Fatalf("expected file already exists error, got %v", err)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	r, err := New(nil, []Route{
+		{Prefix: "pxe", Upstream: "10.0.0.1:69"},
+		{Prefix: "pxe/efi", Upstream: "10.0.0.2:69"},
+	}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for filename, expected := range map[string]string{
+		"pxe/pxelinux.0":    "tftp://10.0.0.1:69/pxelinux.0",
+		"/pxe/efi/grubx64":  "tftp://10.0.0.2:69/grubx64",
+		"pxe/efiboot/image": "tftp://10.0.0.1:69/efiboot/image",
+		"pxe/../etc/passwd": "",
+		"pxe":               "",
+		"other/file":        "",
+	} {
+		got, ok := r.Route(filename)
+		if got != expected || ok != (expected != "") {
+			t.Fatalf("Route(%q) = %q, %t, expected %q", filename, got, ok, expected)
+		}
+	}
+
+	if _, err := New(nil, []Route{{Upstream: "10.0.0.1"}}, 3); err == nil {
+		t.Fatal("expected an error for an upstream without port")
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func zipArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	zw := zip.NewWriter(&b)
+
+	for name, content := range files {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := fw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+func serveArchives(s *Server) {
+	s.SetArchives(true)
+}
+
+func TestWireReadArchiveMember(t *testing.T) {
+	t.Parallel()
+
+	kernel := strings.Repeat("k", 600)
+	w, _ := newWire(t, map[string]string{"release.zip": zipArchive(t, map[string]string{"boot/kernel": kernel})}, serveArchives)
+
+	w.send(rrq("release.zip/boot/kernel", "octet", "tsize", "0"))
+	w.expect(oack("tsize", "600"))
+	w.send(ack(0))
+	w.expect(data(1, kernel[:512]))
+	w.send(ack(1))
+	w.expect(data(2, kernel[512:]))
+	w.send(ack(2))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadArchiveMemberNotFound(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, map[string]string{"release.zip": zipArchive(t, map[string]string{"boot/kernel": "k"})}, serveArchives)
+
+	w.send(rrq("release.zip/boot/missing", "octet"))
+	w.expect(errorPacket(1, "release.zip/boot/missing not found"))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireWriteArchive(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, map[string]string{"release.zip": zipArchive(t, map[string]string{"boot/kernel": "k"})}, serveArchives)
+
+	w.send(wrq("release.zip/boot/kernel", "octet"))
+	w.expect(errorPacket(2, "release.zip is a read-only archive"))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadArchivesDisabled(t *testing.T) {
+	t.Parallel()
+
+	w, dir := newWire(t, map[string]string{"release.zip": zipArchive(t, map[string]string{"boot/kernel": "k"})})
+
+	// without archive serving only the base name of the request is looked up
+	w.send(rrq("release.zip/boot/kernel", "octet"))
+	w.expect(errorPacket(1, dir+"/kernel not found"))
+	w.silent(2 * wireRTO)
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/netsim"
+	"go.uber.org/zap"
+)
+
+const benchSize = 1 << 20
+
+// loopbackPair returns two UDP sockets on loopback connected to each other.
+func loopbackPair(b *testing.B) (net.Conn, net.Conn) {
+	b.Helper()
+
+	l, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	addr := l.LocalAddr().(*net.UDPAddr)
+
+	receiver, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	l.Close()
+
+	sender, err := net.DialUDP("udp4", addr, receiver.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Cleanup(func() {
+		sender.Close()
+		receiver.Close()
+	})
+
+	return sender, receiver
+}
+
+type benchCase struct {
+	blockSize  int
+	windowSize int
+	readAhead  int
+	mmap       bool
+	// latency delays the DATA packets to simulate a network slower than
+	// loopback
+	latency time.Duration
+}
+
+// benchmarkSend transfers size bytes per iteration over loopback, send starts
+// the transfer from the sending side.
+func benchmarkSend(b *testing.B, bc benchCase, size int64, send func(t Transfer) error) {
+	a, c := loopbackPair(b)
+	if bc.latency > 0 {
+		a = netsim.New(1).Outgoing(netsim.DelayData(bc.latency)).Conn(a)
+	}
+
+	opts := &TransferOptions{BlockSize: bc.blockSize, WindowSize: bc.windowSize, Size: -1}
+
+	b.SetBytes(size)
+	b.ResetTimer()
+
+	for range b.N {
+		sender := NewTransfer(a, zap.NewNop().Sugar(), time.Second, time.Second, 5, false)
+		receiver := NewTransfer(c, zap.NewNop().Sugar(), time.Second, time.Second, 5, false)
+
+		sender.SetOptions(opts)
+		receiver.SetOptions(opts)
+		sender.SetReadAhead(bc.readAhead)
+		sender.SetMmap(bc.mmap)
+
+		errc := make(chan error, 1)
+
+		go func() {
+			errc <- send(sender)
+		}()
+
+		if err := receiver.ReceiveTo(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+
+		if err := <-errc; err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchFile(b *testing.B) string {
+	b.Helper()
+
+	path := filepath.Join(b.TempDir(), "file")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("0123456789abcdef"), benchSize/16), 0o644); err != nil {
+		b.Fatal(err)
+	}
+
+	return path
+}
+
+func BenchmarkSend(b *testing.B) {
+	path := benchFile(b)
+
+	for _, blockSize := range []int{512, 1428, 8192} {
+		for _, windowSize := range []int{1, 4, 16} {
+			if blockSize*windowSize > 64<<10 {
+				// the window overflows the socket buffer and ends in timeouts
+				continue
+			}
+
+			for _, readAhead := range []int{0, DefaultReadAhead} {
+				name := fmt.Sprintf("blksize=%d/windowsize=%d/read-ahead=%d", blockSize, windowSize, readAhead)
+
+				b.Run(name, func(b *testing.B) {
+					bc := benchCase{blockSize: blockSize, windowSize: windowSize, readAhead: readAhead}
+
+					benchmarkSend(b, bc, benchSize, func(t Transfer) error {
+						return t.Send(path)
+					})
+				})
+			}
+		}
+	}
+}
+
+func BenchmarkSendMmap(b *testing.B) {
+	path := benchFile(b)
+
+	for _, mmap := range []bool{false, true} {
+		b.Run(fmt.Sprintf("mmap=%t", mmap), func(b *testing.B) {
+			benchmarkSend(b, benchCase{blockSize: 1428, windowSize: 4, mmap: mmap}, benchSize, func(t Transfer) error {
+				return t.Send(path)
+			})
+		})
+	}
+}
+
+// slowReader simulates the latency of a disk.
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (s *slowReader) Read(b []byte) (int, error) {
+	time.Sleep(s.delay)
+
+	return s.r.Read(b)
+}
+
+// BenchmarkSendSlowDisk sends from a source taking 1ms per read over a
+// network with a round trip of about 1ms, the read-ahead overlaps both waits
+// instead of adding them up.
+func BenchmarkSendSlowDisk(b *testing.B) {
+	const size = 128 << 10
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), size/16)
+
+	// lockstep only, delayed packets of a window may be reordered
+	for _, readAhead := range []int{0, DefaultReadAhead} {
+		b.Run(fmt.Sprintf("read-ahead=%d", readAhead), func(b *testing.B) {
+			bc := benchCase{blockSize: 512, windowSize: 1, readAhead: readAhead, latency: time.Millisecond}
+
+			benchmarkSend(b, bc, size, func(t Transfer) error {
+				return t.SendFrom(&slowReader{r: bytes.NewReader(content), delay: time.Millisecond})
+			})
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Wa4h1h/go-tftp/pkg/compression"
+)
+
+func compress(t *testing.T, codec *compression.Codec, content string) string {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	w, err := codec.NewWriter(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+func TestWireReadCompressed(t *testing.T) {
+	t.Parallel()
+
+	firmware := strings.Repeat("f", 700)
+
+	for _, codec := range compression.Codecs {
+		t.Run(codec.Name, func(t *testing.T) {
+			t.Parallel()
+
+			w, _ := newWire(t, map[string]string{"fw.bin" + codec.Ext: compress(t, codec, firmware)})
+
+			// tsize is the size of the decompressed content
+			w.send(rrq("fw.bin", "octet", "tsize", "0"))
+			w.expect(oack("tsize", "700"))
+			w.send(ack(0))
+			w.expect(data(1, firmware[:512]))
+			w.send(ack(1))
+			w.expect(data(2, firmware[512:]))
+			w.send(ack(2))
+			w.silent(2 * wireRTO)
+		})
+	}
+}
+
+func TestWireReadPrefersPlainFile(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, map[string]string{"fw.bin": "plain", "fw.bin.gz": compress(t, compression.Gzip, "compressed")})
+
+	w.send(rrq("fw.bin", "octet"))
+	w.expect(data(1, "plain"))
+	w.send(ack(1))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireWriteCompressed(t *testing.T) {
+	t.Parallel()
+
+	w, dir := newWire(t, nil, func(s *Server) { s.SetUploadCompression(compression.Zstd) })
+
+	w.send(wrq("fw.bin", "octet"))
+	w.expect(ack(0))
+	w.send(data(1, "firmware"))
+	w.expect(ack(1))
+	w.silent(2 * wireRTO)
+
+	r, err := compression.Open(filepath.Join(dir, "fw.bin.zst"), compression.Zstd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != "firmware" {
+		t.Fatalf("stored %q", got)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "fw.bin")); !os.IsNotExist(err) {
+		t.Fatalf("the upload should only be stored compressed, got %v", err)
+	}
+}
+
+func TestWireWriteCompressedAborted(t *testing.T) {
+	t.Parallel()
+
+	w, dir := newWire(t, nil, func(s *Server) { s.SetUploadCompression(compression.Gzip) })
+
+	w.send(wrq("fw.bin", "octet"))
+	w.expect(ack(0))
+	w.send(data(1, strings.Repeat("x", 512)))
+	w.expect(ack(1))
+	w.send(errorPacket(0, "cancelled"))
+	w.silent(2 * wireRTO)
+
+	if _, err := os.Stat(filepath.Join(dir, "fw.bin.gz")); !os.IsNotExist(err) {
+		t.Fatalf("the partial upload was kept, got %v", err)
+	}
+
+	// the file is missing rather than served truncated
+	w.send(rrq("fw.bin", "octet"))
+	w.expect(errorPacket(1, dir+"/fw.bin not found"))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireWriteCompressedExists(t *testing.T) {
+	t.Parallel()
+
+	w, dir := newWire(t, map[string]string{"fw.bin.gz": compress(t, compression.Gzip, "firmware")})
+
+	// a plain upload would be served in place of the compressed copy
+	w.send(wrq("fw.bin", "octet"))
+	w.expect(errorPacket(6, dir+"/fw.bin.gz already exists"))
+	w.silent(2 * wireRTO)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -11,6 +12,7 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/Wa4h1h/go-tftp/pkg/compression"
 	"github.com/Wa4h1h/go-tftp/pkg/types"
 )
 
@@ -22,6 +24,21 @@ func notDefinedError() *types.Error {
 	}
 }
 
+// upstreamError returns the error packet forwarding err, errors sent by a
+// remote keep their code and message.
+func upstreamError(err error) *types.Error {
+	var tftpErr *types.TFTPError
+	if !errors.As(err, &tftpErr) {
+		return notDefinedError()
+	}
+
+	return &types.Error{
+		Opcode:    types.OpCodeError,
+		ErrorCode: tftpErr.Code,
+		ErrMsg:    tftpErr.Msg,
+	}
+}
+
 func getFilename(filePath string) string {
 	lastIndex := strings.LastIndex(filePath, "/")
 
@@ -45,6 +62,59 @@ func sendErrorPacket(conn net.Conn, errorPacket *types.Error) error {
 	return nil
 }
 
+func listenNetwork(host string) string {
+	ip := net.ParseIP(strings.SplitN(host, "%", 2)[0])
+
+	switch {
+	case ip == nil || ip.IsUnspecified():
+		return "udp"
+	case ip.To4() != nil:
+		return "udp4"
+	default:
+		return "udp6"
+	}
+}
+
+// ResolveListenAddress expands an interface name into the addresses assigned
+// to it, ip addresses and the empty string (all interfaces) are kept as is.
+func ResolveListenAddress(address string) ([]string, error) {
+	if address == "" || net.ParseIP(strings.SplitN(address, "%", 2)[0]) != nil {
+		return []string{address}, nil
+	}
+
+	iface, err := net.InterfaceByName(address)
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither an ip address nor an interface: %w", address, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("error while reading addresses of %s: %w", address, err)
+	}
+
+	hosts := make([]string, 0, len(addrs))
+
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		host := ipNet.IP.String()
+		if ipNet.IP.IsLinkLocalUnicast() && ipNet.IP.To4() == nil {
+			host = fmt.Sprintf("%s%%%s", host, iface.Name)
+		}
+
+		hosts = append(hosts, host)
+	}
+
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("interface %s has no addresses", address)
+	}
+
+	return hosts, nil
+}
+
 type control func(network, address string, c syscall.RawConn) error
 
 func reusePort() control {
@@ -62,45 +132,30 @@ func reusePort() control {
 	}
 }
 
-func assertSenderFile(l *zap.SugaredLogger, c net.Conn, filename string) (bool, error) {
-	errPacket := notDefinedError()
+// checkReceiverFile refuses to overwrite filename, or one of its copies
+// compressed with codecs which would be served in its place.
+func checkReceiverFile(l *zap.SugaredLogger, filename string, codecs []*compression.Codec) *types.Error {
+	paths := []string{filename}
+	for _, c := range codecs {
+		paths = append(paths, filename+c.Ext)
+	}
 
-	_, err := os.Stat(filename)
-	if err != nil {
-		if os.IsNotExist(err) {
-			errPacket = &types.Error{
+	for _, path := range paths {
+		_, err := os.Stat(path)
+
+		switch {
+		case err == nil:
+			return &types.Error{
 				Opcode:    types.OpCodeError,
-				ErrorCode: types.ErrFileNotFound,
-				ErrMsg:    fmt.Sprintf("%s not found", filename),
+				ErrorCode: types.ErrFileAlreadyExists,
+				ErrMsg:    fmt.Sprintf("%s already exists", path),
 			}
-		} else {
+		case !os.IsNotExist(err):
 			l.Errorf("error while checking file exists: %s", err.Error())
-		}
-
-		return false, sendErrorPacket(c, errPacket)
-	}
-
-	return true, nil
-}
 
-func assertReceiverFile(l *zap.SugaredLogger, c net.Conn, filename string) (bool, error) {
-	errPacket := notDefinedError()
-	_, err := os.Stat(filename)
-
-	switch {
-	case err == nil:
-		errPacket = &types.Error{
-			Opcode:    types.OpCodeError,
-			ErrorCode: types.ErrFileAlreadyExists,
-			ErrMsg:    fmt.Sprintf("%s already exists", filename),
+			return notDefinedError()
 		}
-
-		return false, sendErrorPacket(c, errPacket)
-	case !os.IsNotExist(err):
-		l.Errorf("error while checking file exists: %s", err.Error())
-
-		return false, sendErrorPacket(c, errPacket)
 	}
 
-	return true, nil
+	return nil
 }
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+type memAddr string
+
+func (a memAddr) Network() string { return "mem" }
+func (a memAddr) String() string  { return string(a) }
+
+// memConn is one end of an in-memory datagram transport. filter decides
+// which copies of a written packet reach the peer, it can drop, duplicate or
+// hold back packets.
+type memConn struct {
+	name   string
+	in     chan []byte
+	peer   *memConn
+	closed chan struct{}
+	once   sync.Once
+
+	mu       sync.Mutex
+	deadline time.Time
+	writes   int
+	filter   func(n int, b []byte) [][]byte
+}
+
+// memPipe returns two connected ends of an in-memory transport.
+func memPipe() (*memConn, *memConn) {
+	a := &memConn{name: "a", in: make(chan []byte, 1024), closed: make(chan struct{})}
+	b := &memConn{name: "b", in: make(chan []byte, 1024), closed: make(chan struct{})}
+	a.peer, b.peer = b, a
+
+	return a, b
+}
+
+// setFilter sets the impairment applied to the written packets, n counts the
+// writes from 1.
+func (c *memConn) setFilter(filter func(n int, b []byte) [][]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.filter = filter
+}
+
+func (c *memConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+
+	var timeout <-chan time.Time
+
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+
+		timeout = timer.C
+	}
+
+	select {
+	case p := <-c.in:
+		return copy(b, p), nil
+	case <-c.closed:
+		return 0, net.ErrClosed
+	case <-timeout:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *memConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	c.mu.Lock()
+	c.writes++
+	packets := [][]byte{b}
+
+	if c.filter != nil {
+		packets = c.filter(c.writes, b)
+	}
+	c.mu.Unlock()
+
+	for _, p := range packets {
+		select {
+		case c.peer.in <- append([]byte(nil), p...):
+		default:
+			// a full queue drops the packet like a full socket buffer
+		}
+	}
+
+	return len(b), nil
+}
+
+func (c *memConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+
+	return nil
+}
+
+func (c *memConn) LocalAddr() net.Addr  { return memAddr(c.name) }
+func (c *memConn) RemoteAddr() net.Addr { return memAddr(c.peer.name) }
+
+func (c *memConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *memConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.deadline = t
+
+	return nil
+}
+
+func (c *memConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+
+	"golang.org/x/sys/unix"
+)
+
+var errEmptyFile = errors.New("error: can not map an empty file")
+
+// mappedFile reads a file mapped into memory. The mapping is shared, reading
+// past the end of a file truncated after it was mapped faults, Read turns the
+// fault into an error failing the transfer instead of crashing the server.
+type mappedFile struct {
+	r    *bytes.Reader
+	data []byte
+}
+
+func mapFile(f *os.File) (*mappedFile, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error while reading file size: %w", err)
+	}
+
+	size := info.Size()
+	if size == 0 {
+		return nil, errEmptyFile
+	}
+
+	if size != int64(int(size)) {
+		return nil, fmt.Errorf("error: file of %d bytes is too large to map", size)
+	}
+
+	data, err := unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("error while mapping file: %w", err)
+	}
+
+	// pages are read ahead by the kernel and dropped once sent
+	_ = unix.Madvise(data, unix.MADV_SEQUENTIAL)
+
+	return &mappedFile{r: bytes.NewReader(data), data: data}, nil
+}
+
+// Read copies from the mapping with faults turned into panics for the calling
+// goroutine, a fault is recovered as an error.
+func (m *mappedFile) Read(p []byte) (n int, err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		fault, ok := r.(interface{ Addr() uintptr })
+		if !ok {
+			panic(r)
+		}
+
+		n, err = 0, fmt.Errorf("error: mapped file changed while read, fault at %#x", fault.Addr())
+	}()
+
+	return m.r.Read(p)
+}
+
+func (m *mappedFile) Seek(offset int64, whence int) (int64, error) {
+	return m.r.Seek(offset, whence)
+}
+
+func (m *mappedFile) Close() error {
+	return unix.Munmap(m.data)
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMappedFileTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, make([]byte, 3*os.Getpagesize()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	m, err := mapFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer m.Close()
+
+	// the pages past the new end fault, the read fails instead of crashing
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := io.ReadAll(m); err == nil {
+		t.Fatal("read a truncated mapping without error")
+	}
+}
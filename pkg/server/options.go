@@ -0,0 +1,90 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+)
+
+type TransferOptions struct {
+	BlockSize  int
+	WindowSize int
+	Timeout    time.Duration
+	Size       int64
+	Offset     int64
+}
+
+func parseOption(opts types.Options, name string, minVal int64, maxVal int64) (int64, bool) {
+	val, ok := opts.Get(name)
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || n < minVal {
+		return 0, false
+	}
+
+	return min(n, maxVal), true
+}
+
+// needsSize reports whether negotiating the options of req needs the size of
+// the file, for tsize or to check an offset.
+func needsSize(req *types.Request) bool {
+	_, tsize := req.Options.Get(types.OptionTransferSize)
+	_, offset := req.Options.Get(types.OptionOffset)
+
+	return tsize || offset
+}
+
+// NegotiateOptions picks the options of req the server supports, size is the
+// size of the requested file for reads. Reads of octet files can start at an
+// offset, values past the end of the file are ignored. It returns the options to apply to
+// the transfer and the ones to acknowledge, no OACK has to be sent when the
+// latter is empty.
+func NegotiateOptions(req *types.Request, size int64) (*TransferOptions, types.Options) {
+	opts := &TransferOptions{Size: -1}
+	// modes are case insensitive (RFC 1350)
+	netascii := strings.EqualFold(req.Mode, types.ModeNetascii)
+
+	var oack types.Options
+
+	if n, ok := parseOption(req.Options, types.OptionBlockSize, types.MinBlockSize, types.MaxBlockSize); ok {
+		opts.BlockSize = int(n)
+		oack.Set(types.OptionBlockSize, strconv.FormatInt(n, 10))
+	}
+
+	if n, ok := parseOption(req.Options, types.OptionWindowSize, 1, types.MaxWindowSize); ok {
+		opts.WindowSize = int(n)
+		oack.Set(types.OptionWindowSize, strconv.FormatInt(n, 10))
+	}
+
+	if val, ok := req.Options.Get(types.OptionTimeout); ok {
+		// the timeout can not be changed by the server, drop invalid values
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n >= 1 && n <= types.MaxTimeout {
+			opts.Timeout = time.Duration(n) * time.Second
+			oack.Set(types.OptionTimeout, val)
+		}
+	}
+
+	if n, ok := parseOption(req.Options, types.OptionTransferSize, 0, 1<<62); ok {
+		switch {
+		case req.Opcode == types.OpCodeWRQ:
+			opts.Size = n
+			oack.Set(types.OptionTransferSize, strconv.FormatInt(n, 10))
+		case size >= 0 && !netascii:
+			opts.Size = size
+			oack.Set(types.OptionTransferSize, strconv.FormatInt(size, 10))
+		}
+	}
+
+	if n, ok := parseOption(req.Options, types.OptionOffset, 1, 1<<62); ok && n <= size &&
+		req.Opcode == types.OpCodeRRQ && !netascii {
+		opts.Offset = n
+		oack.Set(types.OptionOffset, strconv.FormatInt(n, 10))
+	}
+
+	return opts, oack
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/proxy"
+)
+
+func proxyTo(t *testing.T, handler http.Handler) func(s *Server) {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	p, err := proxy.New(map[string]string{"artifacts": srv.URL + "/pxe"}, t.TempDir(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return func(s *Server) { s.SetProxy(p) }
+}
+
+func TestWireReadProxied(t *testing.T) {
+	t.Parallel()
+
+	kernel := strings.Repeat("k", 600)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pxe/boot/kernel" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		w.Write([]byte(kernel))
+	})
+
+	w, _ := newWire(t, nil, proxyTo(t, handler))
+
+	// tsize is the Content-Length of the upstream
+	w.send(rrq("artifacts/boot/kernel", "octet", "tsize", "0"))
+	w.expect(oack("tsize", "600"))
+	w.send(ack(0))
+	w.expect(data(1, kernel[:512]))
+	w.send(ack(1))
+	w.expect(data(2, kernel[512:]))
+	w.send(ack(2))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadProxiedNotFound(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, nil, proxyTo(t, http.NotFoundHandler()))
+
+	w.send(rrq("artifacts/missing", "octet"))
+	w.expect(errorPacket(1, "artifacts/missing not found"))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireWriteProxied(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, nil, proxyTo(t, http.NotFoundHandler()))
+
+	w.send(wrq("artifacts/upload", "octet"))
+	w.expect(errorPacket(2, "artifacts/upload is served by an upstream"))
+	w.silent(2 * wireRTO)
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// DefaultReadAhead is the number of blocks the server reads ahead of the
+// transmitted window.
+const DefaultReadAhead = 8
+
+// dataHeaderSize is the opcode and block# of a DATA packet.
+const dataHeaderSize = 4
+
+// blockSource yields the blocks of a transfer in order as DATA packet
+// buffers: dataHeaderSize free bytes followed by the payload. A buffer is
+// given back with release once its block is acknowledged.
+type blockSource interface {
+	next() (packet []byte, last bool, err error)
+	release(packet []byte)
+	close()
+}
+
+// syncSource reads each block when it is asked for.
+type syncSource struct {
+	r         io.Reader
+	blockSize int
+	free      [][]byte
+}
+
+func newSyncSource(r io.Reader, blockSize int) *syncSource {
+	return &syncSource{r: r, blockSize: blockSize}
+}
+
+func (s *syncSource) next() ([]byte, bool, error) {
+	var packet []byte
+
+	if len(s.free) > 0 {
+		packet = s.free[len(s.free)-1]
+		s.free = s.free[:len(s.free)-1]
+	} else {
+		packet = make([]byte, dataHeaderSize+s.blockSize)
+	}
+
+	n, last, err := readBlock(s.r, packet[dataHeaderSize:dataHeaderSize+s.blockSize])
+
+	return packet[:dataHeaderSize+n], last, err
+}
+
+func (s *syncSource) release(packet []byte) {
+	s.free = append(s.free, packet)
+}
+
+func (s *syncSource) close() {}
+
+// readAhead reads blocks in a goroutine and keeps up to depth of them ready
+// besides the ones in flight, so that a slow disk does not stall the round
+// trips of the transfer. Buffers are allocated when no released one is free,
+// up to limit, small files only allocate the blocks they need.
+type readAhead struct {
+	blocks chan aheadBlock
+	free   chan []byte
+	done   chan struct{}
+	exited chan struct{}
+	// allocated is only used by the reading goroutine
+	allocated int
+	limit     int
+}
+
+type aheadBlock struct {
+	err    error
+	packet []byte
+	last   bool
+}
+
+// newReadAhead starts reading r. inFlight is the number of blocks the caller
+// holds at most before releasing them, the window size.
+func newReadAhead(r io.Reader, blockSize int, depth int, inFlight int) *readAhead {
+	ra := &readAhead{
+		blocks: make(chan aheadBlock, depth),
+		free:   make(chan []byte, depth+inFlight),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+		limit:  depth + inFlight,
+	}
+
+	go ra.read(r, blockSize)
+
+	return ra
+}
+
+func (ra *readAhead) read(r io.Reader, blockSize int) {
+	defer close(ra.exited)
+
+	for {
+		packet, ok := ra.buffer(blockSize)
+		if !ok {
+			return
+		}
+
+		n, last, err := readBlock(r, packet[dataHeaderSize:dataHeaderSize+blockSize])
+
+		select {
+		case ra.blocks <- aheadBlock{packet: packet[:dataHeaderSize+n], last: last, err: err}:
+		case <-ra.done:
+			return
+		}
+
+		if last || err != nil {
+			return
+		}
+	}
+}
+
+// buffer returns a released buffer, a new one while fewer than limit are
+// allocated, or waits for a release. ok is false once the source is closed.
+func (ra *readAhead) buffer(blockSize int) ([]byte, bool) {
+	select {
+	case packet := <-ra.free:
+		return packet, true
+	default:
+	}
+
+	if ra.allocated < ra.limit {
+		ra.allocated++
+
+		return make([]byte, dataHeaderSize+blockSize), true
+	}
+
+	select {
+	case packet := <-ra.free:
+		return packet, true
+	case <-ra.done:
+		return nil, false
+	}
+}
+
+func (ra *readAhead) next() ([]byte, bool, error) {
+	b := <-ra.blocks
+
+	return b.packet, b.last, b.err
+}
+
+func (ra *readAhead) release(packet []byte) {
+	ra.free <- packet[:cap(packet)]
+}
+
+// close stops the reading goroutine and waits for it, the reader can be
+// closed once it returns.
+func (ra *readAhead) close() {
+	close(ra.done)
+	<-ra.exited
+}
+
+// blocks returns the source of the blocks read from r. Content already in
+// memory, such as a cached file, is never read ahead.
+func (c *Connection) blocks(r io.Reader) blockSource {
+	if _, inMemory := r.(*bytes.Reader); inMemory || c.readAhead <= 0 {
+		return newSyncSource(r, c.blockSize)
+	}
+
+	return newReadAhead(r, c.blockSize, c.readAhead, c.windowSize)
+}
+
+// readBlock fills block from r, last is set once r is exhausted. The last
+// block is shorter than the block size, it is empty when the source is empty
+// or its size is a multiple of the block size (RFC 1350).
+func readBlock(r io.Reader, block []byte) (int, bool, error) {
+	n, err := io.ReadFull(r, block)
+
+	switch {
+	case err == nil:
+		return n, false, nil
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return n, true, nil
+	default:
+		return n, false, err
+	}
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/cache"
+	"go.uber.org/zap"
+)
+
+// drain reads every block of src, releasing them in windows of windowSize.
+func drain(t *testing.T, src blockSource, windowSize int) ([]byte, int, error) {
+	t.Helper()
+
+	var (
+		got    []byte
+		blocks int
+		window [][]byte
+	)
+
+	for {
+		packet, last, err := src.next()
+		if err != nil {
+			return got, blocks, err
+		}
+
+		got = append(got, packet[dataHeaderSize:]...)
+		blocks++
+		window = append(window, packet)
+
+		if last || len(window) == windowSize {
+			for _, p := range window {
+				src.release(p)
+			}
+
+			window = window[:0]
+		}
+
+		if last {
+			return got, blocks, nil
+		}
+	}
+}
+
+func TestBlockSources(t *testing.T) {
+	const blockSize = 8
+
+	sources := map[string]func(r io.Reader) blockSource{
+		"sync": func(r io.Reader) blockSource { return newSyncSource(r, blockSize) },
+		"read-ahead": func(r io.Reader) blockSource {
+			return newReadAhead(r, blockSize, 2, 3)
+		},
+	}
+
+	for name, newSource := range sources {
+		for _, size := range []int{0, 1, blockSize, 5*blockSize + 3, 8 * blockSize} {
+			content := bytes.Repeat([]byte{'x'}, size)
+
+			// readers returning one byte at a time must still fill blocks
+			src := newSource(iotest.OneByteReader(bytes.NewReader(content)))
+
+			got, blocks, err := drain(t, src, 3)
+			src.close()
+
+			if err != nil {
+				t.Fatalf("%s source of %d bytes: %v", name, size, err)
+			}
+
+			if !bytes.Equal(got, content) || blocks != size/blockSize+1 {
+				t.Fatalf("%s source of %d bytes: read %d bytes in %d blocks", name, size, len(got), blocks)
+			}
+		}
+	}
+}
+
+func TestReadAheadError(t *testing.T) {
+	errDisk := errors.New("disk error")
+	src := newReadAhead(io.MultiReader(bytes.NewReader(make([]byte, 20)), iotest.ErrReader(errDisk)), 8, 4, 1)
+
+	defer src.close()
+
+	if _, _, err := drain(t, src, 1); !errors.Is(err, errDisk) {
+		t.Fatalf("expected the read error, got %v", err)
+	}
+}
+
+func TestReadAheadAllocatesLazily(t *testing.T) {
+	// a small file allocates the blocks it needs, a large one the bound
+	for size, want := range map[int]int{10: 2, 1 << 20: 5} {
+		src := newReadAhead(bytes.NewReader(make([]byte, size)), 8, 4, 1)
+
+		if _, _, err := drain(t, src, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		// allocated is read once the reading goroutine exited
+		src.close()
+
+		if src.allocated > want {
+			t.Errorf("read %d bytes with %d buffers, want at most %d", size, src.allocated, want)
+		}
+	}
+}
+
+func TestReadAheadClose(t *testing.T) {
+	src := newReadAhead(bytes.NewReader(make([]byte, 1<<20)), 512, 4, 1)
+
+	if _, _, err := src.next(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		src.close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("close blocked on the reading goroutine")
+	}
+}
+
+func TestSendFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	path := filepath.Join(t.TempDir(), "file")
+
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path+".empty", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		file      string
+		content   []byte
+		readAhead int
+		mmap      bool
+		// cacheSize is the budget of the file cache, 0 sends without cache
+		cacheSize int64
+	}{
+		{"read", path, content, 0, false, 0},
+		{"read-ahead", path, content, 4, false, 0},
+		{"mmap", path, content, 0, true, 0},
+		{"mmap read-ahead", path, content, 4, true, 0},
+		{"mmap empty file", path + ".empty", nil, 0, true, 0},
+		{"cache", path, content, 4, false, 1 << 20},
+		{"cache empty file", path + ".empty", nil, 4, false, 1 << 20},
+		{"file larger than cache", path, content, 4, false, 100},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := memPipe()
+			defer a.Close()
+			defer b.Close()
+
+			sender := NewTransfer(a, zap.NewNop().Sugar(), time.Second, time.Second, 5, false)
+			receiver := NewTransfer(b, zap.NewNop().Sugar(), time.Second, time.Second, 5, false)
+
+			opts := &TransferOptions{BlockSize: 512, WindowSize: 4, Size: -1, Offset: 0}
+			sender.SetOptions(opts)
+			receiver.SetOptions(opts)
+			sender.SetReadAhead(tc.readAhead)
+			sender.SetMmap(tc.mmap)
+
+			if tc.cacheSize > 0 {
+				sender.SetCache(cache.New(tc.cacheSize))
+			}
+
+			errc := make(chan error, 1)
+
+			go func() {
+				errc <- sender.Send(tc.file)
+			}()
+
+			var got bytes.Buffer
+
+			if err := receiver.ReceiveTo(&got); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got.Bytes(), tc.content) {
+				t.Fatalf("received %d bytes, expected %d", got.Len(), len(tc.content))
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"io"
+
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+// Relay forwards requests to upstream TFTP servers. Each leg of a relayed
+// transfer retransmits on its own, the content is streamed between them.
+type Relay interface {
+	// Route returns the upstream location of filename for logs and audit
+	// entries, ok is false when filename is not relayed.
+	Route(filename string) (upstream string, ok bool)
+	// Open downloads filename from its upstream, size is -1 when the
+	// upstream did not announce it.
+	Open(ctx context.Context, filename string) (r io.ReadCloser, size int64, err error)
+	// Create uploads filename to its upstream once the upstream accepted the
+	// request, size is -1 when unknown.
+	Create(ctx context.Context, filename string, size int64) (RelayWriter, error)
+}
+
+// RelayWriter streams an upload to an upstream. Close waits for the upstream
+// to acknowledge the content, CloseWithError aborts the upload.
+type RelayWriter interface {
+	io.WriteCloser
+	CloseWithError(err error) error
+}
+
+// SetRelay forwards the following requests routed by r to its upstreams, nil
+// disables relaying.
+func (s *Server) SetRelay(r Relay) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.relay = r
+}
+
+// relaySource streams the file of location through r. Downloads announce
+// the size of the upstream, uploads are created once the upstream accepted
+// them so that its errors reach the client.
+func relaySource(r Relay, location string) *source {
+	return &source{
+		path: location,
+		open: func(ctx context.Context, req *types.Request) (*content, error) {
+			body, size, err := r.Open(ctx, req.Filename)
+			if err != nil {
+				return nil, err
+			}
+
+			// relayed downloads resume at an offset by discarding the content
+			// before it
+			seeker := utils.NewForwardSeeker(body, size)
+
+			return &content{r: &seeker, size: size, close: body.Close}, nil
+		},
+		create: func(ctx context.Context, req *types.Request) (sink, error) {
+			size, ok := parseOption(req.Options, types.OptionTransferSize, 0, 1<<62)
+			if !ok {
+				size = -1
+			}
+
+			return r.Create(ctx, req.Filename, size)
+		},
+	}
+}
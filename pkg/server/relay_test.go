@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+)
+
+// fakeRelay relays the files below up/, closing uploads fails with closeErr.
+type fakeRelay struct {
+	files    map[string]string
+	closeErr error
+	uploaded chan string
+}
+
+func (f *fakeRelay) Route(filename string) (string, bool) {
+	rest, ok := strings.CutPrefix(filename, "up/")
+
+	return "tftp://upstream/" + rest, ok
+}
+
+func (f *fakeRelay) Open(_ context.Context, filename string) (io.ReadCloser, int64, error) {
+	content, ok := f.files[strings.TrimPrefix(filename, "up/")]
+	if !ok {
+		return nil, 0, (&types.Error{ErrorCode: types.ErrFileNotFound, ErrMsg: "not on upstream"}).Err()
+	}
+
+	return io.NopCloser(strings.NewReader(content)), int64(len(content)), nil
+}
+
+func (f *fakeRelay) Create(context.Context, string, int64) (RelayWriter, error) {
+	return &fakeUpload{relay: f}, nil
+}
+
+type fakeUpload struct {
+	bytes.Buffer
+	relay *fakeRelay
+}
+
+func (u *fakeUpload) Close() error {
+	if u.relay.closeErr != nil {
+		return u.relay.closeErr
+	}
+
+	u.relay.uploaded <- u.String()
+
+	return nil
+}
+
+func (u *fakeUpload) CloseWithError(error) error {
+	return nil
+}
+
+func relayTo(r *fakeRelay) func(s *Server) {
+	return func(s *Server) { s.SetRelay(r) }
+}
+
+func TestWireReadRelayed(t *testing.T) {
+	t.Parallel()
+
+	kernel := strings.Repeat("k", 600)
+	w, _ := newWire(t, nil, relayTo(&fakeRelay{files: map[string]string{"kernel": kernel}}))
+
+	// tsize is the size announced by the upstream
+	w.send(rrq("up/kernel", "octet", "tsize", "0"))
+	w.expect(oack("tsize", "600"))
+	w.send(ack(0))
+	w.expect(data(1, kernel[:512]))
+	w.send(ack(1))
+	w.expect(data(2, kernel[512:]))
+	w.send(ack(2))
+	w.silent(2 * wireRTO)
+
+	// errors of the upstream are forwarded
+	w.send(rrq("up/missing", "octet"))
+	w.expect(errorPacket(1, "not on upstream"))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireWriteRelayed(t *testing.T) {
+	t.Parallel()
+
+	r := &fakeRelay{uploaded: make(chan string, 1)}
+	w, _ := newWire(t, nil, relayTo(r))
+
+	w.send(wrq("up/upload", "octet"))
+	w.expect(ack(0))
+	w.send(data(1, "config"))
+	w.expect(ack(1))
+	w.silent(2 * wireRTO)
+
+	if got := <-r.uploaded; got != "config" {
+		t.Fatalf("relayed %q", got)
+	}
+}
+
+func TestWireWriteRelayedUpstreamFails(t *testing.T) {
+	t.Parallel()
+
+	r := &fakeRelay{closeErr: (&types.Error{ErrorCode: types.ErrDiskFull, ErrMsg: "upstream full"}).Err()}
+	w, _ := newWire(t, nil, relayTo(r))
+
+	// the last block is not acknowledged when the upstream rejects it
+	w.send(wrq("up/upload", "octet"))
+	w.expect(ack(0))
+	w.send(data(1, "config"))
+	w.expect(errorPacket(3, "upstream full"))
+	w.silent(2 * wireRTO)
+}
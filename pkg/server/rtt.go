@@ -0,0 +1,58 @@
+package server
+
+import "time"
+
+// DefaultMinRTO is the lower bound of the adaptive retransmission timeout.
+// RFC 6298 recommends one second, which is far too slow to recover from a
+// loss on a LAN.
+const DefaultMinRTO = 200 * time.Millisecond
+
+// rttEstimator derives the retransmission timeout of a transfer from the
+// measured round trip times as described in RFC 6298.
+type rttEstimator struct {
+	srtt    time.Duration
+	rttvar  time.Duration
+	rto     time.Duration
+	min     time.Duration
+	max     time.Duration
+	samples int
+}
+
+// newRTTEstimator returns an estimator starting with the initial timeout,
+// timeouts are kept within [minRTO, maxRTO].
+func newRTTEstimator(initial time.Duration, minRTO time.Duration, maxRTO time.Duration) *rttEstimator {
+	r := &rttEstimator{min: minRTO, max: maxRTO}
+	r.rto = r.bound(initial)
+
+	return r
+}
+
+func (r *rttEstimator) bound(rto time.Duration) time.Duration {
+	return min(max(rto, r.min), r.max)
+}
+
+// sample updates the estimation with the round trip time of a packet that
+// was sent only once (Karn's algorithm).
+func (r *rttEstimator) sample(rtt time.Duration) {
+	if r.samples == 0 {
+		r.srtt = rtt
+		r.rttvar = rtt / 2
+	} else {
+		diff := r.srtt - rtt
+		if diff < 0 {
+			diff = -diff
+		}
+
+		r.rttvar = (3*r.rttvar + diff) / 4
+		r.srtt = (7*r.srtt + rtt) / 8
+	}
+
+	r.samples++
+	r.rto = r.bound(r.srtt + max(4*r.rttvar, time.Millisecond))
+}
+
+// expired doubles the timeout after a retransmission timer expired, the
+// backed off value is kept until the next sample.
+func (r *rttEstimator) expired() {
+	r.rto = r.bound(2 * r.rto)
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRTTEstimator(t *testing.T) {
+	r := newRTTEstimator(5*time.Second, 100*time.Millisecond, 3*time.Second)
+	if r.rto != 3*time.Second {
+		t.Fatalf("initial timeout %s not bounded by max", r.rto)
+	}
+
+	r.sample(100 * time.Millisecond)
+
+	if r.srtt != 100*time.Millisecond || r.rttvar != 50*time.Millisecond || r.rto != 300*time.Millisecond {
+		t.Fatalf("unexpected first estimation srtt=%s rttvar=%s rto=%s", r.srtt, r.rttvar, r.rto)
+	}
+
+	r.sample(200 * time.Millisecond)
+
+	// rttvar = 3/4*50ms + 1/4*100ms, srtt = 7/8*100ms + 1/8*200ms
+	if r.srtt != 112500*time.Microsecond || r.rttvar != 62500*time.Microsecond || r.rto != 362500*time.Microsecond {
+		t.Fatalf("unexpected estimation srtt=%s rttvar=%s rto=%s", r.srtt, r.rttvar, r.rto)
+	}
+
+	for range 5 {
+		r.expired()
+	}
+
+	if r.rto != 3*time.Second {
+		t.Fatalf("backed off timeout %s not bounded by max", r.rto)
+	}
+
+	for range 50 {
+		r.sample(time.Millisecond)
+	}
+
+	if r.rto != 100*time.Millisecond {
+		t.Fatalf("timeout %s not bounded by min", r.rto)
+	}
+}
@@ -2,82 +2,390 @@ package server
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
+	"github.com/Wa4h1h/go-tftp/pkg/archive"
+	"github.com/Wa4h1h/go-tftp/pkg/audit"
+	"github.com/Wa4h1h/go-tftp/pkg/backoff"
+	"github.com/Wa4h1h/go-tftp/pkg/cache"
+	"github.com/Wa4h1h/go-tftp/pkg/compression"
+	"github.com/Wa4h1h/go-tftp/pkg/proxy"
 	"github.com/Wa4h1h/go-tftp/pkg/types"
 	"github.com/Wa4h1h/go-tftp/pkg/utils"
 	"go.uber.org/zap"
 )
 
 type Server struct {
+	addresses    []string
 	port         string
 	tftpFolder   string
 	logger       *zap.SugaredLogger
-	conn         net.PacketConn
+	conns        []net.PacketConn
+	audit        audit.Recorder
+	mu           sync.RWMutex
 	numTries     int
 	readTimeout  uint
 	writeTimeout uint
+	backoff      backoff.Policy
+	minRTO       time.Duration
+	maxRTO       time.Duration
 	trace        bool
+	// wrapListener and wrapConn decorate the sockets of the server, tests
+	// use them to simulate an impaired network
+	wrapListener func(conn net.PacketConn) net.PacketConn
+	wrapConn     func(conn net.Conn) net.Conn
+	// readAhead and mmap tune how files are read, see
+	// Connection.SetReadAhead and Connection.SetMmap
+	readAhead int
+	mmap      bool
+	// cache is shared by the transfers of the server, nil when disabled
+	cache *cache.Cache
+	// archives holds the archives served by members when archive serving is
+	// enabled
+	archives      *archive.Mounts
+	serveArchives bool
+	// sizes caches the decompressed size of compressed files, uploads are
+	// stored compressed with uploadCodec unless it is nil
+	sizes       *compression.SizeIndex
+	uploadCodec *compression.Codec
+	// proxy fetches the files below its prefixes from http upstreams, nil
+	// when no upstream is configured
+	proxy *proxy.Proxy
+	// relay forwards the requests it routes to upstream tftp servers, nil
+	// when relaying is disabled
+	relay Relay
 }
 
-func NewServer(l *zap.SugaredLogger, port string, readTimeout uint,
+func NewServer(l *zap.SugaredLogger, addresses []string, port string, readTimeout uint,
 	writeTimeout uint, numTries int, tftpFolder string, trace bool,
 ) *Server {
+	if len(addresses) == 0 {
+		addresses = []string{""}
+	}
+
 	return &Server{
-		logger: l, port: port,
+		logger: l, addresses: addresses, port: port,
 		readTimeout:  readTimeout,
 		writeTimeout: writeTimeout,
 		numTries:     numTries,
 		tftpFolder:   tftpFolder,
 		trace:        trace,
+		backoff:      backoff.Fixed{},
+		minRTO:       DefaultMinRTO,
+		readAhead:    DefaultReadAhead,
+		archives:     archive.NewMounts(),
+		sizes:        compression.NewSizeIndex(),
 	}
 }
 
-func (s *Server) ListenAndServe() error {
+func (s *Server) SetTransferOptions(readTimeout uint, writeTimeout uint, numTries int, trace bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.readTimeout = readTimeout
+	s.writeTimeout = writeTimeout
+	s.numTries = numTries
+	s.trace = trace
+}
+
+// SetBackoff sets the policy spacing retransmissions of the following
+// transfers.
+func (s *Server) SetBackoff(p backoff.Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.backoff = p
+}
+
+// SetRTO bounds the adaptive retransmission timeout of the following
+// transfers, see Connection.SetRTO.
+func (s *Server) SetRTO(minRTO time.Duration, maxRTO time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.minRTO = minRTO
+	s.maxRTO = maxRTO
+}
+
+// SetReadAhead sets the number of blocks read in advance by the following
+// reads, 0 disables the read-ahead.
+func (s *Server) SetReadAhead(blocks int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.readAhead = blocks
+}
+
+// SetMmap makes the following reads map the served files into memory.
+func (s *Server) SetMmap(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mmap = enabled
+}
+
+// SetCacheSize sets the memory budget in bytes of the cache of served files,
+// 0 disables it. Changing the budget keeps the cached files that still fit.
+func (s *Server) SetCacheSize(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case size <= 0:
+		s.cache = nil
+	case s.cache == nil:
+		s.cache = cache.New(size)
+	default:
+		s.cache.SetBudget(size)
+	}
+}
+
+// CacheStats returns the counters of the cache, ok is false when it is
+// disabled.
+func (s *Server) CacheStats() (cache.Stats, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.cache == nil {
+		return cache.Stats{}, false
+	}
+
+	return s.cache.Stats(), true
+}
+
+// SetArchives makes requests such as release.iso/casper/vmlinuz read the
+// member casper/vmlinuz of the archive release.iso of the tftp folder.
+func (s *Server) SetArchives(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.serveArchives = enabled
+}
+
+// SetUploadCompression stores the following uploads compressed with codec,
+// nil stores them as received.
+func (s *Server) SetUploadCompression(codec *compression.Codec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.uploadCodec = codec
+}
+
+// SetProxy serves the following requests matching a prefix of p from its
+// upstream, nil disables the proxy.
+func (s *Server) SetProxy(p *proxy.Proxy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.proxy = p
+}
+
+// SetListenerWrapper wraps the listening sockets opened by the next Listen.
+func (s *Server) SetListenerWrapper(wrap func(conn net.PacketConn) net.PacketConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wrapListener = wrap
+}
+
+// SetConnWrapper wraps the socket of each following transfer.
+func (s *Server) SetConnWrapper(wrap func(conn net.Conn) net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wrapConn = wrap
+}
+
+func (s *Server) newTransfer(conn net.Conn) Transfer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.wrapConn != nil {
+		conn = s.wrapConn(conn)
+	}
+
+	t := NewTransfer(conn, s.logger,
+		time.Duration(s.readTimeout)*time.Second,
+		time.Duration(s.writeTimeout)*time.Second,
+		s.numTries, s.trace)
+	t.SetBackoff(s.backoff)
+	t.SetRTO(s.minRTO, s.maxRTO)
+	t.SetReadAhead(s.readAhead)
+	t.SetMmap(s.mmap)
+	t.SetCache(s.cache)
+
+	return t
+}
+
+// SetAuditRecorder records the following transfers with r, nil disables the
+// audit log.
+func (s *Server) SetAuditRecorder(r audit.Recorder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.audit = r
+}
+
+func (s *Server) Listen() error {
 	l := net.ListenConfig{
 		Control: reusePort(),
 	}
 
-	conn, err := l.ListenPacket(context.Background(), "udp", fmt.Sprintf(":%s", s.port))
-	if err != nil {
-		s.logger.Error(err.Error())
+	var hosts []string
+
+	for _, address := range s.addresses {
+		resolved, err := ResolveListenAddress(address)
+		if err != nil {
+			s.logger.Error(err.Error())
+
+			return utils.ErrStartingServer
+		}
+
+		hosts = append(hosts, resolved...)
+	}
+
+	conns := make([]net.PacketConn, 0, len(hosts))
+
+	for _, host := range hosts {
+		conn, err := l.ListenPacket(context.Background(), listenNetwork(host), net.JoinHostPort(host, s.port))
+		if err != nil {
+			s.logger.Error(err.Error())
+
+			for _, c := range conns {
+				c.Close()
+			}
+
+			return utils.ErrStartingServer
+		}
+
+		conns = append(conns, conn)
+	}
 
-		return utils.ErrStartingServer
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wrapListener != nil {
+		for i, conn := range conns {
+			conns[i] = s.wrapListener(conn)
+		}
 	}
 
-	s.conn = conn
-	datagram := make([]byte, types.DatagramSize)
+	s.conns = conns
 
+	return nil
+}
+
+func (s *Server) Addrs() []net.Addr {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	addrs := make([]net.Addr, 0, len(s.conns))
+	for _, conn := range s.conns {
+		addrs = append(addrs, conn.LocalAddr())
+	}
+
+	return addrs
+}
+
+func (s *Server) Serve() error {
+	s.mu.RLock()
+	conns := s.conns
+	s.mu.RUnlock()
+
+	errs := make(chan error, len(conns))
+
+	for _, conn := range conns {
+		go func(conn net.PacketConn) {
+			errs <- s.serve(conn)
+		}(conn)
+	}
+
+	var err error
+
+	for range conns {
+		if errServe := <-errs; errServe != nil && err == nil {
+			err = errServe
+		}
+	}
+
+	return err
+}
+
+func (s *Server) serve(conn net.PacketConn) error {
 	for {
-		n, addr, err := conn.ReadFrom(datagram)
-		if err != nil && !errors.Is(err, net.ErrClosed) {
+		buffer := types.GetDatagram()
+
+		n, addr, err := conn.ReadFrom(*buffer)
+		if err != nil {
+			types.PutDatagram(buffer)
+
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
 			return err
 		}
 
-		if n > 0 {
-			go s.handlePacket(addr, datagram)
+		if n == 0 {
+			types.PutDatagram(buffer)
+
+			continue
 		}
+
+		// the request is decoded before the transfer starts, the buffer is
+		// not held for the whole transfer
+		var req types.Request
+
+		errDecode := req.UnmarshalBinary((*buffer)[:n])
+		types.PutDatagram(buffer)
+
+		go s.handlePacket(conn, addr, &req, errDecode)
+	}
+}
+
+func (s *Server) ListenAndServe() error {
+	if err := s.Listen(); err != nil {
+		return err
 	}
+
+	return s.Serve()
 }
 
 func (s *Server) Close() error {
-	if err := s.conn.Close(); err != nil {
-		return fmt.Errorf("error while closing connection: %w", err)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var errs []error
+
+	for _, conn := range s.conns {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error while closing connection: %w", err))
+		}
 	}
 
-	return nil
+	if err := s.archives.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("error while closing archives: %w", err))
+	}
+
+	return errors.Join(errs...)
 }
 
-func (s *Server) handlePacket(addr net.Addr, datagram []byte) {
+// handlePacket runs the transfer of req, errDecode is the error decoding the
+// request it came from.
+func (s *Server) handlePacket(listener net.PacketConn, addr net.Addr, req *types.Request, errDecode error) {
 	d := net.Dialer{
-		LocalAddr: s.conn.LocalAddr(),
+		LocalAddr: listener.LocalAddr(),
 		Control:   reusePort(),
 	}
 
-	conn, err := d.Dial("udp", addr.String())
+	host, _, _ := net.SplitHostPort(listener.LocalAddr().String())
+
+	conn, err := d.Dial(listenNetwork(host), addr.String())
 	if err != nil {
 		s.logger.Errorf(err.Error())
 
@@ -90,9 +398,9 @@ func (s *Server) handlePacket(addr net.Addr, datagram []byte) {
 		}
 	}()
 
-	var req types.Request
+	if errDecode != nil {
+		s.logger.Debugf("rejected request from %s: %s", addr.String(), errDecode.Error())
 
-	if err := req.UnmarshalBinary(datagram); err != nil {
 		unknownOp := &types.Error{
 			Opcode:    types.OpCodeError,
 			ErrorCode: types.ErrIllegalTftpOp,
@@ -105,37 +413,179 @@ func (s *Server) handlePacket(addr net.Addr, datagram []byte) {
 		return
 	}
 
-	t := NewTransfer(conn, s.logger,
-		time.Duration(s.readTimeout)*time.Second,
-		time.Duration(s.writeTimeout)*time.Second,
-		s.numTries, s.trace)
+	t := s.newTransfer(conn)
+	src := s.resolve(req.Filename)
+	start := time.Now()
 
-	file := fmt.Sprintf("%s/%s", s.tftpFolder, getFilename(req.Filename))
+	if err := t.SetMode(req.Mode); err != nil {
+		unknownMode := &types.Error{
+			Opcode:    types.OpCodeError,
+			ErrorCode: types.ErrIllegalTftpOp,
+			ErrMsg:    fmt.Sprintf("unsupported mode %s", req.Mode),
+		}
+		if err := t.SendError(unknownMode); err != nil {
+			s.logger.Errorf("error while responding to request: %s", err.Error())
+		}
+
+		s.recordTransfer(addr, req, src.path, start, t.Stats(), err)
+
+		return
+	}
+
+	// the context of the transfer is cancelled once it is over, releasing
+	// the upstream requests of proxied and relayed files
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	switch req.Opcode {
 	case types.OpCodeRRQ:
-		{
-			ok, err := assertSenderFile(s.logger, conn, file)
-			if ok && err == nil {
-				if err := t.Send(file); err != nil {
-					s.logger.Errorf("error while responding to rrq: %s", err.Error())
-				}
-			}
-		}
+		err = s.send(ctx, t, req, src)
 	case types.OpCodeWRQ:
-		{
-			ok, err := assertReceiverFile(s.logger, conn, file)
-			if ok && err == nil {
-				if err := t.AcknowledgeWrq(); err != nil {
-					s.logger.Errorf("error while acknowledging wrq: %s", err.Error())
-
-					return
-				}
-
-				if err := t.Receive(file); err != nil {
-					s.logger.Errorf("error while responding to wrq: %s", err.Error())
-				}
+		err = s.receive(ctx, t, req, src)
+	}
+
+	s.recordTransfer(addr, req, src.path, start, t.Stats(), err)
+}
+
+// send answers the rrq req with the content of src, the returned error is
+// the reason the transfer failed.
+func (s *Server) send(ctx context.Context, t Transfer, req *types.Request, src *source) error {
+	c, err := src.open(ctx, req)
+	if err != nil {
+		return s.refuse(t, src, err)
+	}
+
+	if c.close != nil {
+		defer func() {
+			if err := c.close(); err != nil {
+				s.logger.Errorf("error while closing %s: %s", src.path, err.Error())
 			}
-		}
+		}()
+	}
+
+	if err := s.negotiate(t, req, c.size); err != nil {
+		s.logger.Errorf("error while acknowledging rrq options: %s", err.Error())
+
+		return err
+	}
+
+	if c.r != nil {
+		err = t.SendSeeker(c.r)
+	} else {
+		err = t.Send(c.file)
+	}
+
+	if err != nil {
+		s.logger.Errorf("error while responding to rrq: %s", err.Error())
+
+		return err
+	}
+
+	s.logger.Debugf("sent %d blocks, sent %d bytes", t.Stats().Blocks, t.Stats().Bytes)
+
+	return nil
+}
+
+// receive stores the content of the wrq req in src. The sink is closed
+// before the last block is acknowledged so that its failures reach the
+// client. The returned error is the reason the transfer failed.
+func (s *Server) receive(ctx context.Context, t Transfer, req *types.Request, src *source) error {
+	if src.create == nil {
+		return s.refuse(t, src, &types.TFTPError{Code: types.ErrAccessViolation, Msg: src.readOnly})
+	}
+
+	w, err := src.create(ctx, req)
+	if err != nil {
+		return s.refuse(t, src, err)
+	}
+
+	if err := s.negotiate(t, req, -1); err != nil {
+		s.logger.Errorf("error while acknowledging wrq: %s", err.Error())
+		w.CloseWithError(err)
+
+		return err
+	}
+
+	if err := t.ReceiveStream(w); err != nil {
+		s.logger.Errorf("error while responding to wrq: %s", err.Error())
+		w.CloseWithError(err)
+
+		return err
+	}
+
+	s.logger.Debugf("received %d blocks, received %d bytes", t.Stats().Blocks, t.Stats().Bytes)
+
+	return nil
+}
+
+// refuse answers a request src can not serve, errors not meant for the client
+// are logged and answered with a not defined error. err is returned as the
+// reason the transfer failed.
+func (s *Server) refuse(t Transfer, src *source, err error) error {
+	var tftpErr *types.TFTPError
+	if !errors.As(err, &tftpErr) {
+		s.logger.Errorf("error while resolving %s: %s", src.path, err.Error())
+	}
+
+	if err := t.SendError(upstreamError(err)); err != nil {
+		s.logger.Errorf("error while responding to request: %s", err.Error())
+	}
+
+	return err
+}
+
+func (s *Server) negotiate(t Transfer, req *types.Request, size int64) error {
+	opts, oack := NegotiateOptions(req, size)
+	t.SetOptions(opts)
+
+	if len(oack) > 0 {
+		return t.SendOAck(oack, req.Opcode == types.OpCodeRRQ)
+	}
+
+	if req.Opcode == types.OpCodeWRQ {
+		return t.AcknowledgeWrq()
+	}
+
+	return nil
+}
+
+// recordTransfer writes the audit entry of a transfer, err is the reason it
+// failed or nil when it completed.
+func (s *Server) recordTransfer(addr net.Addr, req *types.Request, file string,
+	start time.Time, stats *Stats, err error,
+) {
+	s.mu.RLock()
+	recorder := s.audit
+	s.mu.RUnlock()
+
+	if recorder == nil {
+		return
+	}
+
+	op := audit.OpRead
+	if req.Opcode == types.OpCodeWRQ {
+		op = audit.OpWrite
+	}
+
+	entry := &audit.Entry{
+		Time:       start.UTC(),
+		Client:     addr.String(),
+		Op:         op,
+		Path:       file,
+		Bytes:      stats.Bytes,
+		Sha256:     hex.EncodeToString(stats.Checksum),
+		DurationMs: time.Since(start).Milliseconds(),
+		ErrCode:    stats.ErrCode,
+		ErrMsg:     stats.ErrMsg,
+		Status:     audit.StatusCompleted,
+	}
+
+	if err != nil {
+		entry.Status = audit.StatusFailed
+		entry.Error = err.Error()
+	}
+
+	if err := recorder.Record(entry); err != nil {
+		s.logger.Errorf("error while writing audit entry: %s", err.Error())
 	}
 }
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+	"go.uber.org/zap"
+)
+
+func TestServeLoopbackBothFamilies(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("tftp"), 300)
+
+	if err := os.WriteFile(filepath.Join(dir, "file"), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(zap.NewNop().Sugar(), []string{"127.0.0.1", "::1"}, "0", 1, 1, 3, dir, false)
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve()
+
+	defer s.Close()
+
+	addrs := s.Addrs()
+	if len(addrs) != 2 {
+		t.Fatalf("expected 2 listeners, got %d", len(addrs))
+	}
+
+	for _, addr := range addrs {
+		conn, err := net.DialUDP("udp", nil, addr.(*net.UDPAddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := &types.Request{Opcode: types.OpCodeRRQ, Filename: "file", Mode: types.ModeOctet}
+
+		b, err := req.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := conn.Write(b); err != nil {
+			t.Fatal(err)
+		}
+
+		out := filepath.Join(t.TempDir(), "file")
+		tr := NewTransfer(conn, zap.NewNop().Sugar(), time.Second, time.Second, 3, false)
+
+		if err := tr.Receive(out); err != nil {
+			t.Fatal(err)
+		}
+
+		conn.Close()
+
+		got, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got, content) {
+			t.Fatalf("%s: received %d bytes, expected %d", addr, len(got), len(content))
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/Wa4h1h/go-tftp/pkg/archive"
+	"github.com/Wa4h1h/go-tftp/pkg/compression"
+	"github.com/Wa4h1h/go-tftp/pkg/proxy"
+	"github.com/Wa4h1h/go-tftp/pkg/types"
+)
+
+// source is what the filename of a request resolves to. Errors meant for
+// the client are *types.TFTPError values, other errors are answered with a
+// not defined error.
+type source struct {
+	// path identifies the source in the logs and the audit log
+	path string
+	// open returns the content sent for a read
+	open func(ctx context.Context, req *types.Request) (*content, error)
+	// create returns the sink storing an upload, it is nil for read-only
+	// sources and readOnly is then sent to the client
+	create   func(ctx context.Context, req *types.Request) (sink, error)
+	readOnly string
+}
+
+// content is the data sent for a read, size is -1 when unknown. Files of the
+// tftp folder are sent by name so that the cache, mmap and read-ahead apply,
+// r is nil for them.
+type content struct {
+	file  string
+	r     io.ReadSeeker
+	size  int64
+	close func() error
+}
+
+// sink stores an upload. Close ends it before the last block is acknowledged,
+// CloseWithError drops it after a failure.
+type sink interface {
+	io.WriteCloser
+	CloseWithError(err error) error
+}
+
+func notFound(name string) error {
+	return &types.TFTPError{Code: types.ErrFileNotFound, Msg: fmt.Sprintf("%s not found", name)}
+}
+
+// resolve returns the source of filename. Relay routes come first, then proxy
+// routes, archive members, compressed copies of missing files and finally the
+// files of the tftp folder.
+func (s *Server) resolve(filename string) *source {
+	s.mu.RLock()
+	relay, upstream, serveArchives, codec := s.relay, s.proxy, s.serveArchives, s.uploadCodec
+	s.mu.RUnlock()
+
+	if relay != nil {
+		if location, ok := relay.Route(filename); ok {
+			return relaySource(relay, location)
+		}
+	}
+
+	if upstream != nil {
+		if u, ok := upstream.URL(filename); ok {
+			return s.proxySource(upstream, filename, u)
+		}
+	}
+
+	if serveArchives {
+		if name, member, ok := archiveMember(filename); ok {
+			return s.memberSource(name, member)
+		}
+	}
+
+	file := fmt.Sprintf("%s/%s", s.tftpFolder, getFilename(filename))
+	src := s.fileSource(file, codec)
+
+	if compressed, found, ok := s.compressedCopy(file); ok {
+		src.open = s.openCompressed(compressed, found)
+	}
+
+	return src
+}
+
+// fileSource serves file from the tftp folder, uploads are stored compressed
+// with codec unless it is nil.
+func (s *Server) fileSource(file string, codec *compression.Codec) *source {
+	return &source{
+		path: file,
+		open: func(context.Context, *types.Request) (*content, error) {
+			info, err := os.Stat(file)
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, notFound(file)
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("error while checking file exists: %w", err)
+			}
+
+			return &content{file: file, size: info.Size()}, nil
+		},
+		create: func(context.Context, *types.Request) (sink, error) {
+			if errPacket := checkReceiverFile(s.logger, file, compression.Codecs); errPacket != nil {
+				return nil, errPacket.Err()
+			}
+
+			path := file
+			if codec != nil {
+				path += codec.Ext
+			}
+
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+			if err != nil {
+				return nil, fmt.Errorf("error while opening file: %w", err)
+			}
+
+			if codec == nil {
+				return &fileSink{f: f, w: f}, nil
+			}
+
+			w, err := codec.NewWriter(f)
+			if err != nil {
+				return nil, errors.Join(fmt.Errorf("error while creating %s writer: %w", codec.Name, err), f.Close())
+			}
+
+			return &fileSink{f: f, w: w, codec: w}, nil
+		},
+	}
+}
+
+// fileSink stores an upload in a file of the tftp folder, through codec when
+// it is stored compressed.
+type fileSink struct {
+	f     *os.File
+	w     io.Writer
+	codec io.Closer
+}
+
+func (f *fileSink) Write(p []byte) (int, error) {
+	return f.w.Write(p)
+}
+
+// Close ends the compressed stream, if any, and closes the file.
+func (f *fileSink) Close() error {
+	var err error
+	if f.codec != nil {
+		err = f.codec.Close()
+	}
+
+	return errors.Join(err, f.f.Close())
+}
+
+// CloseWithError removes the partial upload, a truncated compressed copy
+// would otherwise be served in place of the missing file.
+func (f *fileSink) CloseWithError(error) error {
+	if f.codec != nil {
+		f.codec.Close()
+	}
+
+	return errors.Join(f.f.Close(), os.Remove(f.f.Name()))
+}
+
+// compressedCopy returns the compressed copy served in place of file when
+// file is missing.
+func (s *Server) compressedCopy(file string) (string, *compression.Codec, bool) {
+	if _, err := os.Stat(file); !errors.Is(err, fs.ErrNotExist) {
+		return "", nil, false
+	}
+
+	compressed, codec, err := compression.Find(file)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			s.logger.Errorf("error while looking for compressed file: %s", err.Error())
+		}
+
+		return "", nil, false
+	}
+
+	return compressed, codec, true
+}
+
+// openCompressed sends the decompressed content of file, the size comes from
+// the size index and is only computed for the options needing it.
+func (s *Server) openCompressed(file string, codec *compression.Codec) func(context.Context, *types.Request) (*content, error) {
+	return func(_ context.Context, req *types.Request) (*content, error) {
+		size := int64(-1)
+
+		if needsSize(req) {
+			var err error
+
+			size, err = s.sizes.Size(file, codec)
+			if err != nil {
+				return nil, fmt.Errorf("error while reading %s file: %w", codec.Name, err)
+			}
+		}
+
+		r, err := compression.Open(file, codec)
+		if err != nil {
+			return nil, fmt.Errorf("error while opening %s file: %w", codec.Name, err)
+		}
+
+		return &content{r: r, size: size, close: r.Close}, nil
+	}
+}
+
+// archiveMember splits filename into an archive of the tftp folder and the
+// path of a member, ok is false when filename does not start with an archive
+// name.
+func archiveMember(filename string) (string, string, bool) {
+	name, member, found := strings.Cut(strings.TrimPrefix(filename, "/"), "/")
+	if !found || !archive.Supported(name) || !fs.ValidPath(member) || member == "." {
+		return "", "", false
+	}
+
+	return name, member, true
+}
+
+// memberSource serves member of the archive name, archives are read-only.
+func (s *Server) memberSource(name string, member string) *source {
+	path := fmt.Sprintf("%s/%s", s.tftpFolder, name)
+
+	return &source{
+		path: fmt.Sprintf("%s/%s", path, member),
+		open: func(_ context.Context, req *types.Request) (*content, error) {
+			f, err := s.archives.Open(path, member)
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, notFound(req.Filename)
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("error while opening archive member: %w", err)
+			}
+
+			return &content{r: f, size: f.Size, close: f.Close}, nil
+		},
+		readOnly: fmt.Sprintf("%s is a read-only archive", name),
+	}
+}
+
+// proxySource streams the file fetched from u, tsize is the Content-Length of
+// the upstream response. Proxied files are read-only.
+func (s *Server) proxySource(p *proxy.Proxy, filename string, u string) *source {
+	return &source{
+		path: u,
+		open: func(ctx context.Context, req *types.Request) (*content, error) {
+			body, err := p.Open(ctx, u)
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, notFound(req.Filename)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			if body.Stale {
+				s.logger.Warnf("upstream unreachable, serving cached copy of %s", u)
+			}
+
+			return &content{r: body, size: body.Size, close: body.Close}, nil
+		},
+		readOnly: fmt.Sprintf("%s is served by an upstream", filename),
+	}
+}
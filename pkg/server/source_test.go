@@ -0,0 +1,48 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "fw.bin.gz"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(zap.NewNop().Sugar(), nil, "0", 1, 1, 3, dir, false)
+	s.SetArchives(true)
+	s.SetRelay(&fakeRelay{})
+
+	tests := []struct {
+		filename string
+		path     string
+		writable bool
+	}{
+		// relay routes come before archive members
+		{filename: "up/release.zip/kernel", path: "tftp://upstream/release.zip/kernel", writable: true},
+		{filename: "release.zip/kernel", path: dir + "/release.zip/kernel"},
+		// compressed copies are served in place of missing files, uploads
+		// still go to the tftp folder
+		{filename: "fw.bin", path: dir + "/fw.bin", writable: true},
+		{filename: "/boot/kernel", path: dir + "/kernel", writable: true},
+	}
+
+	for _, tt := range tests {
+		src := s.resolve(tt.filename)
+
+		if src.path != tt.path {
+			t.Errorf("%s resolved to %s, want %s", tt.filename, src.path, tt.path)
+		}
+
+		if writable := src.create != nil; writable != tt.writable {
+			t.Errorf("%s writable %t, want %t", tt.filename, writable, tt.writable)
+		}
+	}
+}
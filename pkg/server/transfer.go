@@ -2,33 +2,110 @@ package server
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/Wa4h1h/go-tftp/pkg/backoff"
+	"github.com/Wa4h1h/go-tftp/pkg/cache"
+	"github.com/Wa4h1h/go-tftp/pkg/netascii"
 	"github.com/Wa4h1h/go-tftp/pkg/types"
 	"github.com/Wa4h1h/go-tftp/pkg/utils"
 	"go.uber.org/zap"
 )
 
+// Transfer runs one side of a transfer. Errors sent by the remote are
+// returned as *types.TFTPError.
 type Transfer interface {
+	Request(req *types.Request) (types.Options, error)
 	Send(file string) error
-	SendBlock(block []byte, blockNum uint16) error
+	SendFrom(r io.Reader) error
+	SendSeeker(src io.ReadSeeker) error
+	SendAck(blockNum uint16) error
+	SendOAck(opts types.Options, waitAck bool) error
 	AcknowledgeWrq() error
 	Receive(file string) error
-	ReceiveBlock(blockW io.Writer) (uint16, uint16, error)
+	ReceiveTo(w io.Writer) error
+	ReceiveStream(w io.WriteCloser) error
+	SendError(errPacket *types.Error) error
+	SetMode(mode string) error
+	SetOptions(opts *TransferOptions)
+	SetProgress(fn func(stats *Stats))
+	SetBackoff(p backoff.Policy)
+	SetRTO(minRTO time.Duration, maxRTO time.Duration)
+	SetReadAhead(blocks int)
+	SetMmap(enabled bool)
+	SetCache(files *cache.Cache)
+	Stats() *Stats
+}
+
+type Stats struct {
+	Checksum []byte
+	ErrCode  *types.ErrCode
+	ErrMsg   string
+	Bytes    int64
+	Size     int64
+	Blocks   int
+	// Retransmits counts the packets sent again, Timeouts the reads that
+	// expired waiting for the remote.
+	Retransmits int
+	Timeouts    int
+	// Duplicates counts the DATA packets received more than once, they are
+	// acknowledged again but not written.
+	Duplicates int
+	// SRTT, RTTVar and RTO are the round trip estimation of the adaptive
+	// retransmission timer at the end of the transfer, zero when it is
+	// disabled.
+	SRTT   time.Duration
+	RTTVar time.Duration
+	RTO    time.Duration
+	// Duration is filled in by the client once the transfer is over.
+	Duration time.Duration
+}
+
+// Throughput returns the transferred bytes per second.
+func (s *Stats) Throughput() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+
+	return float64(s.Bytes) / s.Duration.Seconds()
 }
 
 type Connection struct {
 	conn         net.Conn
 	l            *zap.SugaredLogger
+	hash         hash.Hash
+	mode         string
+	pending      []byte
+	stats        Stats
+	progress     func(stats *Stats)
+	backoff      backoff.Policy
+	rtt          *rttEstimator
+	offset       int64
+	blockSize    int
+	windowSize   int
 	numTries     int
 	readTimeout  time.Duration
 	writeTimeout time.Duration
 	trace        bool
+	// lastAck is the last ACK or OACK sent while receiving, it is sent again
+	// when the remote does not answer.
+	lastAck []byte
+	// readAhead is the number of blocks read in advance while sending, mmap
+	// maps the files sent by Send instead of reading them.
+	readAhead int
+	mmap      bool
+	// cache holds the content of the files sent by Send, nil reads them
+	// from disk
+	cache *cache.Cache
 }
 
 func NewTransfer(conn net.Conn,
@@ -38,23 +115,167 @@ func NewTransfer(conn net.Conn,
 	return &Connection{
 		conn: conn, l: logger, readTimeout: readTimeout,
 		writeTimeout: writeTimeout, numTries: numTries,
-		trace: trace,
+		trace: trace, hash: sha256.New(), mode: types.DefaultMode,
+		blockSize: types.MaxPayloadSize, windowSize: 1,
+		stats: Stats{Size: -1}, backoff: backoff.Fixed{},
 	}
 }
 
-func (c *Connection) AcknowledgeWrq() error {
-	ack := &types.Ack{
-		Opcode:   types.OpCodeACK,
-		BlockNum: 0,
+func (c *Connection) SetMode(mode string) error {
+	mode = strings.ToLower(mode)
+
+	if mode != types.ModeOctet && mode != types.ModeNetascii {
+		return utils.ErrUnsupportedMode
 	}
 
-	b, err := ack.MarshalBinary()
-	if err != nil {
-		c.l.Error(err.Error())
+	c.mode = mode
 
-		return utils.ErrPacketMarshall
+	return nil
+}
+
+func (c *Connection) SetOptions(opts *TransferOptions) {
+	if opts.BlockSize > 0 {
+		c.blockSize = opts.BlockSize
+	}
+
+	if opts.WindowSize > 0 {
+		c.windowSize = opts.WindowSize
+	}
+
+	if opts.Timeout > 0 {
+		// a negotiated timeout is used as is
+		c.readTimeout = opts.Timeout
+		c.rtt = nil
+		c.stats.SRTT, c.stats.RTTVar, c.stats.RTO = 0, 0, 0
 	}
 
+	if opts.Size >= 0 {
+		c.stats.Size = opts.Size
+	}
+
+	c.offset = opts.Offset
+}
+
+// SetProgress registers fn to be called after each transferred block, the
+// stats must not be retained.
+func (c *Connection) SetProgress(fn func(stats *Stats)) {
+	c.progress = fn
+}
+
+// SetBackoff sets the policy spacing the retransmissions of a packet, waits
+// are fixed by default.
+func (c *Connection) SetBackoff(p backoff.Policy) {
+	c.backoff = p
+}
+
+// SetRTO enables the adaptive retransmission timer (RFC 6298), its timeouts
+// are kept within [min, max]. A max of 0 stands for the read timeout and a min
+// of 0 disables the timer.
+func (c *Connection) SetRTO(minRTO time.Duration, maxRTO time.Duration) {
+	if minRTO <= 0 {
+		c.rtt = nil
+
+		return
+	}
+
+	if maxRTO <= 0 {
+		maxRTO = c.readTimeout
+	}
+
+	c.rtt = newRTTEstimator(c.readTimeout, minRTO, max(maxRTO, minRTO))
+}
+
+// SetReadAhead reads up to blocks blocks in advance of the window while
+// sending, 0 reads each block when it is sent.
+func (c *Connection) SetReadAhead(blocks int) {
+	c.readAhead = blocks
+}
+
+// SetMmap makes Send map the file into memory instead of reading it. A file
+// truncated while it is sent fails the transfer.
+func (c *Connection) SetMmap(enabled bool) {
+	c.mmap = enabled
+}
+
+// SetCache makes Send serve files from the cache, files which do not fit in it
+// are read from disk.
+func (c *Connection) SetCache(files *cache.Cache) {
+	c.cache = files
+}
+
+// wait returns the deadline for an answer to the attempt-th transmission of a
+// packet. The adaptive timer backs off by itself, the policy then only adds
+// its jitter.
+func (c *Connection) wait(attempt int) time.Time {
+	if c.rtt != nil {
+		return time.Now().Add(c.rtt.bound(c.backoff.Next(c.rtt.rto, 0)))
+	}
+
+	return time.Now().Add(c.backoff.Next(c.readTimeout, attempt))
+}
+
+// measured feeds the round trip time of a packet sent at sent to the adaptive
+// timer.
+func (c *Connection) measured(sent time.Time) {
+	if c.rtt == nil {
+		return
+	}
+
+	c.rtt.sample(time.Since(sent))
+	c.stats.SRTT, c.stats.RTTVar, c.stats.RTO = c.rtt.srtt, c.rtt.rttvar, c.rtt.rto
+}
+
+// timedOut records a read that expired waiting for the remote.
+func (c *Connection) timedOut() {
+	c.stats.Timeouts++
+
+	if c.rtt != nil {
+		c.rtt.expired()
+		c.stats.RTO = c.rtt.rto
+	}
+}
+
+func (c *Connection) Stats() *Stats {
+	c.stats.Checksum = c.hash.Sum(nil)
+
+	return &c.stats
+}
+
+func (c *Connection) SendError(errPacket *types.Error) error {
+	code := errPacket.ErrorCode
+	c.stats.ErrCode = &code
+	c.stats.ErrMsg = errPacket.ErrMsg
+
+	return sendErrorPacket(c.conn, errPacket)
+}
+
+func (c *Connection) remoteError(errPacket *types.Error) error {
+	code := errPacket.ErrorCode
+	c.stats.ErrCode = &code
+	c.stats.ErrMsg = errPacket.ErrMsg
+
+	return errPacket.Err()
+}
+
+func (c *Connection) abort(errPacket *types.Error, err error) error {
+	if errSend := c.SendError(errPacket); errSend != nil {
+		c.l.Errorf("error while sending error packet: %s", errSend.Error())
+	}
+
+	return err
+}
+
+func (c *Connection) count(block []byte) {
+	c.hash.Write(block)
+	c.stats.Bytes += int64(len(block))
+	c.stats.Blocks++
+
+	if c.progress != nil {
+		c.progress(&c.stats)
+	}
+}
+
+func (c *Connection) write(b []byte) error {
 	if err := c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
 		c.l.Errorf("error while setting write timeout: %s", err.Error())
 
@@ -62,7 +283,7 @@ func (c *Connection) AcknowledgeWrq() error {
 	}
 
 	if _, err := c.conn.Write(b); err != nil {
-		c.l.Errorf("error while writing data packet: %s", err.Error())
+		c.l.Errorf("error while writing packet: %s", err.Error())
 
 		return utils.ErrPacketCanNotBeSent
 	}
@@ -70,87 +291,155 @@ func (c *Connection) AcknowledgeWrq() error {
 	return nil
 }
 
-func (c *Connection) ReceiveBlock(blockW io.Writer) (uint16, uint16, error) {
-	var (
-		data          types.Data
-		errPacket     types.Error
-		wrongBlockNum uint16
-		nullBytes     uint16
-	)
+func (c *Connection) read(b []byte, deadline time.Time) (int, error) {
+	if err := c.conn.SetReadDeadline(deadline); err != nil {
+		return 0, fmt.Errorf("error while setting read timeout: %w", err)
+	}
 
-	datagram := make([]byte, types.DatagramSize)
+	n, err := c.conn.Read(b)
+	if err != nil {
+		return 0, fmt.Errorf("error while reading packet: %w", err)
+	}
 
-	for tries := c.numTries; tries > 0; tries-- {
-		if err := c.conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
-			return wrongBlockNum, nullBytes, fmt.Errorf("error while setting read timeout: %w", err)
-		}
+	return n, nil
+}
 
-		n, err := c.conn.Read(datagram)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return wrongBlockNum, nullBytes, nil
-			}
+func isTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
 
-			continue
-		}
+func (c *Connection) SendAck(blockNum uint16) error {
+	ack := types.Ack{
+		Opcode:   types.OpCodeACK,
+		BlockNum: blockNum,
+	}
 
-		if n < 0 {
-			c.l.Debug("0 bytes were read")
+	b, err := ack.AppendBinary(c.lastAck[:0])
+	if err != nil {
+		c.l.Error(err.Error())
 
-			continue
-		}
+		return utils.ErrPacketMarshall
+	}
 
-		if errPacket.UnmarshalBinary(datagram[:n]) == nil {
-			fmt.Println(errPacket.ErrMsg)
-			return wrongBlockNum, nullBytes, nil
-		} else if err := data.UnmarshalBinary(datagram[:n]); err != nil {
-			c.l.Errorf("error while unmarshal data packet: %s", err.Error())
+	c.lastAck = b
 
-			continue
-		}
+	return c.write(b)
+}
+
+func (c *Connection) AcknowledgeWrq() error {
+	return c.SendAck(0)
+}
 
-		src := bytes.NewBuffer(data.Payload)
+// SendOAck answers a request with the accepted options. Reads wait for the
+// ACK of block 0 before any data is sent, writes go on with DATA block 1.
+func (c *Connection) SendOAck(opts types.Options, waitAck bool) error {
+	oack := &types.OAck{
+		Opcode:  types.OpCodeOACK,
+		Options: opts,
+	}
 
-		copied, errCopy := io.CopyN(blockW, src, int64(len(data.Payload)))
-		if errCopy != nil {
-			return wrongBlockNum, nullBytes, fmt.Errorf("error while copy payload: %w", errCopy)
+	b, err := oack.MarshalBinary()
+	if err != nil {
+		c.l.Error(err.Error())
+
+		return utils.ErrPacketMarshall
+	}
+
+	if !waitAck {
+		c.lastAck = b
+
+		return c.write(b)
+	}
+
+	_, err = c.sendWindow([][]byte{b}, 0, true)
+
+	return err
+}
+
+// Request sends req and waits for the first answer of the remote. The options
+// acknowledged by an OACK are returned, nil means that the remote ignored
+// them. A DATA packet answering a read request is kept for ReceiveTo.
+func (c *Connection) Request(req *types.Request) (types.Options, error) {
+	b, err := req.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("error while marshalling request: %w", err)
+	}
+
+	buffer := types.GetDatagram()
+	defer types.PutDatagram(buffer)
+
+	datagram := *buffer
+
+	for tries := c.numTries; tries > 0; tries-- {
+		if tries < c.numTries {
+			c.stats.Retransmits++
 		}
 
-		if err := c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
-			return wrongBlockNum, nullBytes, fmt.Errorf("error while setting write timeout: %w", err)
+		if err := c.write(b); err != nil {
+			return nil, err
 		}
 
-		ack := &types.Ack{
-			Opcode:   types.OpCodeACK,
-			BlockNum: data.BlockNum,
+		sent := time.Now()
+
+		n, err := c.read(datagram, c.wait(c.numTries-tries))
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil, err
+			}
+
+			if isTimeout(err) {
+				c.timedOut()
+			} else {
+				c.l.Errorf("error while reading response: %s", err.Error())
+			}
+
+			continue
 		}
 
-		b, errM := ack.MarshalBinary()
-		if errM != nil {
-			return wrongBlockNum, nullBytes, fmt.Errorf("error while marshlling ack: %w", errM)
+		if tries == c.numTries {
+			c.measured(sent)
 		}
 
-		_, errW := c.conn.Write(b)
-		if errW == nil {
-			return data.BlockNum, uint16(copied), nil
+		packet, err := types.ParsePacket(datagram[:n])
+		if err != nil {
+			c.l.Errorf("error while decoding answer to request: %s", err.Error())
+
+			continue
 		}
 
-		c.l.Errorf("error while writing data packet: %s", errW.Error())
+		switch p := packet.(type) {
+		case *types.OAck:
+			if p.Options == nil {
+				p.Options = types.Options{}
+			}
+
+			return p.Options, nil
+		case *types.Error:
+			return nil, c.remoteError(p)
+		case *types.Ack:
+			if req.Opcode == types.OpCodeWRQ && p.BlockNum == 0 {
+				return nil, nil
+			}
+		case *types.Data:
+			if req.Opcode == types.OpCodeRRQ && p.BlockNum == 1 {
+				c.pending = append([]byte(nil), datagram[:n]...)
 
-		continue
+				return nil, nil
+			}
+		}
+
+		c.l.Errorf("unexpected answer to request")
 	}
 
-	return wrongBlockNum, nullBytes, utils.ErrPacketCanNotBeSent
+	return nil, utils.ErrPacketCanNotBeSent
 }
 
 func (c *Connection) Receive(file string) error {
-	errPacket := notDefinedError()
-
 	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
 	if err != nil {
 		c.l.Errorf("error while opening file: %s", err.Error())
 
-		return sendErrorPacket(c.conn, errPacket)
+		return c.abort(notDefinedError(), fmt.Errorf("error while opening file: %w", err))
 	}
 
 	defer func() {
@@ -159,116 +448,373 @@ func (c *Connection) Receive(file string) error {
 		}
 	}()
 
-	block := make([]byte, 0, types.MaxPayloadSize)
-	blockBuffer := bytes.NewBuffer(block)
-	var bytesAccum uint16
+	if err := c.receive(f, nil); err != nil {
+		return err
+	}
+
+	c.dally()
+
+	return nil
+}
+
+// ReceiveStream receives into w like ReceiveTo and then dallies like Receive.
+// w is closed before the last block is acknowledged, an error closing it
+// aborts the transfer instead. w is left open when the transfer fails.
+func (c *Connection) ReceiveStream(w io.WriteCloser) error {
+	if err := c.receive(w, w.Close); err != nil {
+		return err
+	}
+
+	c.dally()
+
+	return nil
+}
+
+// dally waits after the final ACK for a retransmission of the last DATA
+// packet, meaning that the ACK got lost, and acknowledges it again so that
+// the sender does not give up on a complete transfer (RFC 1350).
+func (c *Connection) dally() {
+	if len(c.lastAck) < 4 {
+		return
+	}
+
+	var data types.Data
+
+	last := binary.BigEndian.Uint16(c.lastAck[2:])
+	buffer := types.GetDatagram()
+	defer types.PutDatagram(buffer)
+
+	datagram := *buffer
+	deadline := c.wait(0)
 
 	for {
-		blockNum, n, err := c.ReceiveBlock(blockBuffer)
+		n, err := c.read(datagram, deadline)
+		if err != nil {
+			return
+		}
+
+		if data.UnmarshalBinary(datagram[:n]) != nil || data.BlockNum != last {
+			continue
+		}
+
+		c.stats.Duplicates++
+
+		if err := c.reAck(last); err != nil {
+			return
+		}
+
+		deadline = c.wait(0)
+	}
+}
+
+func (c *Connection) next(datagram []byte, attempt int) (int, error) {
+	if c.pending != nil {
+		n := copy(datagram, c.pending)
+		c.pending = nil
+
+		return n, nil
+	}
+
+	return c.read(datagram, c.wait(attempt))
+}
+
+func (c *Connection) ReceiveTo(dst io.Writer) error {
+	return c.receive(dst, nil)
+}
+
+// receive writes the received blocks to dst, end is called once the last
+// block is written and before it is acknowledged.
+func (c *Connection) receive(dst io.Writer, end func() error) error {
+	w := dst
+	if c.mode == types.ModeNetascii {
+		w = netascii.NewWriter(dst)
+	}
+
+	var (
+		expected uint16 = 1
+		received int
+		// ackSent is when the ACK of the last window was sent, it is reset
+		// when the answer to it can not be told apart from a retransmission
+		ackSent time.Time
+		// gap is set once blocks past a lost one were acknowledged, the
+		// following ones are dropped silently until the gap is filled
+		gap bool
+	)
+
+	buffer := types.GetDatagram()
+	defer types.PutDatagram(buffer)
+
+	datagram := *buffer
+
+	for tries := c.numTries; tries > 0; {
+		n, err := c.next(datagram, c.numTries-tries)
 		if err != nil {
-			if errors.Is(err, utils.ErrPacketCanNotBeSent) {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			if errors.Is(err, net.ErrClosed) {
 				return err
 			}
 
-			errPacket = &types.Error{
-				Opcode:    types.OpCodeError,
-				ErrorCode: types.ErrNotDefined,
-				ErrMsg:    "server can not create data packet",
+			if !isTimeout(err) {
+				c.l.Errorf("error while reading data packet: %s", err.Error())
 			}
 
-			return sendErrorPacket(c.conn, errPacket)
-		} else if err == nil && blockNum == 0 && n == 0 {
-			return nil
+			tries--
+			ackSent = time.Time{}
+
+			if isTimeout(err) {
+				c.timedOut()
+
+				if err := c.resendAck(tries); err != nil {
+					return err
+				}
+			}
+
+			continue
 		}
 
-		_, errW := f.Write(blockBuffer.Bytes())
-		if errW != nil {
-			return errors.New("error while writing block to file")
+		packet, err := types.ParsePacket(datagram[:n])
+		if err != nil {
+			c.l.Errorf("error while unmarshal data packet: %s", err.Error())
+
+			continue
 		}
 
+		var data *types.Data
+
+		switch p := packet.(type) {
+		case *types.Error:
+			return c.remoteError(p)
+		case *types.Data:
+			data = p
+		default:
+			c.l.Errorf("unexpected packet while receiving data")
+
+			continue
+		}
+
+		if len(data.Payload) > c.blockSize {
+			c.l.Errorf("block#=%d exceeds block size %d", data.BlockNum, c.blockSize)
+
+			continue
+		}
+
+		switch sequence(data.BlockNum, expected, c.windowSize) {
+		case blockDuplicate:
+			// our ACK got lost and the remote sent the block again, acknowledge
+			// what we have so far without writing it twice
+			c.stats.Duplicates++
+			ackSent = time.Time{}
+
+			if err := c.reAck(expected - 1); err != nil {
+				return err
+			}
+
+			continue
+		case blockAhead:
+			// a block of the window got lost, ask for the window again from it
+			received = 0
+			ackSent = time.Time{}
+
+			if !gap {
+				gap = true
+
+				if err := c.reAck(expected - 1); err != nil {
+					return err
+				}
+			}
+
+			continue
+		case blockInvalid:
+			c.l.Errorf("block#=%d out of sequence, expected block#=%d", data.BlockNum, expected)
+
+			continue
+		}
+
+		if _, err := w.Write(data.Payload); err != nil {
+			// writers streaming to a remote fail with its error
+			return c.abort(upstreamError(err), fmt.Errorf("error while writing block: %w", err))
+		}
+
+		if !ackSent.IsZero() {
+			c.measured(ackSent)
+			ackSent = time.Time{}
+		}
+
+		c.count(data.Payload)
+
 		if c.trace {
-			fmt.Printf("received block#=%d, received #bytes=%d\n", blockNum, len(blockBuffer.Bytes()))
+			fmt.Printf("received block#=%d, received #bytes=%d\n", data.BlockNum, len(data.Payload))
+		}
+
+		last := len(data.Payload) < c.blockSize
+		gap = false
+		expected++
+		received++
+
+		if last {
+			if nw, ok := w.(*netascii.Writer); ok {
+				if err := nw.Flush(); err != nil {
+					return c.abort(notDefinedError(), fmt.Errorf("error while writing block: %w", err))
+				}
+			}
+
+			if end != nil {
+				if err := end(); err != nil {
+					return c.abort(upstreamError(err), fmt.Errorf("error while ending transfer: %w", err))
+				}
+			}
 		}
 
-		blockBuffer.Reset()
-		bytesAccum += n
+		if last || received == c.windowSize {
+			received = 0
+			tries = c.numTries
+
+			if err := c.SendAck(data.BlockNum); err != nil {
+				return err
+			}
 
-		if n < types.MaxPayloadSize {
-			fmt.Printf("received %d blocks, received %d bytes\n", blockNum, bytesAccum)
+			ackSent = time.Now()
+		}
+
+		if last {
 			return nil
 		}
 	}
+
+	return utils.ErrPacketCanNotBeSent
 }
 
-func (c *Connection) SendBlock(block []byte, blockNum uint16) error {
-	var ack types.Ack
-	var errPacket types.Error
+const (
+	blockExpected = iota
+	blockDuplicate
+	blockAhead
+	blockInvalid
+)
 
-	data := &types.Data{
-		Opcode:   types.OpCodeDATA,
-		Payload:  block,
-		BlockNum: blockNum,
+// sequence classifies a received block# against the expected one, block
+// numbers wrap around after 65535.
+func sequence(blockNum uint16, expected uint16, windowSize int) int {
+	switch {
+	case blockNum == expected:
+		return blockExpected
+	case int(blockNum-expected) < windowSize:
+		return blockAhead
+	case expected-blockNum <= 1<<15:
+		return blockDuplicate
+	default:
+		return blockInvalid
 	}
-	buffer := make([]byte, types.DatagramSize)
+}
 
-	b, err := data.MarshalBinary()
-	if err != nil {
-		return fmt.Errorf("error while marshalling data packet: %w", err)
+// reAck acknowledges blockNum again.
+func (c *Connection) reAck(blockNum uint16) error {
+	c.stats.Retransmits++
+
+	return c.SendAck(blockNum)
+}
+
+// resendAck sends the last ACK or OACK again after the remote went silent,
+// unless no tries are left.
+func (c *Connection) resendAck(tries int) error {
+	if c.lastAck == nil || tries == 0 {
+		return nil
 	}
 
-	for i := c.numTries; i > 0; i-- {
-		if err := c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
-			return fmt.Errorf("error while setting write timeout: %w", err)
-		}
+	c.stats.Retransmits++
 
-		if _, err := c.conn.Write(b); err != nil {
-			c.l.Errorf("error while writing data packet: %s", err.Error())
+	return c.write(c.lastAck)
+}
 
-			continue
-		}
+// sendWindow sends the given packets, the first one carrying block# first,
+// and waits until the remote acknowledges at least one of them. It returns
+// the number of acknowledged packets. The round trip is measured unless some
+// packets were already sent by an earlier call.
+func (c *Connection) sendWindow(window [][]byte, first uint16, fresh bool) (int, error) {
+	datagram := types.GetDatagram()
+	defer types.PutDatagram(datagram)
 
-		if err := c.conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
-			return fmt.Errorf("error while setting read timeout: %w", err)
+	buffer := *datagram
+
+	for tries := c.numTries; tries > 0; tries-- {
+		if tries < c.numTries {
+			c.stats.Retransmits += len(window)
 		}
 
-		n, err := c.conn.Read(buffer)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return nil
+		for _, b := range window {
+			if err := c.write(b); err != nil {
+				return 0, err
 			}
+		}
 
-			c.l.Errorf("error while reading response: %s", err.Error())
+		sent := time.Now()
 
-			continue
-		}
+		deadline := c.wait(c.numTries - tries)
+
+		for {
+			n, err := c.read(buffer, deadline)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return 0, err
+				}
+
+				if isTimeout(err) {
+					c.timedOut()
+				} else {
+					c.l.Errorf("error while reading response: %s", err.Error())
+				}
+
+				break
+			}
 
-		switch {
-		case ack.UnmarshalBinary(buffer[:n]) == nil:
-			if ack.BlockNum != blockNum {
-				c.l.Errorf("ack block# %d != expected block# %d", ack.BlockNum, blockNum)
+			packet, err := types.ParsePacket(buffer[:n])
+			if err != nil {
+				c.l.Errorf("error while decoding acknowledgment: %s", err.Error())
 
 				continue
 			}
 
-			return nil
-		case errPacket.UnmarshalBinary(buffer[:n]) == nil:
-			return utils.ErrPacketCanNotBeSent
-		default:
-			continue
+			switch p := packet.(type) {
+			case *types.Ack:
+				acked := int(p.BlockNum-first) + 1
+				if acked < 1 || acked > len(window) {
+					// duplicated ACK of an earlier block, keep waiting
+					continue
+				}
+
+				if fresh && tries == c.numTries {
+					c.measured(sent)
+				}
+
+				return acked, nil
+			case *types.Error:
+				return 0, c.remoteError(p)
+			}
 		}
 	}
 
-	return utils.ErrPacketCanNotBeSent
+	return 0, utils.ErrPacketCanNotBeSent
 }
 
 func (c *Connection) Send(file string) error {
-	errPacket := notDefinedError()
+	if c.cache != nil {
+		data, err := c.cache.Get(file)
+		if err == nil {
+			return c.SendFrom(bytes.NewReader(data[min(c.offset, int64(len(data))):]))
+		}
+
+		if !errors.Is(err, cache.ErrNotCacheable) {
+			c.l.Debugf("reading file instead of using the cache: %s", err.Error())
+		}
+	}
 
 	f, errOpen := os.Open(file)
 	if errOpen != nil {
 		c.l.Errorf("error while opening file: %s", errOpen.Error())
 
-		return sendErrorPacket(c.conn, errPacket)
+		return c.abort(notDefinedError(), fmt.Errorf("error while opening file: %w", errOpen))
 	}
 
 	defer func() {
@@ -277,41 +823,112 @@ func (c *Connection) Send(file string) error {
 		}
 	}()
 
-	var blockNum uint16 = 1
+	var src io.ReadSeeker = f
 
-	block := make([]byte, types.MaxPayloadSize)
-	bytesAccum := 0
+	if c.mmap {
+		m, err := mapFile(f)
+		if err != nil {
+			c.l.Debugf("reading file instead of mapping it: %s", err.Error())
+		} else {
+			defer func() {
+				if err := m.Close(); err != nil {
+					c.l.Errorf("error while unmapping file: %s", err.Error())
+				}
+			}()
+
+			src = m
+		}
+	}
+
+	return c.SendSeeker(src)
+}
+
+// SendSeeker sends src from the negotiated offset.
+func (c *Connection) SendSeeker(src io.ReadSeeker) error {
+	if _, err := src.Seek(c.offset, io.SeekStart); err != nil {
+		return c.abort(notDefinedError(), fmt.Errorf("error while seeking file: %w", err))
+	}
+
+	return c.SendFrom(src)
+}
+
+func (c *Connection) SendFrom(src io.Reader) error {
+	r := src
+	if c.mode == types.ModeNetascii {
+		r = netascii.NewReader(src)
+	}
+
+	var (
+		blockNum uint16 = 1
+		first    uint16 = 1
+		eof      bool
+		// fresh is unset when the window holds packets sent before
+		fresh = true
+	)
+
+	window := make([][]byte, 0, c.windowSize)
+
+	blocks := c.blocks(r)
+	defer blocks.close()
 
 	for {
-		n, err := f.Read(block)
-		if err != nil {
-			c.l.Errorf("error while reading file block: %s", err.Error())
+		for !eof && len(window) < c.windowSize {
+			packet, last, err := blocks.next()
+			if err != nil {
+				c.l.Errorf("error while reading file block: %s", err.Error())
+
+				return c.abort(notDefinedError(), fmt.Errorf("error while reading block: %w", err))
+			}
+
+			// the payload is already in place, only the header is encoded
+			data := types.Data{
+				Opcode:   types.OpCodeDATA,
+				BlockNum: blockNum,
+			}
+
+			if _, err := data.AppendBinary(packet[:0]); err != nil {
+				return c.abort(notDefinedError(), fmt.Errorf("error while marshalling data packet: %w", err))
+			}
 
-			return sendErrorPacket(c.conn, errPacket)
+			if c.trace {
+				fmt.Printf("sent block#=%d, sent #bytes=%d\n", blockNum, len(packet)-dataHeaderSize)
+			}
+
+			window = append(window, packet)
+			blockNum++
+			eof = last
 		}
 
-		if err := c.SendBlock(block[:n], blockNum); err != nil {
+		acked, err := c.sendWindow(window, first, fresh)
+		if err != nil {
 			c.l.Errorf("error while sending data packet: %s", err.Error())
 
-			errPacket = &types.Error{
+			if errors.Is(err, utils.ErrRemoteError) {
+				return err
+			}
+
+			errPacket := &types.Error{
 				Opcode:    types.OpCodeError,
 				ErrorCode: types.ErrNotDefined,
 				ErrMsg:    "server can not create data packet",
 			}
 
-			return sendErrorPacket(c.conn, errPacket)
+			return c.abort(errPacket, err)
 		}
 
-		if c.trace {
-			fmt.Printf("sent block#=%d, sent #bytes=%d\n", blockNum, n)
-		}
+		fresh = acked == len(window)
 
-		blockNum++
-		bytesAccum += n
+		// blocks are counted once acknowledged, the stats of a failed
+		// transfer only cover what the remote received
+		for _, packet := range window[:acked] {
+			c.count(packet[dataHeaderSize:])
+			blocks.release(packet)
+		}
 
-		if n < types.MaxPayloadSize {
-			fmt.Printf("sent %d blocks, sent %d bytes\n", blockNum-1, bytesAccum)
+		window = window[acked:]
+		first += uint16(acked)
 
+		if eof && len(window) == 0 {
 			return nil
 		}
 	}
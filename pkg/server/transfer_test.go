@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// transfer sends content from a sender to a receiver connected by an
+// in-memory transport and returns what the receiver wrote.
+func transfer(t *testing.T, content []byte, windowSize int, senderTimeout time.Duration,
+	receiverTimeout time.Duration, senderFilter func(n int, b []byte) [][]byte,
+	receiverFilter func(n int, b []byte) [][]byte,
+) ([]byte, *Stats, *Stats) {
+	t.Helper()
+
+	a, b := memPipe()
+	a.setFilter(senderFilter)
+	b.setFilter(receiverFilter)
+
+	sender := NewTransfer(a, zap.NewNop().Sugar(), senderTimeout, time.Second, 5, false)
+	receiver := NewTransfer(b, zap.NewNop().Sugar(), receiverTimeout, time.Second, 5, false)
+
+	opts := &TransferOptions{BlockSize: 512, WindowSize: windowSize, Size: -1}
+	sender.SetOptions(opts)
+	receiver.SetOptions(opts)
+
+	errc := make(chan error, 1)
+
+	go func() {
+		errc <- sender.SendFrom(bytes.NewReader(content))
+	}()
+
+	var got bytes.Buffer
+
+	if err := receiver.ReceiveTo(&got); err != nil {
+		t.Fatalf("receiver: %s", err.Error())
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("sender: %s", err.Error())
+	}
+
+	a.Close()
+	b.Close()
+
+	return got.Bytes(), sender.Stats(), receiver.Stats()
+}
+
+func blockNum(b []byte) uint16 {
+	return uint16(b[2])<<8 | uint16(b[3])
+}
+
+func TestReceiveDuplicates(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+
+	for _, windowSize := range []int{1, 4} {
+		duplicate := func(_ int, b []byte) [][]byte { return [][]byte{b, b} }
+		// every third ACK but the final one is lost, the sender retransmits
+		// blocks already written
+		dropAcks := func(n int, b []byte) [][]byte {
+			if n%3 == 0 && int(blockNum(b)) <= len(content)/512 {
+				return nil
+			}
+
+			return [][]byte{b}
+		}
+
+		got, _, stats := transfer(t, content, windowSize, 20*time.Millisecond, time.Second, duplicate, dropAcks)
+		if !bytes.Equal(got, content) {
+			t.Fatalf("windowsize %d: received %d bytes, expected %d", windowSize, len(got), len(content))
+		}
+
+		if stats.Duplicates == 0 || stats.Bytes != int64(len(content)) {
+			t.Fatalf("windowsize %d: unexpected stats %+v", windowSize, stats)
+		}
+	}
+}
+
+func TestReceiveLostBlocks(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+	lost := make(map[uint16]bool)
+
+	// the first transmission of every fifth block is lost
+	dropBlocks := func(_ int, b []byte) [][]byte {
+		if n := blockNum(b); n%5 == 0 && !lost[n] {
+			lost[n] = true
+
+			return nil
+		}
+
+		return [][]byte{b}
+	}
+
+	got, _, _ := transfer(t, content, 4, 20*time.Millisecond, time.Second, dropBlocks, nil)
+	if !bytes.Equal(got, content) {
+		t.Fatalf("received %d bytes, expected %d", len(got), len(content))
+	}
+}
+
+func TestReceiveResendsAckOnTimeout(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 512*3+10)
+
+	// the first ACK is lost and the sender waits far longer than the
+	// receiver, only an ACK sent again by the receiver lets the transfer go on
+	dropFirst := func(n int, b []byte) [][]byte {
+		if n == 1 {
+			return nil
+		}
+
+		return [][]byte{b}
+	}
+
+	start := time.Now()
+
+	got, _, stats := transfer(t, content, 1, 10*time.Second, 20*time.Millisecond, nil, dropFirst)
+	if !bytes.Equal(got, content) {
+		t.Fatalf("received %d bytes, expected %d", len(got), len(content))
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("transfer took %s, the lost ACK was not sent again", elapsed)
+	}
+
+	if stats.Retransmits != 1 || stats.Timeouts != 1 {
+		t.Fatalf("expected 1 retransmit after 1 timeout, got %+v", stats)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	tests := []struct {
+		blockNum, expected uint16
+		windowSize         int
+		kind               int
+	}{
+		{5, 5, 1, blockExpected},
+		{4, 5, 1, blockDuplicate},
+		{6, 5, 1, blockInvalid},
+		{7, 5, 4, blockAhead},
+		{9, 5, 4, blockInvalid},
+		{65535, 0, 1, blockDuplicate},
+		{1, 65534, 4, blockAhead},
+	}
+
+	for _, test := range tests {
+		if kind := sequence(test.blockNum, test.expected, test.windowSize); kind != test.kind {
+			t.Fatalf("block#=%d expected block#=%d windowsize %d: got %d, expected %d",
+				test.blockNum, test.expected, test.windowSize, kind, test.kind)
+		}
+	}
+}
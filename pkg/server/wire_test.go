@@ -0,0 +1,590 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wa4h1h/go-tftp/pkg/audit"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// wireRTO is the fixed retransmission timeout of the server under test, long
+// enough to tell a retransmission from a reply on loopback.
+const wireRTO = 150 * time.Millisecond
+
+// wire is a raw UDP peer exchanging hand written packets with a server.
+type wire struct {
+	t      *testing.T
+	conn   *net.UDPConn
+	server net.Addr
+	// tid is the address the transfer is answered from
+	tid net.Addr
+}
+
+// newWire starts a server serving files, configure changes its settings
+// before it listens.
+func newWire(t *testing.T, files map[string]string, configure ...func(s *Server)) (*wire, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewServer(zap.NewNop().Sugar(), []string{"127.0.0.1"}, "0", 1, 1, 3, dir, false)
+	s.SetRTO(wireRTO, wireRTO)
+
+	for _, f := range configure {
+		f(s)
+	}
+
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve()
+
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return &wire{t: t, conn: conn, server: s.Addrs()[0]}, dir
+}
+
+func (w *wire) send(packet string) {
+	w.t.Helper()
+
+	to := w.tid
+	if to == nil {
+		to = w.server
+	}
+
+	if _, err := w.conn.WriteTo([]byte(packet), to); err != nil {
+		w.t.Fatal(err)
+	}
+}
+
+// expect reads the next packet, it must come from the address of the first
+// reply and match packet byte for byte.
+func (w *wire) expect(packet string) {
+	w.t.Helper()
+
+	buffer := make([]byte, 65536)
+
+	if err := w.conn.SetReadDeadline(time.Now().Add(3 * wireRTO)); err != nil {
+		w.t.Fatal(err)
+	}
+
+	n, addr, err := w.conn.ReadFrom(buffer)
+	if err != nil {
+		w.t.Fatalf("expected % x: %v", packet, err)
+	}
+
+	// transfers are answered by a socket connected to the client that shares
+	// the listening port, the client port tells transfers apart
+	switch {
+	case w.tid == nil:
+		w.tid = addr
+	case addr.String() != w.tid.String():
+		w.t.Fatalf("packet from %s, expected transfer id %s", addr, w.tid)
+	}
+
+	if !bytes.Equal(buffer[:n], []byte(packet)) {
+		w.t.Fatalf("received % x, expected % x", buffer[:n], packet)
+	}
+}
+
+// silent checks that nothing is received for d.
+func (w *wire) silent(d time.Duration) {
+	w.t.Helper()
+
+	buffer := make([]byte, 65536)
+
+	if err := w.conn.SetReadDeadline(time.Now().Add(d)); err != nil {
+		w.t.Fatal(err)
+	}
+
+	n, _, err := w.conn.ReadFrom(buffer)
+
+	var netErr net.Error
+	if err == nil || !errors.As(err, &netErr) || !netErr.Timeout() {
+		w.t.Fatalf("expected silence, received % x (%v)", buffer[:n], err)
+	}
+}
+
+func rrq(file, mode string, opts ...string) string {
+	return request(1, file, mode, opts)
+}
+
+func wrq(file, mode string, opts ...string) string {
+	return request(2, file, mode, opts)
+}
+
+func request(opcode uint16, file, mode string, opts []string) string {
+	return opcodeBytes(opcode) + file + "\x00" + mode + "\x00" + nulTerminated(opts)
+}
+
+func data(block uint16, payload string) string {
+	return opcodeBytes(3) + uint16Bytes(block) + payload
+}
+
+func ack(block uint16) string {
+	return opcodeBytes(4) + uint16Bytes(block)
+}
+
+func errorPacket(code uint16, msg string) string {
+	return opcodeBytes(5) + uint16Bytes(code) + msg + "\x00"
+}
+
+func oack(opts ...string) string {
+	return opcodeBytes(6) + nulTerminated(opts)
+}
+
+func opcodeBytes(opcode uint16) string {
+	return uint16Bytes(opcode)
+}
+
+func uint16Bytes(n uint16) string {
+	return string(binary.BigEndian.AppendUint16(nil, n))
+}
+
+func nulTerminated(fields []string) string {
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return strings.Join(fields, "\x00") + "\x00"
+}
+
+func TestWireRead(t *testing.T) {
+	t.Parallel()
+
+	block := strings.Repeat("x", 512)
+
+	w, _ := newWire(t, map[string]string{"file": block + "tail"})
+
+	w.send(rrq("file", "octet"))
+	w.expect(data(1, block))
+	w.send(ack(1))
+	w.expect(data(2, "tail"))
+	w.send(ack(2))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadBlockMultiple(t *testing.T) {
+	t.Parallel()
+
+	block := strings.Repeat("x", 512)
+
+	w, _ := newWire(t, map[string]string{"file": block})
+
+	// a file filling whole blocks ends with an empty DATA packet
+	w.send(rrq("file", "octet"))
+	w.expect(data(1, block))
+	w.send(ack(1))
+	w.expect(data(2, ""))
+	w.send(ack(2))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadEmptyFile(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, map[string]string{"empty": ""})
+
+	w.send(rrq("empty", "octet"))
+	w.expect(data(1, ""))
+	w.send(ack(1))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadEmptyFileNetascii(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, map[string]string{"empty": ""})
+
+	w.send(rrq("empty", "netascii"))
+	w.expect(data(1, ""))
+	w.send(ack(1))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadNetascii(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, map[string]string{"text": "a\nb\rc"})
+
+	w.send(rrq("text", "NETASCII"))
+	w.expect(data(1, "a\r\nb\r\x00c"))
+	w.send(ack(1))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadNetasciiTsize(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, map[string]string{"text": "a\nb"})
+
+	// the size of the converted file is unknown, whatever the case of the mode
+	w.send(rrq("text", "NETASCII", "blksize", "8", "tsize", "0"))
+	w.expect(oack("blksize", "8"))
+	w.send(ack(0))
+	w.expect(data(1, "a\r\nb"))
+	w.send(ack(1))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadNetasciiOffset(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, map[string]string{"text": "a\nbc"})
+
+	// offsets are positions in the octet file, netascii reads start over
+	w.send(rrq("text", "NetAscii", "blksize", "8", "offset", "2"))
+	w.expect(oack("blksize", "8"))
+	w.send(ack(0))
+	w.expect(data(1, "a\r\nbc"))
+	w.send(ack(1))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadOptions(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, map[string]string{"file": "0123456789"})
+
+	w.send(rrq("file", "octet", "BLKSIZE", "8", "tsize", "0", "unknown", "1"))
+	w.expect(oack("blksize", "8", "tsize", "10"))
+	w.send(ack(0))
+	w.expect(data(1, "01234567"))
+	w.send(ack(1))
+	w.expect(data(2, "89"))
+	w.send(ack(2))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadRetransmits(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, map[string]string{"file": "hello"})
+
+	w.send(rrq("file", "octet"))
+	w.expect(data(1, "hello"))
+	// the ACK is lost, the block is sent again after the timeout
+	w.expect(data(1, "hello"))
+	w.send(ack(1))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadIgnoresDuplicateAck(t *testing.T) {
+	t.Parallel()
+
+	block := strings.Repeat("x", 512)
+
+	w, _ := newWire(t, map[string]string{"file": block + "tail"})
+
+	w.send(rrq("file", "octet"))
+	w.expect(data(1, block))
+	w.send(ack(1))
+	w.expect(data(2, "tail"))
+	// a delayed duplicate ACK must not trigger a retransmission (Sorcerer's
+	// Apprentice syndrome)
+	w.send(ack(1))
+	w.silent(wireRTO / 2)
+	w.send(ack(2))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadGivesUp(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, map[string]string{"file": "hello"})
+
+	w.send(rrq("file", "octet"))
+
+	for range 3 {
+		w.expect(data(1, "hello"))
+	}
+
+	w.expect(errorPacket(0, "server can not create data packet"))
+	w.silent(2 * wireRTO)
+}
+
+// auditEntries records the audit entries of a server.
+type auditEntries chan *audit.Entry
+
+func (a auditEntries) Record(e *audit.Entry) error {
+	a <- e
+
+	return nil
+}
+
+func (a auditEntries) Close() error {
+	return nil
+}
+
+func TestWireReadGivesUpAudited(t *testing.T) {
+	t.Parallel()
+
+	content := strings.Repeat("a", 600)
+	entries := make(auditEntries, 1)
+	w, _ := newWire(t, map[string]string{"file": content}, func(s *Server) { s.SetAuditRecorder(entries) })
+
+	w.send(rrq("file", "octet"))
+	w.expect(data(1, content[:512]))
+	w.send(ack(1))
+
+	for range 3 {
+		w.expect(data(2, content[512:]))
+	}
+
+	w.expect(errorPacket(0, "server can not create data packet"))
+
+	// only the acknowledged block is accounted for
+	e := <-entries
+	sum := sha256.Sum256([]byte(content[:512]))
+
+	if e.Status != audit.StatusFailed || e.Error == "" {
+		t.Errorf("recorded status %q with error %q, expected a failure", e.Status, e.Error)
+	}
+
+	if e.Bytes != 512 || e.Sha256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("recorded %d bytes with sha256 %s, expected the first block", e.Bytes, e.Sha256)
+	}
+}
+
+func TestWireReadAbortedByClient(t *testing.T) {
+	t.Parallel()
+
+	block := strings.Repeat("x", 512)
+
+	w, _ := newWire(t, map[string]string{"file": block + "tail"})
+
+	w.send(rrq("file", "octet"))
+	w.expect(data(1, block))
+	w.send(errorPacket(0, "cancelled"))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireReadNotFound(t *testing.T) {
+	t.Parallel()
+
+	w, dir := newWire(t, nil)
+
+	w.send(rrq("missing", "octet"))
+	w.expect(errorPacket(1, dir+"/missing not found"))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireWrite(t *testing.T) {
+	t.Parallel()
+
+	block := strings.Repeat("y", 512)
+
+	w, dir := newWire(t, nil)
+
+	w.send(wrq("upload", "octet"))
+	w.expect(ack(0))
+	w.send(data(1, block))
+	w.expect(ack(1))
+	w.send(data(2, "end"))
+	w.expect(ack(2))
+	w.silent(2 * wireRTO)
+
+	got, err := os.ReadFile(filepath.Join(dir, "upload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != block+"end" {
+		t.Fatalf("wrote %d bytes, expected %d", len(got), len(block)+3)
+	}
+}
+
+func TestWireWriteFinalAckLost(t *testing.T) {
+	t.Parallel()
+
+	w, dir := newWire(t, nil)
+
+	w.send(wrq("upload", "octet"))
+	w.expect(ack(0))
+	w.send(data(1, "end"))
+	w.expect(ack(1))
+	// the final ACK is lost twice, the server dallies and acknowledges each
+	// retransmission of the last block without writing it again
+	w.send(data(1, "end"))
+	w.expect(ack(1))
+	w.send(data(1, "end"))
+	w.expect(ack(1))
+	// other blocks do not extend the dally
+	w.send(data(2, "late"))
+	w.silent(2 * wireRTO)
+
+	got, err := os.ReadFile(filepath.Join(dir, "upload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != "end" {
+		t.Fatalf("wrote %q", got)
+	}
+}
+
+func TestWireWriteLogsNoError(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zap.ErrorLevel)
+	w, _ := newWire(t, nil, func(s *Server) { s.logger = zap.New(core).Sugar() })
+
+	w.send(wrq("upload", "octet"))
+	w.expect(ack(0))
+	w.send(data(1, "end"))
+	w.expect(ack(1))
+	// the file is closed once the dally is over
+	w.silent(3 * wireRTO)
+
+	for _, entry := range logs.All() {
+		t.Errorf("logged %q", entry.Message)
+	}
+}
+
+func TestWireWriteEmptyFile(t *testing.T) {
+	t.Parallel()
+
+	w, dir := newWire(t, nil)
+
+	w.send(wrq("empty", "octet"))
+	w.expect(ack(0))
+	w.send(data(1, ""))
+	w.expect(ack(1))
+	w.silent(2 * wireRTO)
+
+	info, err := os.Stat(filepath.Join(dir, "empty"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != 0 {
+		t.Fatalf("wrote %d bytes, expected an empty file", info.Size())
+	}
+}
+
+func TestWireWriteOptions(t *testing.T) {
+	t.Parallel()
+
+	w, dir := newWire(t, nil)
+
+	w.send(wrq("upload", "octet", "blksize", "8", "tsize", "10"))
+	w.expect(oack("blksize", "8", "tsize", "10"))
+	w.send(data(1, "01234567"))
+	w.expect(ack(1))
+	w.send(data(2, "89"))
+	w.expect(ack(2))
+	w.silent(2 * wireRTO)
+
+	got, err := os.ReadFile(filepath.Join(dir, "upload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != "0123456789" {
+		t.Fatalf("wrote %q", got)
+	}
+}
+
+func TestWireWriteResendsAck(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWire(t, nil)
+
+	w.send(wrq("upload", "octet"))
+	w.expect(ack(0))
+	// the first DATA is lost, the ACK is sent again after the timeout
+	w.expect(ack(0))
+	w.send(data(1, "x"))
+	w.expect(ack(1))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireWriteDuplicateData(t *testing.T) {
+	t.Parallel()
+
+	block := strings.Repeat("z", 512)
+
+	w, dir := newWire(t, nil)
+
+	w.send(wrq("upload", "octet"))
+	w.expect(ack(0))
+	w.send(data(1, block))
+	w.expect(ack(1))
+	// the ACK was lost, the duplicate is acknowledged but not written again
+	w.send(data(1, block))
+	w.expect(ack(1))
+	w.send(data(2, ""))
+	w.expect(ack(2))
+	w.silent(2 * wireRTO)
+
+	got, err := os.ReadFile(filepath.Join(dir, "upload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != block {
+		t.Fatalf("wrote %d bytes, expected %d", len(got), len(block))
+	}
+}
+
+func TestWireWriteExists(t *testing.T) {
+	t.Parallel()
+
+	w, dir := newWire(t, map[string]string{"file": "x"})
+
+	w.send(wrq("file", "octet"))
+	w.expect(errorPacket(6, dir+"/file already exists"))
+	w.silent(2 * wireRTO)
+}
+
+func TestWireIllegalRequests(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		request string
+		reply   string
+	}{
+		{"unknown opcode", opcodeBytes(9) + "file\x00octet\x00", errorPacket(4, "server can not resolve request operation")},
+		{"data as request", data(1, "x"), errorPacket(4, "server can not resolve request operation")},
+		{"truncated request", opcodeBytes(1) + "file", errorPacket(4, "server can not resolve request operation")},
+		{"unsupported mode", rrq("file", "mail"), errorPacket(4, "unsupported mode mail")},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			w, _ := newWire(t, map[string]string{"file": "x"})
+
+			w.send(tc.request)
+			w.expect(tc.reply)
+			w.silent(2 * wireRTO)
+		})
+	}
+}
@@ -1,12 +1,6 @@
 package types
 
-import (
-	"bytes"
-	"encoding/binary"
-	"fmt"
-
-	"github.com/Wa4h1h/go-tftp/pkg/utils"
-)
+import "encoding/binary"
 
 type Ack struct {
 	Opcode   OpCode
@@ -14,35 +8,32 @@ type Ack struct {
 }
 
 func (a *Ack) MarshalBinary() ([]byte, error) {
-	b := new(bytes.Buffer)
-	ackLength := 2 + 2
-	b.Grow(ackLength)
-
-	if err := binary.Write(b, binary.BigEndian, &a.Opcode); err != nil {
-		return nil, fmt.Errorf("error while writing opcode: %w", err)
-	}
+	return a.AppendBinary(make([]byte, 0, 2+2))
+}
 
-	if err := binary.Write(b, binary.BigEndian, &a.BlockNum); err != nil {
-		return nil, fmt.Errorf("error while writing block#: %w", err)
-	}
+func (a *Ack) AppendBinary(b []byte) ([]byte, error) {
+	b = binary.BigEndian.AppendUint16(b, uint16(a.Opcode))
 
-	return b.Bytes(), nil
+	return binary.BigEndian.AppendUint16(b, a.BlockNum), nil
 }
 
 func (a *Ack) UnmarshalBinary(data []byte) error {
-	b := bytes.NewBuffer(data)
+	d := newDecoder(data, OpCodeACK.String())
 
-	if err := binary.Read(b, binary.BigEndian, &a.Opcode); err != nil {
-		return fmt.Errorf("error while reading opcode: %w", err)
+	if _, err := d.opcode(OpCodeACK); err != nil {
+		return err
 	}
 
-	if a.Opcode != OpCodeACK {
-		return utils.ErrWrongOpCode
+	blockNum, err := d.uint16("block#")
+	if err != nil {
+		return err
 	}
 
-	if err := binary.Read(b, binary.BigEndian, &a.BlockNum); err != nil {
-		return fmt.Errorf("error while reading block#: %w", err)
+	if err := d.end(); err != nil {
+		return err
 	}
 
+	*a = Ack{Opcode: OpCodeACK, BlockNum: blockNum}
+
 	return nil
 }
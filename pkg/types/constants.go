@@ -8,6 +8,7 @@ const (
 	OpCodeDATA
 	OpCodeACK
 	OpCodeError
+	OpCodeOACK
 )
 
 type ErrCode uint16
@@ -21,15 +22,30 @@ const (
 	ErrUnknownTransferId
 	ErrFileAlreadyExists
 	ErrNoSuchUser
+	ErrOptionNegotiation
 )
 
 const (
 	MaxBlocks      = 65535
 	MaxPayloadSize = 512
 	DatagramSize   = 516
+	MinBlockSize   = 8
+	MaxBlockSize   = 65464
+	MaxWindowSize  = 65535
+	MaxTimeout     = 255
 )
 
 const (
-	DefaultClientTimeout = 5
-	DefaultMode          = "octet"
+	ModeOctet    = "octet"
+	ModeNetascii = "netascii"
+)
+
+const (
+	// DefaultClientTimeout is the total deadline of a client transfer in
+	// seconds, 0 means no deadline.
+	DefaultClientTimeout = 0
+	// DefaultRexmt is the time in seconds a client waits for an answer before
+	// sending a packet again.
+	DefaultRexmt = 5
+	DefaultMode  = ModeOctet
 )
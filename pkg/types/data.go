@@ -1,9 +1,7 @@
 package types
 
 import (
-	"bytes"
 	"encoding/binary"
-	"fmt"
 
 	"github.com/Wa4h1h/go-tftp/pkg/utils"
 )
@@ -15,45 +13,37 @@ type Data struct {
 }
 
 func (d *Data) MarshalBinary() ([]byte, error) {
-	if len(d.Payload) > MaxPayloadSize {
-		return nil, utils.ErrDataPayloadTooBig
-	}
-
-	b := new(bytes.Buffer)
-	dataLen := 2 + 2 + len(d.Payload)
-	b.Grow(dataLen)
-
-	if err := binary.Write(b, binary.BigEndian, &d.Opcode); err != nil {
-		return nil, fmt.Errorf("error while writing opcode: %w", err)
-	}
+	return d.AppendBinary(make([]byte, 0, 2+2+len(d.Payload)))
+}
 
-	if err := binary.Write(b, binary.BigEndian, &d.BlockNum); err != nil {
-		return nil, fmt.Errorf("error while writing block#: %w", err)
+func (d *Data) AppendBinary(b []byte) ([]byte, error) {
+	if len(d.Payload) > MaxBlockSize {
+		return nil, utils.ErrDataPayloadTooBig
 	}
 
-	if _, err := b.Write(d.Payload); err != nil {
-		return nil, fmt.Errorf("error while writing payload: %w", err)
-	}
+	b = binary.BigEndian.AppendUint16(b, uint16(d.Opcode))
+	b = binary.BigEndian.AppendUint16(b, d.BlockNum)
 
-	return b.Bytes(), nil
+	return append(b, d.Payload...), nil
 }
 
 func (d *Data) UnmarshalBinary(data []byte) error {
-	b := bytes.NewBuffer(data)
+	dec := newDecoder(data, OpCodeDATA.String())
 
-	if err := binary.Read(b, binary.BigEndian, &d.Opcode); err != nil {
-		return fmt.Errorf("error while reading opcode: %w", err)
+	if _, err := dec.opcode(OpCodeDATA); err != nil {
+		return err
 	}
 
-	if d.Opcode != OpCodeDATA {
-		return utils.ErrWrongOpCode
+	blockNum, err := dec.uint16("block#")
+	if err != nil {
+		return err
 	}
 
-	if err := binary.Read(b, binary.BigEndian, &d.BlockNum); err != nil {
-		return fmt.Errorf("error while reading block#: %w", err)
+	if len(data)-dec.off > MaxBlockSize {
+		return dec.fail("payload", utils.ErrDataPayloadTooBig)
 	}
 
-	d.Payload = data[4:]
+	*d = Data{Payload: dec.rest(), BlockNum: blockNum, Opcode: OpCodeDATA}
 
 	return nil
 }
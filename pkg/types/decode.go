@@ -0,0 +1,196 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+// MaxRequestSize is the largest RRQ or WRQ accepted, options included
+// (RFC 2347).
+const MaxRequestSize = 512
+
+var opCodeNames = map[OpCode]string{
+	OpCodeRRQ:   "RRQ",
+	OpCodeWRQ:   "WRQ",
+	OpCodeDATA:  "DATA",
+	OpCodeACK:   "ACK",
+	OpCodeError: "ERROR",
+	OpCodeOACK:  "OACK",
+}
+
+func (o OpCode) String() string {
+	if name, ok := opCodeNames[o]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("opcode %d", uint16(o))
+}
+
+// DecodeError is returned by the UnmarshalBinary methods when a packet is
+// malformed. Err is one of the utils.Err* decoding errors so that callers can
+// match the cause with errors.Is.
+type DecodeError struct {
+	Err error
+	// Packet is the packet type being decoded
+	Packet string
+	// Field is the part of the packet that could not be decoded
+	Field  string
+	Offset int
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("error while decoding %s of %s packet at offset %d: %s", e.Field, e.Packet, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decoder reads the fields of a packet in order and reports the first
+// framing error.
+type decoder struct {
+	data   []byte
+	off    int
+	packet string
+}
+
+func newDecoder(data []byte, packet string) *decoder {
+	return &decoder{data: data, packet: packet}
+}
+
+func (d *decoder) fail(field string, err error) error {
+	return &DecodeError{Err: err, Packet: d.packet, Field: field, Offset: d.off}
+}
+
+// opcode reads the opcode, it has to be one of expected.
+func (d *decoder) opcode(expected ...OpCode) (OpCode, error) {
+	n, err := d.uint16("opcode")
+	if err != nil {
+		return 0, err
+	}
+
+	op := OpCode(n)
+
+	for _, e := range expected {
+		if op == e {
+			return op, nil
+		}
+	}
+
+	d.off -= 2
+
+	return 0, d.fail("opcode", utils.ErrWrongOpCode)
+}
+
+func (d *decoder) uint16(field string) (uint16, error) {
+	if len(d.data)-d.off < 2 {
+		return 0, d.fail(field, utils.ErrPacketTruncated)
+	}
+
+	n := binary.BigEndian.Uint16(d.data[d.off:])
+	d.off += 2
+
+	return n, nil
+}
+
+// string reads a null terminated string, the terminator is consumed.
+func (d *decoder) string(field string) (string, error) {
+	i := bytes.IndexByte(d.data[d.off:], 0)
+	if i < 0 {
+		return "", d.fail(field, utils.ErrMissingTerminator)
+	}
+
+	s := string(d.data[d.off : d.off+i])
+	d.off += i + 1
+
+	return s, nil
+}
+
+// nonEmpty reads a null terminated string that can not be empty.
+func (d *decoder) nonEmpty(field string) (string, error) {
+	start := d.off
+
+	s, err := d.string(field)
+	if err != nil {
+		return "", err
+	}
+
+	if s == "" {
+		d.off = start
+
+		return "", d.fail(field, utils.ErrEmptyField)
+	}
+
+	return s, nil
+}
+
+// ascii reads a non empty null terminated string of printable ascii
+// characters.
+func (d *decoder) ascii(field string) (string, error) {
+	start := d.off
+
+	s, err := d.nonEmpty(field)
+	if err != nil {
+		return "", err
+	}
+
+	if !isPrintableASCII(s) {
+		d.off = start
+
+		return "", d.fail(field, utils.ErrNotASCII)
+	}
+
+	return s, nil
+}
+
+// rest returns the remaining bytes.
+func (d *decoder) rest() []byte {
+	b := d.data[d.off:]
+	d.off = len(d.data)
+
+	return b
+}
+
+// options reads name and value pairs up to the end of the packet.
+func (d *decoder) options() (Options, error) {
+	var opts Options
+
+	for d.off < len(d.data) {
+		name, err := d.ascii("option name")
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := d.string("option value")
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, Option{Name: strings.ToLower(name), Value: value})
+	}
+
+	return opts, nil
+}
+
+// end fails when bytes are left after the last field.
+func (d *decoder) end() error {
+	if d.off < len(d.data) {
+		return d.fail("end", utils.ErrTrailingData)
+	}
+
+	return nil
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
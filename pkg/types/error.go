@@ -1,10 +1,8 @@
 package types
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
-	"strings"
 
 	"github.com/Wa4h1h/go-tftp/pkg/utils"
 )
@@ -16,51 +14,97 @@ type Error struct {
 }
 
 func (e *Error) MarshalBinary() ([]byte, error) {
-	b := new(bytes.Buffer)
-	errLength := 2 + 2 + len(e.ErrMsg) + 1
-	b.Grow(errLength)
+	return e.AppendBinary(make([]byte, 0, 2+2+len(e.ErrMsg)+1))
+}
+
+func (e *Error) AppendBinary(b []byte) ([]byte, error) {
+	b = binary.BigEndian.AppendUint16(b, uint16(e.Opcode))
+	b = binary.BigEndian.AppendUint16(b, uint16(e.ErrorCode))
+	b = append(b, e.ErrMsg...)
+
+	return append(b, 0), nil
+}
+
+func (e *Error) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data, OpCodeError.String())
 
-	if err := binary.Write(b, binary.BigEndian, &e.Opcode); err != nil {
-		return nil, fmt.Errorf("error while writing opcode: %w", err)
+	if _, err := d.opcode(OpCodeError); err != nil {
+		return err
 	}
 
-	if err := binary.Write(b, binary.BigEndian, &e.ErrorCode); err != nil {
-		return nil, fmt.Errorf("error while writing error code: %w", err)
+	code, err := d.uint16("error code")
+	if err != nil {
+		return err
 	}
 
-	if _, err := b.WriteString(e.ErrMsg); err != nil {
-		return nil, fmt.Errorf("error while writing error message: %w", err)
+	msg, err := d.string("error message")
+	if err != nil {
+		return err
 	}
 
-	if err := b.WriteByte(0); err != nil {
-		return nil, fmt.Errorf("error while writing null byte")
+	if err := d.end(); err != nil {
+		return err
 	}
 
-	return b.Bytes(), nil
+	*e = Error{ErrMsg: msg, ErrorCode: ErrCode(code), Opcode: OpCodeError}
+
+	return nil
 }
 
-func (e *Error) UnmarshalBinary(data []byte) error {
-	b := bytes.NewBuffer(data)
-	var err error
+var errCodeMessages = map[ErrCode]string{
+	ErrNotDefined:        "not defined",
+	ErrFileNotFound:      "file not found",
+	ErrAccessViolation:   "access violation",
+	ErrDiskFull:          "disk full or allocation exceeded",
+	ErrIllegalTftpOp:     "illegal tftp operation",
+	ErrUnknownTransferId: "unknown transfer id",
+	ErrFileAlreadyExists: "file already exists",
+	ErrNoSuchUser:        "no such user",
+	ErrOptionNegotiation: "option negotiation failed",
+}
 
-	if err = binary.Read(b, binary.BigEndian, &e.Opcode); err != nil {
-		return fmt.Errorf("error while reading opcode: %w", err)
+func (c ErrCode) String() string {
+	if msg, ok := errCodeMessages[c]; ok {
+		return msg
 	}
 
-	if e.Opcode != OpCodeError {
-		return utils.ErrWrongOpCode
-	}
+	return fmt.Sprintf("error code %d", uint16(c))
+}
 
-	if err = binary.Read(b, binary.BigEndian, &e.ErrorCode); err != nil {
-		return fmt.Errorf("error while reading error code: %w", err)
-	}
+// Error makes error codes usable as targets of errors.Is, e.g.
+// errors.Is(err, types.ErrFileNotFound).
+func (c ErrCode) Error() string {
+	return c.String()
+}
 
-	e.ErrMsg, err = b.ReadString(0)
-	if err != nil {
-		return fmt.Errorf("error while reading error message: %w", err)
+// TFTPError is the error sent by the remote end of a transfer.
+type TFTPError struct {
+	Msg  string
+	Code ErrCode
+}
+
+func (e *Error) Err() *TFTPError {
+	return &TFTPError{Msg: e.ErrMsg, Code: e.ErrorCode}
+}
+
+func (e *TFTPError) Error() string {
+	msg := e.Msg
+	if msg == "" {
+		msg = e.Code.String()
 	}
 
-	e.ErrMsg = strings.TrimRight(e.ErrMsg, string(byte(0)))
+	return fmt.Sprintf("tftp error %d: %s", uint16(e.Code), msg)
+}
 
-	return nil
+// Is matches error codes, other TFTP errors with the same code and
+// utils.ErrRemoteError.
+func (e *TFTPError) Is(target error) bool {
+	switch t := target.(type) {
+	case ErrCode:
+		return t == e.Code
+	case *TFTPError:
+		return t.Code == e.Code
+	default:
+		return target == utils.ErrRemoteError
+	}
 }
@@ -1 +1,39 @@
 package types
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+func TestTFTPErrorIs(t *testing.T) {
+	packet := &Error{Opcode: OpCodeError, ErrorCode: ErrDiskFull, ErrMsg: "no space left"}
+
+	b, err := packet.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received Error
+
+	if err := received.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	err = fmt.Errorf("error while sending file: %w", received.Err())
+
+	if !errors.Is(err, ErrDiskFull) || errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("%v does not match its error code only", err)
+	}
+
+	if !errors.Is(err, utils.ErrRemoteError) {
+		t.Fatalf("%v is not a remote error", err)
+	}
+
+	var tftpErr *TFTPError
+	if !errors.As(err, &tftpErr) || tftpErr.Msg != "no space left" {
+		t.Fatalf("%v does not carry the remote message", err)
+	}
+}
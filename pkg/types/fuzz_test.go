@@ -0,0 +1,89 @@
+package types
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fuzzDecoder checks that decoding never panics, that every failure is a
+// DecodeError and that accepted packets encode back to the same length and
+// decode to the same value. The golden packets of every type seed the corpus.
+func fuzzDecoder(f *testing.F, empty func() Packet, seeds ...string) {
+	f.Helper()
+
+	for _, tc := range goldenPackets {
+		b, err := tc.packet.MarshalBinary()
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		f.Add(b)
+	}
+
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, wire []byte) {
+		decoded := empty()
+
+		if err := decoded.UnmarshalBinary(wire); err != nil {
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("untyped decode error %v", err)
+			}
+
+			if decodeErr.Offset < 0 || decodeErr.Offset > len(wire) {
+				t.Fatalf("error offset %d outside of the %d byte packet", decodeErr.Offset, len(wire))
+			}
+
+			return
+		}
+
+		encoded, err := decoded.MarshalBinary()
+		if err != nil {
+			t.Fatalf("can not encode decoded packet %+v: %v", decoded, err)
+		}
+
+		// option names are lowercased, everything else is kept byte for byte
+		if len(encoded) != len(wire) || !bytes.EqualFold(encoded, wire) {
+			t.Fatalf("decoded % x and encoded it as % x", wire, encoded)
+		}
+
+		again := empty()
+		if err := again.UnmarshalBinary(encoded); err != nil {
+			t.Fatalf("can not decode encoded packet % x: %v", encoded, err)
+		}
+
+		if !reflect.DeepEqual(again, decoded) {
+			t.Fatalf("decoded %+v after encoding %+v", again, decoded)
+		}
+	})
+}
+
+func FuzzRequest(f *testing.F) {
+	fuzzDecoder(f, newRequest,
+		"\x00\x01file\x00octet\x00BLKSIZE\x001024\x00",
+		"\x00\x02file\x00netascii\x00tsize\x00\x00",
+		"\x00\x01file\x00octet",
+		"\x00\x01file\x00oct\xe9t\x00",
+		"\x00\x01file\x00octet\x00\x00\x00")
+}
+
+func FuzzData(f *testing.F) {
+	fuzzDecoder(f, newData, "\x00\x03", "\x00\x03\x00")
+}
+
+func FuzzAck(f *testing.F) {
+	fuzzDecoder(f, newAck, "\x00\x04\x00\x01\x00", "\x00\x04\x01")
+}
+
+func FuzzError(f *testing.F) {
+	fuzzDecoder(f, newError, "\x00\x05\x00\x01msg", "\x00\x05\x00\x01msg\x00x")
+}
+
+func FuzzOAck(f *testing.F) {
+	fuzzDecoder(f, newOAck, "\x00\x06", "\x00\x06BlkSize\x00512\x00", "\x00\x06blksize\x00")
+}
@@ -0,0 +1,255 @@
+package types
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenPackets are the RFC 1350, 2347, 2348, 2349 and 7440 packets checked
+// against testdata/packets.golden.
+var goldenPackets = []struct {
+	name   string
+	packet Packet
+	empty  func() Packet
+}{
+	{"rrq octet", &Request{Opcode: OpCodeRRQ, Filename: "file.bin", Mode: ModeOctet}, newRequest},
+	{"rrq netascii", &Request{Opcode: OpCodeRRQ, Filename: "dir/file.txt", Mode: ModeNetascii}, newRequest},
+	{"rrq mixed case mode", &Request{Opcode: OpCodeRRQ, Filename: "f", Mode: "NetASCII"}, newRequest},
+	{"wrq octet", &Request{Opcode: OpCodeWRQ, Filename: "upload", Mode: ModeOctet}, newRequest},
+	{"rrq options", &Request{Opcode: OpCodeRRQ, Filename: "big", Mode: ModeOctet, Options: Options{
+		{Name: OptionBlockSize, Value: "1428"},
+		{Name: OptionTransferSize, Value: "0"},
+		{Name: OptionTimeout, Value: "3"},
+		{Name: OptionWindowSize, Value: "8"},
+	}}, newRequest},
+	{"rrq offset", &Request{Opcode: OpCodeRRQ, Filename: "big", Mode: ModeOctet, Options: Options{
+		{Name: OptionOffset, Value: "1024"},
+	}}, newRequest},
+	{"wrq tsize", &Request{Opcode: OpCodeWRQ, Filename: "upload", Mode: ModeOctet, Options: Options{
+		{Name: OptionTransferSize, Value: "70000"},
+	}}, newRequest},
+	{"data", &Data{Opcode: OpCodeDATA, BlockNum: 1, Payload: []byte("hello")}, newData},
+	{"data empty", &Data{Opcode: OpCodeDATA, BlockNum: 3, Payload: []byte{}}, newData},
+	{"data netascii", &Data{Opcode: OpCodeDATA, BlockNum: 2, Payload: []byte("a\r\nb\r\x00")}, newData},
+	{"data last block", &Data{Opcode: OpCodeDATA, BlockNum: 65535, Payload: []byte{0xff}}, newData},
+	{"ack 0", &Ack{Opcode: OpCodeACK, BlockNum: 0}, newAck},
+	{"ack 258", &Ack{Opcode: OpCodeACK, BlockNum: 258}, newAck},
+	{"ack 65535", &Ack{Opcode: OpCodeACK, BlockNum: 65535}, newAck},
+	{"error not defined", &Error{Opcode: OpCodeError, ErrorCode: ErrNotDefined, ErrMsg: "no defined error"}, newError},
+	{"error file not found", &Error{Opcode: OpCodeError, ErrorCode: ErrFileNotFound, ErrMsg: "file not found"}, newError},
+	{"error access violation", &Error{Opcode: OpCodeError, ErrorCode: ErrAccessViolation, ErrMsg: "access violation"}, newError},
+	{"error disk full", &Error{Opcode: OpCodeError, ErrorCode: ErrDiskFull, ErrMsg: "disk full"}, newError},
+	{"error illegal operation", &Error{Opcode: OpCodeError, ErrorCode: ErrIllegalTftpOp, ErrMsg: "illegal"}, newError},
+	{"error unknown tid", &Error{Opcode: OpCodeError, ErrorCode: ErrUnknownTransferId, ErrMsg: "unknown transfer id"}, newError},
+	{"error file exists", &Error{Opcode: OpCodeError, ErrorCode: ErrFileAlreadyExists, ErrMsg: "exists"}, newError},
+	{"error no such user", &Error{Opcode: OpCodeError, ErrorCode: ErrNoSuchUser, ErrMsg: "no such user"}, newError},
+	{"error option negotiation", &Error{Opcode: OpCodeError, ErrorCode: ErrOptionNegotiation, ErrMsg: ""}, newError},
+	{"oack", &OAck{Opcode: OpCodeOACK, Options: Options{
+		{Name: OptionBlockSize, Value: "1024"},
+		{Name: OptionTransferSize, Value: "2048"},
+	}}, newOAck},
+	{"oack windowsize", &OAck{Opcode: OpCodeOACK, Options: Options{
+		{Name: OptionWindowSize, Value: "16"},
+		{Name: OptionTimeout, Value: "1"},
+	}}, newOAck},
+}
+
+func newRequest() Packet { return new(Request) }
+func newData() Packet    { return new(Data) }
+func newAck() Packet     { return new(Ack) }
+func newError() Packet   { return new(Error) }
+func newOAck() Packet    { return new(OAck) }
+
+const goldenFile = "packets.golden"
+
+// readGolden parses lines of "name: hex bytes", # starts a comment.
+func readGolden(t *testing.T) map[string][]byte {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", goldenFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	golden := make(map[string][]byte)
+	s := bufio.NewScanner(f)
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, encoded, ok := strings.Cut(line, ":")
+		if !ok {
+			t.Fatalf("malformed golden line %q", line)
+		}
+
+		b, err := hex.DecodeString(strings.ReplaceAll(encoded, " ", ""))
+		if err != nil {
+			t.Fatalf("golden %q: %v", name, err)
+		}
+
+		golden[name] = b
+	}
+
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return golden
+}
+
+func writeGolden(t *testing.T) {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	b.WriteString("# wire encoding of every packet type, regenerate with go test ./pkg/types -update\n")
+
+	for _, tc := range goldenPackets {
+		encoded, err := tc.packet.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hexBytes := make([]string, len(encoded))
+		for i, c := range encoded {
+			hexBytes[i] = fmt.Sprintf("%02x", c)
+		}
+
+		fmt.Fprintf(&b, "%s: %s\n", tc.name, strings.Join(hexBytes, " "))
+	}
+
+	if err := os.WriteFile(filepath.Join("testdata", goldenFile), b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGoldenPackets(t *testing.T) {
+	if *update {
+		writeGolden(t)
+	}
+
+	golden := readGolden(t)
+
+	for _, tc := range goldenPackets {
+		t.Run(tc.name, func(t *testing.T) {
+			expected, ok := golden[tc.name]
+			if !ok {
+				t.Fatal("missing from the golden file, run with -update")
+			}
+
+			encoded, err := tc.packet.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(encoded, expected) {
+				t.Fatalf("encoded % x, expected % x", encoded, expected)
+			}
+
+			decoded := tc.empty()
+			if err := decoded.UnmarshalBinary(expected); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(decoded, tc.packet) {
+				t.Fatalf("decoded %+v, expected %+v", decoded, tc.packet)
+			}
+		})
+	}
+}
+
+func TestDecodeOptionNamesCaseInsensitive(t *testing.T) {
+	var r Request
+	if err := r.UnmarshalBinary([]byte("\x00\x01f\x00octet\x00BLKSIZE\x001024\x00TSize\x000\x00")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Options{{Name: OptionBlockSize, Value: "1024"}, {Name: OptionTransferSize, Value: "0"}}
+	if !reflect.DeepEqual(r.Options, expected) {
+		t.Fatalf("decoded options %+v, expected %+v", r.Options, expected)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	cases := []struct {
+		name   string
+		empty  func() Packet
+		wire   string
+		err    error
+		offset int
+	}{
+		{"empty request", newRequest, "", utils.ErrPacketTruncated, 0},
+		{"truncated opcode", newRequest, "\x00", utils.ErrPacketTruncated, 0},
+		{"request wrong opcode", newRequest, "\x00\x03f\x00octet\x00", utils.ErrWrongOpCode, 0},
+		{"request too big", newRequest, "\x00\x01" + strings.Repeat("f", MaxRequestSize) + "\x00octet\x00", utils.ErrRequestTooBig, 0},
+		{"request without filename terminator", newRequest, "\x00\x01file", utils.ErrMissingTerminator, 2},
+		{"request empty filename", newRequest, "\x00\x01\x00octet\x00", utils.ErrEmptyField, 2},
+		{"request without mode", newRequest, "\x00\x01file\x00", utils.ErrMissingTerminator, 7},
+		{"request empty mode", newRequest, "\x00\x01file\x00\x00", utils.ErrEmptyField, 7},
+		{"request without mode terminator", newRequest, "\x00\x01file\x00octet", utils.ErrMissingTerminator, 7},
+		{"request non ascii mode", newRequest, "\x00\x01file\x00oct\xe9t\x00", utils.ErrNotASCII, 7},
+		{"request control character in mode", newRequest, "\x00\x01file\x00oc\ttet\x00", utils.ErrNotASCII, 7},
+		{"request option without value", newRequest, "\x00\x01file\x00octet\x00blksize\x00", utils.ErrMissingTerminator, 21},
+		{"request option value without terminator", newRequest, "\x00\x01file\x00octet\x00blksize\x001024", utils.ErrMissingTerminator, 21},
+		{"request non ascii option name", newRequest, "\x00\x01file\x00octet\x00blk\xffsize\x001\x00", utils.ErrNotASCII, 13},
+		{"request empty option name", newRequest, "\x00\x01file\x00octet\x00\x00", utils.ErrEmptyField, 13},
+		{"data wrong opcode", newData, "\x00\x04\x00\x01", utils.ErrWrongOpCode, 0},
+		{"data truncated block", newData, "\x00\x03\x00", utils.ErrPacketTruncated, 2},
+		{"data payload too big", newData, "\x00\x03\x00\x01" + strings.Repeat("d", MaxBlockSize+1), utils.ErrDataPayloadTooBig, 4},
+		{"ack wrong opcode", newAck, "\x00\x03\x00\x01", utils.ErrWrongOpCode, 0},
+		{"ack truncated block", newAck, "\x00\x04\x01", utils.ErrPacketTruncated, 2},
+		{"ack trailing data", newAck, "\x00\x04\x00\x01\x00", utils.ErrTrailingData, 4},
+		{"error wrong opcode", newError, "\x00\x04\x00\x01", utils.ErrWrongOpCode, 0},
+		{"error truncated code", newError, "\x00\x05\x00", utils.ErrPacketTruncated, 2},
+		{"error without terminator", newError, "\x00\x05\x00\x01missing", utils.ErrMissingTerminator, 4},
+		{"error trailing data", newError, "\x00\x05\x00\x01msg\x00garbage", utils.ErrTrailingData, 8},
+		{"oack wrong opcode", newOAck, "\x00\x01blksize\x001024\x00", utils.ErrWrongOpCode, 0},
+		{"oack option without value", newOAck, "\x00\x06blksize\x00", utils.ErrMissingTerminator, 10},
+		{"oack trailing data", newOAck, "\x00\x06blksize\x001024\x00x", utils.ErrMissingTerminator, 15},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.empty().UnmarshalBinary([]byte(tc.wire))
+
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) || !errors.Is(err, tc.err) {
+				t.Fatalf("expected a decode error matching %q, got %v", tc.err, err)
+			}
+
+			if decodeErr.Offset != tc.offset {
+				t.Fatalf("error at offset %d, expected %d: %v", decodeErr.Offset, tc.offset, err)
+			}
+		})
+	}
+}
+
+func TestDecodeKeepsPacketOnError(t *testing.T) {
+	a := Ack{Opcode: OpCodeACK, BlockNum: 7}
+
+	if err := a.UnmarshalBinary([]byte("\x00\x04\x00\x08\x00")); err == nil {
+		t.Fatal("decoded an ACK with trailing data")
+	}
+
+	if a.BlockNum != 7 {
+		t.Fatalf("failed decode changed the block# to %d", a.BlockNum)
+	}
+}
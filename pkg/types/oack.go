@@ -0,0 +1,35 @@
+package types
+
+import "encoding/binary"
+
+type OAck struct {
+	Options Options
+	Opcode  OpCode
+}
+
+func (o *OAck) MarshalBinary() ([]byte, error) {
+	return o.AppendBinary(make([]byte, 0, 2+o.Options.size()))
+}
+
+func (o *OAck) AppendBinary(b []byte) ([]byte, error) {
+	b = binary.BigEndian.AppendUint16(b, uint16(o.Opcode))
+
+	return o.Options.appendBinary(b), nil
+}
+
+func (o *OAck) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data, OpCodeOACK.String())
+
+	if _, err := d.opcode(OpCodeOACK); err != nil {
+		return err
+	}
+
+	opts, err := d.options()
+	if err != nil {
+		return err
+	}
+
+	*o = OAck{Options: opts, Opcode: OpCodeOACK}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package types
+
+import "strings"
+
+const (
+	OptionBlockSize    = "blksize"
+	OptionTransferSize = "tsize"
+	OptionTimeout      = "timeout"
+	OptionWindowSize   = "windowsize"
+	// OptionOffset is not standardized, it asks the server to start a read
+	// at the given byte offset to resume an interrupted download.
+	OptionOffset = "offset"
+)
+
+type Option struct {
+	Name  string
+	Value string
+}
+
+type Options []Option
+
+func (o Options) Get(name string) (string, bool) {
+	for _, opt := range o {
+		if strings.EqualFold(opt.Name, name) {
+			return opt.Value, true
+		}
+	}
+
+	return "", false
+}
+
+func (o *Options) Set(name string, value string) {
+	for i, opt := range *o {
+		if strings.EqualFold(opt.Name, name) {
+			(*o)[i].Value = value
+
+			return
+		}
+	}
+
+	*o = append(*o, Option{Name: name, Value: value})
+}
+
+func (o Options) size() int {
+	size := 0
+	for _, opt := range o {
+		size += len(opt.Name) + 1 + len(opt.Value) + 1
+	}
+
+	return size
+}
+
+func (o Options) appendBinary(b []byte) []byte {
+	for _, opt := range o {
+		b = append(b, opt.Name...)
+		b = append(b, 0)
+		b = append(b, opt.Value...)
+		b = append(b, 0)
+	}
+
+	return b
+}
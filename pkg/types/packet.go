@@ -0,0 +1,70 @@
+package types
+
+import (
+	"encoding"
+	"encoding/binary"
+	"sync"
+
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+// Packet is implemented by *Request, *Data, *Ack, *Error and *OAck.
+type Packet interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+	// AppendBinary appends the encoded packet to b, it does not allocate
+	// when b has enough capacity.
+	AppendBinary(b []byte) ([]byte, error)
+}
+
+// ParsePacket decodes b into the packet type given by its opcode. DATA
+// payloads point into b.
+func ParsePacket(b []byte) (Packet, error) {
+	if len(b) < 2 {
+		return nil, &DecodeError{Err: utils.ErrPacketTruncated, Packet: "packet", Field: "opcode"}
+	}
+
+	var p Packet
+
+	switch OpCode(binary.BigEndian.Uint16(b)) {
+	case OpCodeRRQ, OpCodeWRQ:
+		p = new(Request)
+	case OpCodeDATA:
+		p = new(Data)
+	case OpCodeACK:
+		p = new(Ack)
+	case OpCodeError:
+		p = new(Error)
+	case OpCodeOACK:
+		p = new(OAck)
+	default:
+		return nil, &DecodeError{Err: utils.ErrWrongOpCode, Packet: "packet", Field: "opcode"}
+	}
+
+	if err := p.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// MaxDatagramSize holds any UDP payload.
+const MaxDatagramSize = 65535
+
+var datagrams = sync.Pool{
+	New: func() any {
+		b := make([]byte, MaxDatagramSize)
+
+		return &b
+	},
+}
+
+// GetDatagram returns a MaxDatagramSize buffer to read packets into, it goes
+// back to the pool with PutDatagram once nothing refers to it anymore.
+func GetDatagram() *[]byte {
+	return datagrams.Get().(*[]byte)
+}
+
+func PutDatagram(b *[]byte) {
+	datagrams.Put(b)
+}
@@ -0,0 +1,84 @@
+package types
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Wa4h1h/go-tftp/pkg/utils"
+)
+
+func TestParsePacket(t *testing.T) {
+	for _, tc := range goldenPackets {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := tc.packet.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := ParsePacket(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(p, tc.packet) {
+				t.Fatalf("parsed %T %+v, expected %T %+v", p, p, tc.packet, tc.packet)
+			}
+		})
+	}
+
+	for _, b := range []string{"", "\x00", "\x00\x00", "\x00\x07\x00\x01"} {
+		_, err := ParsePacket([]byte(b))
+
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) || decodeErr.Field != "opcode" {
+			t.Fatalf("parsed % x without an opcode error: %v", b, err)
+		}
+	}
+
+	if _, err := ParsePacket([]byte("\x00\x04\x00")); !errors.Is(err, utils.ErrPacketTruncated) {
+		t.Fatalf("expected a truncated ACK, got %v", err)
+	}
+}
+
+func TestAppendBinary(t *testing.T) {
+	prefix := []byte("prefix")
+
+	for _, tc := range goldenPackets {
+		t.Run(tc.name, func(t *testing.T) {
+			expected, err := tc.packet.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := tc.packet.AppendBinary(append([]byte(nil), prefix...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(b, append(append([]byte(nil), prefix...), expected...)) {
+				t.Fatalf("appended % x, expected % x after the prefix", b, expected)
+			}
+
+			buffer := make([]byte, 0, len(expected))
+
+			allocs := testing.AllocsPerRun(100, func() {
+				if _, err := tc.packet.AppendBinary(buffer[:0]); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if allocs != 0 {
+				t.Fatalf("%.0f allocations encoding into a large enough buffer", allocs)
+			}
+		})
+	}
+}
+
+func TestAppendBinaryPayloadTooBig(t *testing.T) {
+	d := &Data{Opcode: OpCodeDATA, BlockNum: 1, Payload: make([]byte, MaxBlockSize+1)}
+
+	if _, err := d.AppendBinary(nil); !errors.Is(err, utils.ErrDataPayloadTooBig) {
+		t.Fatalf("expected ErrDataPayloadTooBig, got %v", err)
+	}
+}
@@ -1,10 +1,7 @@
 package types
 
 import (
-	"bytes"
 	"encoding/binary"
-	"fmt"
-	"strings"
 
 	"github.com/Wa4h1h/go-tftp/pkg/utils"
 )
@@ -12,65 +9,54 @@ import (
 type Request struct {
 	Filename string
 	Mode     string
+	Options  Options
 	Opcode   OpCode
 }
 
 func (r *Request) MarshalBinary() ([]byte, error) {
-	b := new(bytes.Buffer)
-	rqLen := 2 + len(r.Filename) + 1 + len(r.Mode) + 1
-
-	b.Grow(rqLen)
-
-	if err := binary.Write(b, binary.BigEndian, &r.Opcode); err != nil {
-		return nil, fmt.Errorf("error while writing Opcode: %w", err)
-	}
-
-	if _, err := b.WriteString(r.Filename); err != nil {
-		return nil, fmt.Errorf("error while writing filename: %w", err)
-	}
-
-	if err := b.WriteByte(0); err != nil {
-		return nil, fmt.Errorf("error while writing null byte after filename: %w", err)
-	}
-
-	if _, err := b.WriteString(r.Mode); err != nil {
-		return nil, fmt.Errorf("error while writing mode: %w", err)
-	}
+	return r.AppendBinary(make([]byte, 0, 2+len(r.Filename)+1+len(r.Mode)+1+r.Options.size()))
+}
 
-	if err := b.WriteByte(0); err != nil {
-		return nil, fmt.Errorf("error while writing null byte after mode: %w", err)
-	}
+func (r *Request) AppendBinary(b []byte) ([]byte, error) {
+	b = binary.BigEndian.AppendUint16(b, uint16(r.Opcode))
+	b = append(b, r.Filename...)
+	b = append(b, 0)
+	b = append(b, r.Mode...)
+	b = append(b, 0)
 
-	return b.Bytes(), nil
+	return r.Options.appendBinary(b), nil
 }
 
 func (r *Request) UnmarshalBinary(data []byte) error {
-	var err error
+	d := newDecoder(data, "request")
 
-	rd := bytes.NewBuffer(data)
+	if len(data) > MaxRequestSize {
+		return d.fail("request", utils.ErrRequestTooBig)
+	}
 
-	err = binary.Read(rd, binary.BigEndian, &r.Opcode)
+	op, err := d.opcode(OpCodeRRQ, OpCodeWRQ)
 	if err != nil {
-		return fmt.Errorf("error while decoding opCode: %w", err)
+		return err
 	}
 
-	if r.Opcode != OpCodeRRQ && r.Opcode != OpCodeWRQ {
-		return utils.ErrWrongOpCode
-	}
+	d.packet = op.String()
 
-	r.Filename, err = rd.ReadString(0)
+	filename, err := d.nonEmpty("filename")
 	if err != nil {
-		return fmt.Errorf("error while decoding filename: %w", err)
+		return err
 	}
 
-	r.Filename = strings.TrimRight(r.Filename, string(byte(0)))
+	mode, err := d.ascii("mode")
+	if err != nil {
+		return err
+	}
 
-	r.Mode, err = rd.ReadString(0)
+	opts, err := d.options()
 	if err != nil {
-		return fmt.Errorf("error while decoding mode: %w", err)
+		return err
 	}
 
-	r.Mode = strings.TrimRight(r.Mode, string(byte(0)))
+	*r = Request{Filename: filename, Mode: mode, Options: opts, Opcode: op}
 
 	return nil
 }
@@ -5,8 +5,24 @@ import "errors"
 var (
 	ErrStartingServer        = errors.New("error: starting the udp server")
 	ErrWrongOpCode           = errors.New("error: invalid operation code")
-	ErrDataPayloadTooBig     = errors.New("error: payload exceeds 512 bytes")
+	ErrDataPayloadTooBig     = errors.New("error: payload exceeds the maximum block size")
 	ErrPacketMarshall        = errors.New("error: can marshall packet")
 	ErrPacketCanNotBeSent    = errors.New("error: packet can not be sent")
 	ErrCanNotSetWriteTimeout = errors.New("error: can not set write timeout")
+	ErrUnsupportedMode       = errors.New("error: unsupported transfer mode")
+	ErrRemoteError           = errors.New("error: remote ended the transfer")
+	ErrRequestTimeout        = errors.New("error: request exceeded timeout")
+	ErrFileExists            = errors.New("error: local file already exists")
+	ErrRemoteNameRequired    = errors.New("error: remote filename is required when reading from stdin")
+	ErrNotConnected          = errors.New("error: no server address, connect first")
+	ErrInvalidOption         = errors.New("error: invalid transfer option")
+	ErrOptionNegotiation     = errors.New("error: remote acknowledged unexpected options")
+	ErrRemoteChanged         = errors.New("error: remote file changed since the download was interrupted")
+	ErrPacketTruncated       = errors.New("error: packet is truncated")
+	ErrMissingTerminator     = errors.New("error: field is not null terminated")
+	ErrTrailingData          = errors.New("error: unexpected bytes after the end of the packet")
+	ErrEmptyField            = errors.New("error: required field is empty")
+	ErrNotASCII              = errors.New("error: mode or option name is not printable ascii")
+	ErrRequestTooBig         = errors.New("error: request exceeds 512 bytes")
+	ErrNotSeekable           = errors.New("error: content can only be read forward")
 )
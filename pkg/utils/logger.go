@@ -8,6 +8,12 @@ import (
 )
 
 func NewLogger(level string) *zap.Logger {
+	l, _ := NewLoggerWithLevel(level)
+
+	return l
+}
+
+func NewLoggerWithLevel(level string) (*zap.Logger, zap.AtomicLevel) {
 	level = strings.ToUpper(level)
 
 	var config zap.Config
@@ -16,17 +22,30 @@ func NewLogger(level string) *zap.Logger {
 
 	if level == "DEBUG" {
 		config = zap.NewDevelopmentConfig()
-		config.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
 	} else {
 		config = zap.NewProductionConfig()
 		config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-		config.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
 	}
 
+	config.Level = zap.NewAtomicLevelAt(ParseLogLevel(level))
+
 	l, err := config.Build()
 	if err != nil {
 		panic("failed to instantiate logger")
 	}
 
-	return l
+	return l, config.Level
+}
+
+func ParseLogLevel(level string) zapcore.Level {
+	switch strings.ToUpper(level) {
+	case "DEBUG":
+		return zap.DebugLevel
+	case "WARN":
+		return zap.WarnLevel
+	case "ERROR":
+		return zap.ErrorLevel
+	default:
+		return zap.InfoLevel
+	}
 }
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"errors"
+	"io"
+)
+
+// ForwardSeeker reads content that can only be read forward, such as a
+// decompressed or downloaded file. Seeking forward discards the content up to
+// the offset, seeking backwards, or from the end of content of unknown size,
+// fails with ErrNotSeekable. Readers that can seek are seeked directly.
+type ForwardSeeker struct {
+	r    io.Reader
+	pos  int64
+	size int64
+}
+
+// NewForwardSeeker reads r, size is the size of the content, -1 when unknown.
+func NewForwardSeeker(r io.Reader, size int64) ForwardSeeker {
+	return ForwardSeeker{r: r, size: size}
+}
+
+func (f *ForwardSeeker) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	f.pos += int64(n)
+
+	return n, err
+}
+
+func (f *ForwardSeeker) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.r.(io.Seeker); ok {
+		pos, err := s.Seek(offset, whence)
+		if err == nil {
+			f.pos = pos
+		}
+
+		return pos, err
+	}
+
+	abs := offset
+
+	switch whence {
+	case io.SeekCurrent:
+		abs += f.pos
+	case io.SeekEnd:
+		if f.size < 0 {
+			return f.pos, ErrNotSeekable
+		}
+
+		abs += f.size
+	}
+
+	if abs < f.pos {
+		return f.pos, ErrNotSeekable
+	}
+
+	// skipped content is read from r like the rest, a reader teeing r sees it
+	_, err := io.CopyN(io.Discard, f, abs-f.pos)
+	if errors.Is(err, io.EOF) {
+		f.pos, err = abs, nil
+	}
+
+	return f.pos, err
+}
+
+// Pos returns the offset of the next read.
+func (f *ForwardSeeker) Pos() int64 {
+	return f.pos
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestForwardSeeker(t *testing.T) {
+	// a reader hiding its Seek method
+	f := NewForwardSeeker(iotest.HalfReader(strings.NewReader("0123456789")), 10)
+
+	if pos, err := f.Seek(4, io.SeekStart); err != nil || pos != 4 {
+		t.Fatalf("Seek(4) = %d, %v", pos, err)
+	}
+
+	if pos, err := f.Seek(2, io.SeekCurrent); err != nil || pos != 6 {
+		t.Fatalf("Seek(+2) = %d, %v", pos, err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); !errors.Is(err, ErrNotSeekable) {
+		t.Fatalf("expected ErrNotSeekable seeking backwards, got %v", err)
+	}
+
+	if pos, err := f.Seek(-2, io.SeekEnd); err != nil || pos != 8 {
+		t.Fatalf("Seek(-2 from end) = %d, %v", pos, err)
+	}
+
+	if rest, err := io.ReadAll(&f); err != nil || string(rest) != "89" {
+		t.Fatalf("read %q, %v after seeking", rest, err)
+	}
+
+	unknown := NewForwardSeeker(iotest.HalfReader(strings.NewReader("01")), -1)
+	if _, err := unknown.Seek(0, io.SeekEnd); !errors.Is(err, ErrNotSeekable) {
+		t.Fatalf("expected ErrNotSeekable seeking from an unknown end, got %v", err)
+	}
+
+	// readers that can seek are seeked directly
+	seekable := NewForwardSeeker(strings.NewReader("0123"), 4)
+	seekable.Seek(3, io.SeekStart)
+
+	if pos, err := seekable.Seek(1, io.SeekStart); err != nil || pos != 1 || seekable.Pos() != 1 {
+		t.Fatalf("Seek(1) = %d, %v", pos, err)
+	}
+}